@@ -0,0 +1,8 @@
+// csvgen 根据配置表表头生成表结构体和读取函数，参数见csvgen.Main
+package main
+
+import "joynova.com/library/supernova/pkg/csvmanager/csvgen"
+
+func main() {
+	csvgen.Main()
+}
@@ -0,0 +1,9 @@
+// csvlint 按配置表表头或者表结构文件校验配置表，参数见csvlint.Main，
+// 需要校验自定义类型时导入生成的注册包后调用csvlint.Main
+package main
+
+import "joynova.com/library/supernova/pkg/csvmanager/csvlint"
+
+func main() {
+	csvlint.Main()
+}
@@ -0,0 +1,151 @@
+package csvmanager
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"joynova.com/library/supernova/pkg/csvmanager/csv"
+	"joynova.com/library/supernova/pkg/jlog"
+)
+
+// 预编译快照：构建时把校验通过的表解析好的行数据编码为二进制文件，启动时直接解码，
+// 跳过文本解析和反射赋值，源文件md5或者表结构体改变的表自动改为读取源文件
+
+const compiledMagic = "supernova-csv-compiled-v1"
+
+type compiledFile struct {
+	Magic  string
+	Tables []*compiledTable
+}
+
+type compiledTable struct {
+	No       int
+	File     string
+	MD5      string // 源文件md5
+	TypeSign string // 表结构体签名
+	RowsMD5  string // Rows的md5，检查快照文件损坏
+	Rows     []byte
+}
+
+// CompileTables 校验所有表并编译为预编译快照写入out，返回不能编译的表和原因，这些表启动时读取源文件，
+// 用于构建步骤，所有表都需要能通过CheckAllCsvCanLoad
+func (m *CsvManager) CompileTables(out string) (skipped map[int]error, err error) {
+	if err := m.CheckAllCsvCanLoad(true); err != nil {
+		return nil, err
+	}
+
+	path := m.dataPath()
+	allFilesMD5, err := m.md5AllFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &compiledFile{Magic: compiledMagic}
+	skipped = make(map[int]error)
+	for _, table := range sortedTables(m.tablesMetaData()) {
+		rows, err := csv.CompileSource(path+table.File, table.Loader, table.St)
+		if err != nil {
+			skipped[table.No] = err
+			jlog.Warnf("表[%v]不能预编译，启动时读取源文件:%v", table.File, err)
+			continue
+		}
+		file.Tables = append(file.Tables, &compiledTable{
+			No:       table.No,
+			File:     table.File,
+			MD5:      hex.EncodeToString([]byte(allFilesMD5[table.No])),
+			TypeSign: csv.TypeSignature(table.St),
+			RowsMD5:  md5Hex(rows),
+			Rows:     rows,
+		})
+	}
+
+	// 编译过程中文件被改写，快照和源文件对应不上
+	checkMD5, err := m.md5AllFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	if !sameMD5(allFilesMD5, checkMD5) {
+		return nil, fmt.Errorf("预编译过程中表文件被修改")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := gob.NewEncoder(buf).Encode(file); err != nil {
+		return nil, fmt.Errorf("编码预编译快照错误:%v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return nil, err
+	}
+	tmp := out + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+// LoadCompiled 读取预编译快照，之后首次读取表时，源文件md5和表结构体都没变的表从快照解码，
+// 返回可以使用快照的表序号，需要在读取表之前调用，快照文件缺失或损坏返回错误，管理器照常读取源文件
+func (m *CsvManager) LoadCompiled(file string) (used []int, err error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取预编译快照[%v]错误:%v", file, err)
+	}
+	compiled := new(compiledFile)
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(compiled); err != nil {
+		return nil, fmt.Errorf("解码预编译快照[%v]错误:%v", file, err)
+	}
+	if compiled.Magic != compiledMagic {
+		return nil, fmt.Errorf("预编译快照[%v]格式不支持:%v", file, compiled.Magic)
+	}
+
+	tables := make(map[int]*compiledTable, len(compiled.Tables))
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, t := range compiled.Tables {
+		meta, find := m.MetaData.TablesMetaData[t.No]
+		if !find || meta.Data.File != t.File {
+			continue
+		}
+		if t.MD5 != hex.EncodeToString([]byte(m.tablesMD5[t.No])) {
+			jlog.Infof("表[%v]源文件已经改变，不使用预编译快照", t.File)
+			continue
+		}
+		if t.TypeSign != csv.TypeSignature(meta.Data.St) {
+			jlog.Infof("表[%v]结构体已经改变，不使用预编译快照", t.File)
+			continue
+		}
+		if t.RowsMD5 != md5Hex(t.Rows) {
+			jlog.Warnf("预编译快照[%v]中表[%v]数据损坏", file, t.File)
+			continue
+		}
+		tables[t.No] = t
+		used = append(used, t.No)
+	}
+	m.compiled = tables
+	return used, nil
+}
+
+// readCompiled 从预编译快照读取当前版本的表，只使用一次，之后的重读都读取源文件
+func (m *CsvManager) readCompiled(table *TableMetaData, zones []int) ([]*csv.CsvTable, bool) {
+	m.lock.Lock()
+	t, find := m.compiled[table.No]
+	current := find && t.MD5 == hex.EncodeToString([]byte(m.tablesMD5[table.No]))
+	delete(m.compiled, table.No)
+	m.lock.Unlock()
+	if !current {
+		return nil, false
+	}
+
+	list, err := csv.ReadCompiled(m.MetaData.Region, zones, m.dataPath()+table.File, t.Rows, table.St,
+		table.ExtraDataGenFun, table.TableCheckFun)
+	if err != nil {
+		jlog.Warnf("表[%v]从预编译快照读取错误，改为读取源文件:%v", table.File, err)
+		return nil, false
+	}
+	return list, true
+}
@@ -0,0 +1,123 @@
+package csvmanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type compiledTestData struct {
+	ID      int32             `csv:"id" index:"true"`
+	Name    string            `csv:"name"`
+	Gifts   []int32           `csv:"gifts"`
+	Rewards []*compiledReward `csv:"rewards"`
+	Exp     int64             `csv:"exp" sorted:"exp"`
+	upper   string
+}
+
+func (d *compiledTestData) CheckOrParse() (bool, error) {
+	d.upper = d.Name + "!"
+	return d.Name == "omit", nil
+}
+
+type compiledReward struct {
+	ItemID int64
+	Amount int32
+}
+
+func (r *compiledReward) Parse(text string) error {
+	_, err := fmt.Sscanf(text, "%d:%d", &r.ItemID, &r.Amount)
+	return err
+}
+
+type compiledTag struct {
+	value string
+}
+
+func (r *compiledTag) Parse(text string) error {
+	r.value = text
+	return nil
+}
+
+type compiledPrivate struct {
+	ID  int32        `csv:"id" index:"true"`
+	Tag *compiledTag `csv:"tag"`
+}
+
+func TestCompiledTables(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.csv": "int\tstring\tstring\tstring\tint\tstring\nid\tname\tgifts\trewards\texp\tzone_id\n" +
+			"1\ta\t1,2\t1:10\t10\t\n2\tomit\t\t\t0\t\n3\tc\t\t\t30\t2\n",
+		"b.csv": "int\tstring\nid\ttag\n1\tx\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tables := map[int]*TableMetaData{
+		1: {No: 1, St: compiledTestData{}, File: "a.csv"},
+		2: {No: 2, St: compiledPrivate{}, File: "b.csv"},
+	}
+	m, err := NewSpecMeta("1", []int{1, 2}, dir, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "tables.bin")
+	skipped, err := m.CompileTables(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 自定义类型只有不导出的字段，不能编码
+	if len(skipped) != 1 || skipped[2] == nil {
+		t.Fatalf("unexpected skipped tables %v", skipped)
+	}
+
+	newM, err := NewSpecMeta("1", []int{1, 2}, dir, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used, err := newM.LoadCompiled(out)
+	if err != nil || !reflect.DeepEqual(used, []int{1}) {
+		t.Fatalf("load compiled %v %v", used, err)
+	}
+	for _, zone := range []int{1, 2} {
+		zm, _ := newM.GetZoneCsvManager(zone)
+		compiled, _, _ := zm.GetTable(tables[1])
+		zm, _ = m.GetZoneCsvManager(zone)
+		parsed, _, _ := zm.GetTable(tables[1])
+		if !reflect.DeepEqual(compiled.Rows, parsed.Rows) || !reflect.DeepEqual(compiled.Lines, parsed.Lines) {
+			t.Fatalf("zone %v compiled rows %+v, parsed rows %+v", zone, compiled.Rows, parsed.Rows)
+		}
+		if row := compiled.Floor("exp", 20).(*compiledTestData); row.ID != 1 || row.upper != "a!" {
+			t.Fatalf("unexpected row %+v", row)
+		}
+	}
+	zm, _ := newM.GetZoneCsvManager(2)
+	if compiled, _, _ := zm.GetTable(tables[1]); compiled.NumRecord() != 2 {
+		t.Fatalf("zone filter not applied %v", compiled.NumRecord())
+	}
+
+	// 源文件改变或者结构体改变都不使用快照
+	if err := os.WriteFile(filepath.Join(dir, "a.csv"), []byte(files["a.csv"]+"4\td\t\t\t40\t\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	staleM, err := NewSpecMeta("1", []int{1}, dir, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used, err := staleM.LoadCompiled(out); err != nil || len(used) != 0 {
+		t.Fatalf("stale snapshot used %v %v", used, err)
+	}
+	changed := map[int]*TableMetaData{1: {No: 1, St: typedTestData{}, File: "a.csv"}}
+	typeM, err := NewSpecMeta("1", []int{1}, dir, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used, err := typeM.LoadCompiled(out); err != nil || len(used) != 0 {
+		t.Fatalf("snapshot of other struct used %v %v", used, err)
+	}
+}
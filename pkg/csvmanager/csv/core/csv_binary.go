@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// 预编译快照的行数据格式：行数，然后每行依次为compiledRow和gob编码的结构体，
+// 索引信息由结构体标签重新生成，不写入快照
+
+type compiledRow struct {
+	Line         int
+	MatchRegions []string
+	MatchZones   []int
+}
+
+// EncodeRows 原始行数据编码为二进制，编码之后立即解码比较，
+// 不能完整还原的表返回错误，例如自定义类型的数据保存在不导出的字段
+func EncodeRows(rows *csvRowsData) ([]byte, error) {
+	if len(rows.Rows) <= 0 {
+		return encodeRows(rows)
+	}
+	data, err := encodeRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := DecodeRows(data, rows.Rows[0].RowData.Elem().Type())
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded.Rows) != len(rows.Rows) {
+		return nil, fmt.Errorf("解码行数[%v]和原始行数[%v]不一致", len(decoded.Rows), len(rows.Rows))
+	}
+	for i, row := range rows.Rows {
+		d := decoded.Rows[i]
+		if !reflect.DeepEqual(d.GetRowData(), row.GetRowData()) || d.Line != row.Line ||
+			!equalSlice(d.MatchRegions, row.MatchRegions) || !equalSlice(d.MatchZones, row.MatchZones) {
+			return nil, fmt.Errorf("第[%v]行数据编码后不能完整还原", row.Line)
+		}
+	}
+	return data, nil
+}
+
+func encodeRows(rows *csvRowsData) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(len(rows.Rows)); err != nil {
+		return nil, err
+	}
+	for _, row := range rows.Rows {
+		err := enc.Encode(&compiledRow{Line: row.Line, MatchRegions: row.MatchRegions, MatchZones: row.MatchZones})
+		if err != nil {
+			return nil, err
+		}
+		if err := enc.EncodeValue(row.RowData); err != nil {
+			return nil, fmt.Errorf("第[%v]行数据编码错误:%v", row.Line, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeRows 解码EncodeRows生成的数据，行数据实现了DataChecker时重新调用CheckOrParse生成不导出的字段
+func DecodeRows(data []byte, rowDataTemplateTypeRecord reflect.Type) (originRecords *csvRowsData, err error) {
+	if err := checkStFieldKind(rowDataTemplateTypeRecord); err != nil {
+		return nil, fmt.Errorf("校验代码结构体错误:%v", err)
+	}
+	originRecords, err = newCsvRowsData(&templateTypeRecord{rowDataTemplateTypeRecord})
+	if err != nil {
+		return nil, err
+	}
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	n := 0
+	if err := dec.Decode(&n); err != nil {
+		return nil, fmt.Errorf("解码行数错误:%v", err)
+	}
+	originRecords.Rows = make([]*csvRowData, 0, n)
+	for i := 0; i < n; i++ {
+		info := new(compiledRow)
+		if err := dec.Decode(info); err != nil {
+			return nil, fmt.Errorf("解码第[%v]条数据错误:%v", i, err)
+		}
+		value := reflect.New(rowDataTemplateTypeRecord)
+		if err := dec.DecodeValue(value); err != nil {
+			return nil, fmt.Errorf("解码第[%v]行数据错误:%v", info.Line, err)
+		}
+		fillEmptySlices(value.Elem())
+
+		if c, ok := value.Interface().(DataChecker); ok {
+			omit, err := c.CheckOrParse()
+			if err != nil {
+				return nil, fmt.Errorf("第[%v]行数据校验失败:%v", info.Line, err)
+			}
+			if omit {
+				continue
+			}
+		}
+		originRecords.Rows = append(originRecords.Rows, &csvRowData{
+			RowData:      value,
+			MatchRegions: info.MatchRegions,
+			MatchZones:   info.MatchZones,
+			Line:         info.Line,
+		})
+	}
+	return originRecords, nil
+}
+
+// fillEmptySlices 解析时切片列总是非nil，gob解码空切片为nil，恢复为空切片
+func fillEmptySlices(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("csv")
+		if tag == "" || tag == "_" {
+			continue
+		}
+		f := v.Field(i)
+		if f.Kind() == reflect.Slice && f.IsNil() && f.CanSet() {
+			f.Set(reflect.MakeSlice(f.Type(), 0, 0))
+		}
+	}
+}
+
+// TypeSignature 结构体的类型签名，字段名、类型、标签有任何改变签名都会改变，用于判断快照是否和代码一致
+func TypeSignature(t reflect.Type) string {
+	b := new(strings.Builder)
+	writeTypeSignature(b, t, make(map[reflect.Type]bool))
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeTypeSignature(b *strings.Builder, t reflect.Type, visited map[reflect.Type]bool) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		b.WriteString("*")
+		writeTypeSignature(b, t.Elem(), visited)
+	case reflect.Slice:
+		b.WriteString("[]")
+		writeTypeSignature(b, t.Elem(), visited)
+	case reflect.Array:
+		fmt.Fprintf(b, "[%v]", t.Len())
+		writeTypeSignature(b, t.Elem(), visited)
+	case reflect.Map:
+		b.WriteString("map[")
+		writeTypeSignature(b, t.Key(), visited)
+		b.WriteString("]")
+		writeTypeSignature(b, t.Elem(), visited)
+	case reflect.Struct:
+		b.WriteString(t.String())
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		b.WriteString("{")
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fmt.Fprintf(b, "%v ", f.Name)
+			writeTypeSignature(b, f.Type, visited)
+			fmt.Fprintf(b, " %q;", f.Tag)
+		}
+		b.WriteString("}")
+	default:
+		b.WriteString(t.String())
+	}
+}
+
+func equalSlice[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RowError 配置表某行某列的错误
+type RowError struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`   // 文件中的行号，从1开始，0表示不是某一行的错误
+	Column string `json:"column"` // 列名
+	Value  string `json:"value"`  // 原始值
+	Reason string `json:"reason"`
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("文件[%v]第[%v]行列[%v]值[%v]:%v", e.File, e.Line, e.Column, e.Value, e.Reason)
+}
+
+// RowErrors 一次收集的所有行错误
+type RowErrors []*RowError
+
+func (es RowErrors) Error() string {
+	lines := make([]string, 0, len(es))
+	for _, e := range es {
+		lines = append(lines, e.Error())
+	}
+	return fmt.Sprintf("共[%v]个错误:\n%v", len(es), strings.Join(lines, "\n"))
+}
+
+// WithFile 给没有文件名的错误填上文件名
+func (es RowErrors) WithFile(file string) RowErrors {
+	for _, e := range es {
+		if e.File == "" {
+			e.File = file
+		}
+	}
+	return es
+}
@@ -1,55 +1,38 @@
 package core
 
 import (
-	"encoding/csv"
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
-
-	"joynova.com/library/supernova/pkg/csvmanager/utils"
 )
 
-var Comma rune = '\t'
-var Comment = '#'
-
 type parser interface {
 	Parse(string) error
 }
 
-// ReadCsv 读取csv文件，解析出原始行数据
+// ReadCsv 读取配置表文件，按扩展名选择数据源读取器，解析出原始行数据
 func ReadCsv(fileName string, rowDataTemplateTypeRecord reflect.Type) (originRecords *csvRowsData, err error) {
-	file, err := utils.OpenFileFunc(fileName)
-	if err != nil {
-		return nil, fmt.Errorf("打开文件[%v]错误:%v", fileName, err)
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	reader.Comma = Comma
-	reader.Comment = Comment
-
-	_fieldTypeRow, err := reader.Read()
-	if err != nil {
-		return nil, fmt.Errorf("读取文件[%v]字段类型行错误:%v", fileName, err)
-	}
-
-	if _fieldTypeRow == nil {
-		// 字段类型没有用
-	}
+	return ReadSource(fileName, nil, rowDataTemplateTypeRecord)
+}
 
-	fieldNameRow, err := reader.Read()
-	if err != nil {
-		return nil, fmt.Errorf("读取文件[%v]字段名行错误:%v", fileName, err)
+// ReadSource 用指定的数据源读取器读取配置表，解析出原始行数据，loader为空时按扩展名选择
+func ReadSource(fileName string, loader SourceLoader,
+	rowDataTemplateTypeRecord reflect.Type) (originRecords *csvRowsData, err error) {
+	if loader == nil {
+		loader = GetSourceLoader(fileName)
 	}
-
-	dataRows, err := reader.ReadAll()
+	data, err := loader.Load(fileName)
 	if err != nil {
-		return nil, fmt.Errorf("读取文件[%v]所有数据行错误:%v", fileName, err)
+		return nil, err
 	}
 
-	rows, err := parseOriginFileData(fieldNameRow, dataRows, rowDataTemplateTypeRecord)
+	rows, err := parseOriginFileDataWithLines(data.FieldNames, data.Rows, data.Lines, rowDataTemplateTypeRecord)
 	if err != nil {
+		if errs, ok := err.(RowErrors); ok {
+			return nil, errs.WithFile(filepath.Base(fileName))
+		}
 		return nil, fmt.Errorf("转换文件[%v]数据错误:%v", fileName, err)
 	}
 	return rows, nil
@@ -57,6 +40,12 @@ func ReadCsv(fileName string, rowDataTemplateTypeRecord reflect.Type) (originRec
 
 // parseOriginFileData 以表头、原始行数据、csv结构体描述信息解析数据
 func parseOriginFileData(fieldsNameRowInFile []string, dataRows [][]string,
+	rowDataTemplateTypeRecord reflect.Type) (originRecords *csvRowsData, err error) {
+	return parseOriginFileDataWithLines(fieldsNameRowInFile, dataRows, nil, rowDataTemplateTypeRecord)
+}
+
+// parseOriginFileDataWithLines 同parseOriginFileData，lines为每行数据在文件中的行号，为空时按数据行序号计
+func parseOriginFileDataWithLines(fieldsNameRowInFile []string, dataRows [][]string, lines []int,
 	rowDataTemplateTypeRecord reflect.Type) (originRecords *csvRowsData, err error) {
 	if err := checkStFieldKind(rowDataTemplateTypeRecord); err != nil {
 		return nil, fmt.Errorf("校验代码结构体错误:%v", err)
@@ -66,30 +55,65 @@ func parseOriginFileData(fieldsNameRowInFile []string, dataRows [][]string,
 		return nil, fmt.Errorf("校验文件字段错误:%v", err)
 	}
 
-	originRecords = &csvRowsData{}
-
 	// 遍历每一行数据解析
 	templateRecord := &templateTypeRecord{rowDataTemplateTypeRecord}
+	fieldColsInFile, err := templateRecord.getFieldColsInFile(fieldsNameRowInFile)
+	if err != nil {
+		return nil, err
+	}
+
+	originRecords, err = newCsvRowsData(templateRecord)
+	if err != nil {
+		return nil, err
+	}
 
+	var errs RowErrors
+	for i, dataRow := range dataRows {
+		line := i + 1
+		if i < len(lines) {
+			line = lines[i]
+		}
+		csvRowData, omit, rowErrs := originRow(dataRow).parse(fieldsNameRowInFile, templateRecord, fieldColsInFile)
+		if len(rowErrs) > 0 {
+			// 继续解析后面的行，一次报告所有错误
+			for _, e := range rowErrs {
+				e.Line = line
+			}
+			errs = append(errs, rowErrs...)
+			continue
+		}
+		if omit {
+			continue
+		}
+		csvRowData.Line = line
+
+		originRecords.Rows = append(originRecords.Rows, csvRowData)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return
+}
+
+// newCsvRowsData 以结构体的索引标签初始化原始数据的索引信息
+func newCsvRowsData(templateRecord *templateTypeRecord) (*csvRowsData, error) {
+	originRecords := &csvRowsData{}
 	keyColIndexInStruct := templateRecord.getKeyColIndex()
 	groupColIndexInStruct := templateRecord.getGroupKeyColsIndex()
 	unionGroupColIndexInStruct := templateRecord.getUnionGroupKeyColsIndex()
 	unionUniqueColIndexInStruct := templateRecord.getUnionUniqueGroupKeyColsIndex()
+	sortedColIndexInStruct, intervalColsIndexInStruct, err := templateRecord.getSortedColsIndex()
+	if err != nil {
+		return nil, fmt.Errorf("校验代码结构体错误:%v", err)
+	}
 
 	originRecords.KeyIndexInfo.KeyIndexColInStruct = keyColIndexInStruct
 	originRecords.GroupIndexesInfo.GroupIndexColsInStruct = groupColIndexInStruct
 	originRecords.UnionGroupIndexesInfo.UnionGroupIndexColsInStruct = unionGroupColIndexInStruct
 	originRecords.UnionUniqueIndexesInfo.UnionUniqueIndexColInStruct = unionUniqueColIndexInStruct
-
-	for i, dataRow := range dataRows {
-		csvRowData, err := originRow(dataRow).parse(fieldsNameRowInFile, templateRecord)
-		if err != nil {
-			return nil, fmt.Errorf("第[%v]行数据转换为代码结构体错误，详情:%v", i+1, err)
-		}
-
-		originRecords.Rows = append(originRecords.Rows, csvRowData)
-	}
-	return
+	originRecords.SortedIndexesInfo.SortedIndexColInStruct = sortedColIndexInStruct
+	originRecords.IntervalIndexesInfo.IntervalIndexColsInStruct = intervalColsIndexInStruct
+	return originRecords, nil
 }
 
 // setValue 设置结构体一个字段的值
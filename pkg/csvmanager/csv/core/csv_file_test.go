@@ -185,3 +185,127 @@ func TestLoadCsv(t *testing.T) {
 	// loadFile(t)
 	parseTest()
 }
+
+type checkerRow struct {
+	ID    int    `csv:"id" index:"true"`
+	Count int    `csv:"count"`
+	Name  string `csv:"name"`
+}
+
+func (r *checkerRow) CheckOrParse() (omit bool, err error) {
+	if r.Name == "omit" {
+		return true, nil
+	}
+	if r.Count < 0 {
+		return false, fmt.Errorf("count不能小于0")
+	}
+	return false, nil
+}
+
+func TestParseRowErrors(t *testing.T) {
+	fields := []string{"id", "count", "name"}
+	rows := [][]string{
+		{"1", "1", "a"},
+		{"2", "1", "omit"},
+		{"x", "y", "b"},
+		{"4", "-1", "c"},
+		{"1", "2", "d"},
+	}
+	lines := []int{3, 4, 5, 6, 8}
+
+	_, err := parseOriginFileDataWithLines(fields, rows, lines, reflect.TypeOf(checkerRow{}))
+	errs, ok := err.(RowErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expect 3 row errors, got %v", err)
+	}
+	if errs[0].Line != 5 || errs[0].Column != "id" || errs[0].Value != "x" ||
+		errs[1].Line != 5 || errs[1].Column != "count" || errs[1].Value != "y" ||
+		errs[2].Line != 6 || errs[2].Column != "" {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	csvRows, err := parseOriginFileDataWithLines(fields, [][]string{rows[0], rows[1], rows[4]}, []int{3, 4, 8},
+		reflect.TypeOf(checkerRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(csvRows.Rows) != 2 {
+		t.Fatalf("omit row not dropped %v", len(csvRows.Rows))
+	}
+	_, err = csvRows.FilterWithRegionZone("1", 1)
+	errs, ok = err.(RowErrors)
+	if !ok || len(errs) != 1 || errs[0].Line != 8 || errs[0].Column != "id" || errs[0].Value != "1" {
+		t.Fatalf("expect duplicate key error, got %v", err)
+	}
+}
+
+type sortedRow struct {
+	Level int32   `csv:"level" index:"true"`
+	Exp   int64   `csv:"exp" sorted:"exp"`
+	Start int64   `csv:"start" interval:"time"`
+	End   int64   `csv:"end" interval:"time"`
+	Rate  float32 `csv:"rate" sorted:"rate"`
+}
+
+func TestSortedIndex(t *testing.T) {
+	fields := []string{"level", "exp", "start", "end", "rate"}
+	rows := [][]string{
+		{"3", "300", "10", "40", "0.3"},
+		{"1", "0", "0", "20", "0.1"},
+		{"2", "100", "30", "50", "0.2"},
+		{"4", "300", "60", "70", "0.4"},
+	}
+	csvRows, err := parseOriginFileData(fields, rows, reflect.TypeOf(sortedRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := csvRows.FilterWithRegionZone("1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	level := func(v interface{}) int32 {
+		if v == nil {
+			return 0
+		}
+		return v.(*sortedRow).Level
+	}
+	levels := func(list []interface{}) []int32 {
+		ret := make([]int32, 0, len(list))
+		for _, v := range list {
+			ret = append(ret, level(v))
+		}
+		return ret
+	}
+
+	if level(table.Floor("exp", 150)) != 2 || level(table.Floor("exp", uint8(100))) != 2 ||
+		level(table.Floor("exp", 1000)) != 4 || table.Floor("exp", -1) != nil {
+		t.Fatal("unexpected floor")
+	}
+	if level(table.Ceil("exp", 150)) != 3 || level(table.Ceil("exp", 0.5)) != 2 || table.Ceil("exp", 301) != nil {
+		t.Fatal("unexpected ceil")
+	}
+	if level(table.Floor("rate", 0.25)) != 2 || table.Floor("exp", "x") != nil || table.Floor("none", 1) != nil {
+		t.Fatal("unexpected floor with other key types")
+	}
+	if got := levels(table.RangeBetween("exp", 100, 300)); !reflect.DeepEqual(got, []int32{2, 3, 4}) {
+		t.Fatalf("unexpected range %v", got)
+	}
+	if got := table.RangeBetween("exp", 301, 1000); got != nil {
+		t.Fatalf("unexpected empty range %v", got)
+	}
+	for v, want := range map[int64][]int32{
+		0: {1}, 15: {1, 3}, 20: {3}, 35: {3, 2}, 40: {2}, 55: {}, 60: {4}, 70: {},
+	} {
+		if got := levels(table.Containing("time", v)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("containing %v expect %v, got %v", v, want, got)
+		}
+	}
+
+	csvRows, err = parseOriginFileData(fields, [][]string{{"1", "0", "20", "10", "0"}}, reflect.TypeOf(sortedRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := csvRows.FilterWithRegionZone("1", 1); err == nil {
+		t.Fatal("expect interval end before start error")
+	}
+}
@@ -0,0 +1,63 @@
+package core
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// normalizeKey 索引键统一类型，所有整数转为int64，浮点数转为float64，
+// 建索引和查询都用这个转换，不同宽度、有无符号的整数都能查到，不支持的类型返回false
+func normalizeKey(key interface{}) (interface{}, bool) {
+	v := reflect.ValueOf(key)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return v.Bool(), true
+	}
+	return nil, false
+}
+
+// keyString 联合索引的键转为字符串，和normalizeKey一样不区分整数的宽度和符号
+func keyString(key interface{}) (string, bool) {
+	k, ok := normalizeKey(key)
+	if !ok {
+		return "", false
+	}
+	switch v := k.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// unionKey 联合索引的键，每个值后加分隔符
+func unionKey(keys ...interface{}) (string, bool) {
+	indexKey := ""
+	for _, v := range keys {
+		s, ok := keyString(v)
+		if !ok {
+			return "", false
+		}
+		indexKey += s + "."
+	}
+	return indexKey, true
+}
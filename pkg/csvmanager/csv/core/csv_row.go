@@ -14,28 +14,52 @@ type DataChecker interface {
 
 type originRow []string
 
-func (r originRow) parse(fieldsNameRowInFile []string, templateRecord *templateTypeRecord) (*csvRowData, error) {
+// parse 解析一行数据，omit为true表示DataChecker要求忽略这一行，errs为这一行所有列的错误，行号由调用方填写
+func (r originRow) parse(fieldsNameRowInFile []string, templateRecord *templateTypeRecord,
+	fieldColsInFile []int) (rowData *csvRowData, omit bool, errs RowErrors) {
+	if len(r) != len(fieldsNameRowInFile) {
+		return nil, false, RowErrors{{
+			Reason: fmt.Sprintf("字段数量与表头数不一致:%v,%v", len(r), len(fieldsNameRowInFile)),
+		}}
+	}
+
 	matchRegions := r.getMatchRegions(fieldsNameRowInFile)
 	matchZones, err := r.getMatchZones(fieldsNameRowInFile)
 	if err != nil {
-		return nil, err
+		errs = append(errs, &RowError{Column: "zone_id", Value: r.colValue(fieldsNameRowInFile, "zone_id"), Reason: err.Error()})
 	}
-	structRowData, err := r.parseRowValuesToStruct(templateRecord.to, fieldsNameRowInFile)
-	if err != nil {
-		return nil, err
+	structRowData, fieldErrs := r.parseRowValuesToStruct(templateRecord.to, fieldsNameRowInFile, fieldColsInFile)
+	errs = append(errs, fieldErrs...)
+	if len(errs) > 0 {
+		return nil, false, errs
 	}
 
 	c, ok := structRowData.Interface().(DataChecker)
 	if ok {
-		c.CheckOrParse()
+		omit, err := c.CheckOrParse()
+		if err != nil {
+			return nil, false, RowErrors{{Reason: fmt.Sprintf("行数据校验失败:%v", err)}}
+		}
+		if omit {
+			return nil, true, nil
+		}
 	}
 
-	rowData := &csvRowData{
+	rowData = &csvRowData{
 		RowData:      structRowData,
 		MatchRegions: matchRegions,
 		MatchZones:   matchZones,
 	}
-	return rowData, nil
+	return rowData, false, nil
+}
+
+func (r originRow) colValue(fieldsNameRow []string, name string) string {
+	for i := range fieldsNameRow {
+		if fieldsNameRow[i] == name {
+			return r[i]
+		}
+	}
+	return ""
 }
 
 func (r originRow) getMatchRegions(fieldsNameRow []string) []string {
@@ -73,86 +97,66 @@ func (r originRow) getMatchZones(fieldsNameRow []string) (list []int, err error)
 	return
 }
 
-// setRowValuesToStruct 将一行数据怼给对应的结构体数据返回出去
-func (r originRow) parseRowValuesToStruct(typeRecord reflect.Type, fieldsNameRowInFile []string) (reflect.Value, error) {
+// parseRowValuesToStruct 将一行数据怼给对应的结构体数据返回出去，收集所有字段的转换错误
+func (r originRow) parseRowValuesToStruct(typeRecord reflect.Type, fieldsNameRowInFile []string,
+	fieldColsInFile []int) (reflect.Value, RowErrors) {
 	dataRow := []string(r)
 
-	if len(dataRow) != len(fieldsNameRowInFile) {
-		return reflect.Value{}, fmt.Errorf("字段数量与表头数不一致:%v,%v", len(dataRow), len(fieldsNameRowInFile))
-	}
-
 	// new一个表数据结构体
 	value := reflect.New(typeRecord)
 	record := value.Elem()
 
+	var errs RowErrors
 	// 给每个字段赋值
 	for i := 0; i < typeRecord.NumField(); i++ {
-		f := typeRecord.Field(i)
-		fieldTagName := f.Tag.Get("csv")
-		if fieldTagName == "" {
-			continue
-		}
-		if fieldTagName == "_" {
-			continue
-		}
-
-		findFieldColInFile := -1
-		for iInFile, fieldNameInFile := range fieldsNameRowInFile {
-			if fieldTagName == fieldNameInFile {
-				// 结构体字段在文件也定义了
-				findFieldColInFile = iInFile
-				break
-			}
-		}
-
+		findFieldColInFile := fieldColsInFile[i]
 		if findFieldColInFile < 0 {
-			return reflect.Value{},
-				fmt.Errorf("代码和配置表不匹配，表结构体字段[%v,%s]没有在配置表找到:%+v", f.Name, f.Tag, fieldsNameRowInFile)
+			continue
 		}
 
-		fieldStr := dataRow[findFieldColInFile]
-
 		field := record.Field(i)
 		if !field.CanSet() {
 			continue
 		}
 
+		fieldStr := dataRow[findFieldColInFile]
 		err := setValue(field, fieldStr)
 		if err != nil {
-			return reflect.Value{},
-				fmt.Errorf("字段[%v]，值[%v]转换失败:%v",
-					fieldTagName, fieldStr, err)
+			errs = append(errs, &RowError{
+				Column: fieldsNameRowInFile[findFieldColInFile],
+				Value:  fieldStr,
+				Reason: fmt.Sprintf("转换失败:%v", err),
+			})
 		}
 	}
 
-	return value, nil
+	return value, errs
 }
 
 type csvRowData struct {
 	RowData      reflect.Value // 原始行数据
 	MatchRegions []string      // 匹配的region
 	MatchZones   []int         // 匹配的区服
+	Line         int           // 在文件中的行号
 }
 
 func (row *csvRowData) GetRowData() interface{} {
 	return row.RowData.Interface()
 }
 
+// colName 结构体字段对应的csv列名
+func (row *csvRowData) colName(col int) string {
+	return row.RowData.Elem().Type().Field(col).Tag.Get("csv")
+}
+
 func (row *csvRowData) GetColValue(col int) reflect.Value {
 	return row.RowData.Elem().Field(col)
 }
 
 func (row *csvRowData) getKeyColValue(col int) (interface{}, reflect.Value) {
 	keyFieldValue := row.GetColValue(col)
-	var parsedKeyFieldValue interface{}
-	switch keyFieldValue.Kind() {
-	case reflect.Int:
-		parsedKeyFieldValue = int64(keyFieldValue.Interface().(int))
-	case reflect.Int32:
-		parsedKeyFieldValue = int64(keyFieldValue.Interface().(int32))
-	case reflect.Int64:
-		parsedKeyFieldValue = keyFieldValue.Interface().(int64)
-	default:
+	parsedKeyFieldValue, ok := normalizeKey(keyFieldValue.Interface())
+	if !ok {
 		parsedKeyFieldValue = keyFieldValue.Interface()
 	}
 	return parsedKeyFieldValue, keyFieldValue
@@ -160,24 +164,9 @@ func (row *csvRowData) getKeyColValue(col int) (interface{}, reflect.Value) {
 
 func (row *csvRowData) getKeyColString(col int) string {
 	keyFieldValue := row.GetColValue(col)
-	var parsedKeyFieldValue string
-	switch keyFieldValue.Kind() {
-	case reflect.Int:
-		parsedKeyFieldValue = strconv.FormatInt(int64(keyFieldValue.Interface().(int)), 10)
-	case reflect.Int32:
-		parsedKeyFieldValue = strconv.FormatInt(int64(keyFieldValue.Interface().(int32)), 10)
-	case reflect.Int64:
-		parsedKeyFieldValue = strconv.FormatInt(keyFieldValue.Interface().(int64), 10)
-	case reflect.Bool:
-		if keyFieldValue.Interface().(bool) {
-			parsedKeyFieldValue = "true"
-		} else {
-			parsedKeyFieldValue = "false"
-		}
-	case reflect.String:
-		parsedKeyFieldValue = keyFieldValue.Interface().(string)
-	default:
-		panic(fmt.Errorf("unsupport csv type:%v", keyFieldValue.Kind()))
+	parsedKeyFieldValue, ok := keyString(keyFieldValue.Interface())
+	if !ok {
+		parsedKeyFieldValue = fmt.Sprint(keyFieldValue.Interface())
 	}
 	return parsedKeyFieldValue
 }
@@ -210,3 +199,12 @@ func (row *csvRowData) matchRegionAndZone(region string, zone int) bool {
 	}
 	return canMatch
 }
+
+// getUnionKey 联合索引的键，每列的值后加分隔符
+func (row *csvRowData) getUnionKey(cols []int) string {
+	unionKey := ""
+	for _, i := range cols {
+		unionKey += row.getKeyColString(i) + "."
+	}
+	return unionKey
+}
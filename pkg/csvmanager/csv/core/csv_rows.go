@@ -2,15 +2,14 @@ package core
 
 import (
 	"fmt"
-	"reflect"
-	"strconv"
 )
 
 // CsvOriginRowsData 原始行数据，包含索引数据
 type CsvOriginRowsData struct {
 	Region       string
 	Zone         int
-	Rows         []interface{}
+	Rows         []interface{} // 本区服持有的行，差异层只有比基础数据多出来的行，读取所有行用Records、Range、Record
+	Lines        []int         // Rows中每行数据在文件中的行号
 	KeyIndexData struct {
 		HasKeyIndex bool
 		KeyIndexMap map[interface{}]int
@@ -27,46 +26,122 @@ type CsvOriginRowsData struct {
 		HasUnionUniqueIndex  bool
 		UnionUniqueIndexMaps map[string]map[string]int // 支持多个联合唯一索引
 	}
+	SortedIndexData struct {
+		HasSortedIndex  bool
+		SortedIndexMaps map[string]*sortedIndex // 有序索引
+	}
+	IntervalIndexData struct {
+		HasIntervalIndex  bool
+		IntervalIndexMaps map[string]*intervalIndex // 区间索引
+	}
+
+	owner       *CsvOriginRowsData // 持有索引数据的对象，共用数据的区服指向同一个
+	base        *CsvOriginRowsData // 差异层的基础数据，索引查不到时查基础数据
+	removed     map[int]bool       // 基础数据中本区服没有的行序号
+	removedRows []int              // removed中的行序号，从小到大排列
+	positions   []int              // 差异层Rows中每行在本区服所有行中的序号
 }
 
+// Range 按文件中的顺序遍历所有行
 func (td *CsvOriginRowsData) Range(f func(interface{})) {
+	if td.base != nil {
+		td.overlayRange(func(row interface{}, line int) {
+			f(row)
+		})
+		return
+	}
 	for _, v := range td.Rows {
 		f(v)
 	}
 }
 
+// Records 按文件中的顺序返回所有行，差异层每次调用生成新的列表
+func (td *CsvOriginRowsData) Records() []interface{} {
+	if td.base == nil {
+		return td.Rows
+	}
+	ret := make([]interface{}, 0, td.NumRecord())
+	td.Range(func(v interface{}) {
+		ret = append(ret, v)
+	})
+	return ret
+}
+
 func (td *CsvOriginRowsData) Record(i int) interface{} {
-	if 0 <= i && i < len(td.Rows) {
-		return td.Rows[i]
+	if i < 0 || i >= td.NumRecord() {
+		return nil
 	}
-	return nil
+	if td.base != nil {
+		pos, own := td.locate(i)
+		if !own {
+			return td.base.Rows[pos]
+		}
+		return td.Rows[pos]
+	}
+	return td.Rows[i]
+}
+
+// Line 第i条数据在文件中的行号，找不到返回0
+func (td *CsvOriginRowsData) Line(i int) int {
+	if i < 0 || i >= td.NumRecord() {
+		return 0
+	}
+	if td.base != nil {
+		pos, own := td.locate(i)
+		if !own {
+			return td.base.Lines[pos]
+		}
+		return td.Lines[pos]
+	}
+	if i < len(td.Lines) {
+		return td.Lines[i]
+	}
+	return 0
 }
 
 func (td *CsvOriginRowsData) NumRecord() int {
+	if td.base != nil {
+		return len(td.Rows) + len(td.base.Rows) - len(td.removed)
+	}
 	return len(td.Rows)
 }
 
 func (td *CsvOriginRowsData) Index(key interface{}) interface{} {
-	var indexKey interface{} = td.parseNumberKey(key)
+	indexKey, ok := normalizeKey(key)
+	if !ok {
+		return nil
+	}
 	row, find := td.KeyIndexData.KeyIndexMap[indexKey]
 	if find {
 		return td.Rows[row]
 	}
+	if base := td.base; base != nil {
+		if row, find := base.KeyIndexData.KeyIndexMap[indexKey]; find && !td.removed[row] {
+			return base.Rows[row]
+		}
+	}
 	return nil
 }
 
 // IndexGroup 索引组主键，groupSequece代表group在结构体字段里出现的顺序，从0开始
 // 例如：
-// type Test struct {
-//     A int `csv:"a" group:"true"`
-//     B int `csv:"b" group:"true"`
-// }
+//
+//	type Test struct {
+//	    A int `csv:"a" group:"true"`
+//	    B int `csv:"b" group:"true"`
+//	}
+//
 // 要索引字段b，就IndexGroup(1, xx)
 func (td *CsvOriginRowsData) IndexGroup(groupSequece int, key interface{}) []interface{} {
-	var indexKey = td.parseNumberKey(key)
-	lists := td.GroupIndexData.GroupIndexMaps[groupSequece]
-	list, find := lists[indexKey]
-	if !find {
+	indexKey, ok := normalizeKey(key)
+	if !ok || groupSequece < 0 || groupSequece >= len(td.GroupIndexData.GroupIndexMaps) {
+		return nil
+	}
+	list := td.GroupIndexData.GroupIndexMaps[groupSequece][indexKey]
+	if td.base != nil {
+		return td.mergeBase(list, td.base.GroupIndexData.GroupIndexMaps[groupSequece][indexKey])
+	}
+	if len(list) <= 0 {
 		return nil
 	}
 	ret := make([]interface{}, 0, len(list))
@@ -78,22 +153,27 @@ func (td *CsvOriginRowsData) IndexGroup(groupSequece int, key interface{}) []int
 
 // IndexUnionGroup 联合索引
 // 例如：
-// type Test struct {
-//     A int `csv:"a" union:"logic1"`
-//     B int `csv:"b" union:"logic1"`
-// }
+//
+//	type Test struct {
+//	    A int `csv:"a" union:"logic1"`
+//	    B int `csv:"b" union:"logic1"`
+//	}
+//
 // IndexUnionGroup("logic1", 12, 23)
 func (td *CsvOriginRowsData) IndexUnionGroup(group string, key ...interface{}) []interface{} {
 	m, find := td.UnionGroupIndexData.UnionGroupIndexMaps[group]
 	if !find {
 		return nil
 	}
-	indexKey := ""
-	for _, v := range key {
-		indexKey += td.parseNumberKey2String(v)
+	indexKey, ok := unionKey(key...)
+	if !ok {
+		return nil
 	}
-	list, find := m[indexKey]
-	if !find {
+	list := m[indexKey]
+	if td.base != nil {
+		return td.mergeBase(list, td.base.UnionGroupIndexData.UnionGroupIndexMaps[group][indexKey])
+	}
+	if len(list) <= 0 {
 		return nil
 	}
 	ret := make([]interface{}, 0, len(list))
@@ -105,63 +185,32 @@ func (td *CsvOriginRowsData) IndexUnionGroup(group string, key ...interface{}) [
 
 // IndexUnionUnique 联合索引
 // 例如：
-// type Test struct {
-//     A int `csv:"a" unionu:"logic1"`
-//     B int `csv:"b" unionu:"logic1"`
-// }
+//
+//	type Test struct {
+//	    A int `csv:"a" unionu:"logic1"`
+//	    B int `csv:"b" unionu:"logic1"`
+//	}
+//
 // IndexUnionUnique("logic1", 12, 23)
 func (td *CsvOriginRowsData) IndexUnionUnique(group string, key ...interface{}) interface{} {
 	m, find := td.UnionUniqueIndexData.UnionUniqueIndexMaps[group]
 	if !find {
 		return nil
 	}
-	indexKey := ""
-	for _, v := range key {
-		indexKey += td.parseNumberKey2String(v)
+	indexKey, ok := unionKey(key...)
+	if !ok {
+		return nil
 	}
 	idx, find := m[indexKey]
-	if !find {
-		return nil
+	if find {
+		return td.Rows[idx]
 	}
-	return td.Rows[idx]
-}
-
-func (td *CsvOriginRowsData) parseNumberKey2String(key interface{}) string {
-	var indexKey string
-	switch reflect.ValueOf(key).Kind() {
-	case reflect.Int:
-		indexKey = strconv.FormatInt(int64(key.(int)), 10)
-	case reflect.Int32:
-		indexKey = strconv.FormatInt(int64(key.(int32)), 10)
-	case reflect.Int64:
-		indexKey = strconv.FormatInt(key.(int64), 10)
-	case reflect.String:
-		indexKey = key.(string)
-	case reflect.Bool:
-		indexKey = strconv.FormatBool(key.(bool))
-	default:
-		panic(fmt.Errorf("unsupport csv key type:%v", reflect.ValueOf(key).Kind()))
-	}
-	return indexKey
-}
-
-func (td *CsvOriginRowsData) parseNumberKey(key interface{}) interface{} {
-	var indexKey interface{}
-	switch reflect.ValueOf(key).Kind() {
-	case reflect.Int:
-		indexKey = int64(key.(int))
-	case reflect.Int32:
-		indexKey = int64(key.(int32))
-	case reflect.Int64:
-		indexKey = key.(int64)
-	case reflect.String:
-		indexKey = key.(string)
-	case reflect.Bool:
-		indexKey = strconv.FormatBool(key.(bool))
-	default:
-		panic(fmt.Errorf("unsupport csv key type:%v", reflect.ValueOf(key).Kind()))
-	}
-	return indexKey
+	if base := td.base; base != nil {
+		if idx, find := base.UnionUniqueIndexData.UnionUniqueIndexMaps[group][indexKey]; find && !td.removed[idx] {
+			return base.Rows[idx]
+		}
+	}
+	return nil
 }
 
 type csvRowsData struct {
@@ -178,116 +227,147 @@ type csvRowsData struct {
 	UnionUniqueIndexesInfo struct {
 		UnionUniqueIndexColInStruct map[string][]int // 联合唯一主键
 	}
+	SortedIndexesInfo struct {
+		SortedIndexColInStruct map[string]int // 有序索引字段
+	}
+	IntervalIndexesInfo struct {
+		IntervalIndexColsInStruct map[string][2]int // 区间索引的开始、结束字段
+	}
 }
 
 // FilterWithRegionZone 原始数据按指定region、zone过滤出数据
 func (rows *csvRowsData) FilterWithRegionZone(region string, zone int) (parsedRowsData *CsvOriginRowsData, err error) {
+	parsedRowsData, errs := rows.buildZone(region, zone, rows.match(region, zone))
+	if len(errs) > 0 {
+		// 一次报告所有重复的行
+		return nil, errs
+	}
+	return parsedRowsData, nil
+}
 
-	var (
-		originRows                 []interface{}
-		keyIndexValuesMap          map[interface{}]int
-		groupIndexValuesMaps       []map[interface{}][]int
-		unionGroupIndexValuesMaps  map[string]map[string][]int
-		unionUniqueIndexValuesMaps map[string]map[string]int
-	)
+// match 匹配region、zone的行序号
+func (rows *csvRowsData) match(region string, zone int) []int {
+	matched := make([]int, 0, len(rows.Rows))
+	for i, v := range rows.Rows {
+		if v.matchRegionAndZone(region, zone) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
 
-	parsedRowsData = &CsvOriginRowsData{
+// newZoneData 初始化一个区服的数据和空索引
+func (rows *csvRowsData) newZoneData(region string, zone int) *CsvOriginRowsData {
+	parsedRowsData := &CsvOriginRowsData{
 		Region: region,
 		Zone:   zone,
 	}
+	parsedRowsData.owner = parsedRowsData
 
 	// 初始化过滤的主键数据
 	if rows.KeyIndexInfo.KeyIndexColInStruct >= 0 {
-		keyIndexValuesMap = make(map[interface{}]int)
+		parsedRowsData.KeyIndexData.KeyIndexMap = make(map[interface{}]int)
 		parsedRowsData.KeyIndexData.HasKeyIndex = true
 	}
 	if len(rows.GroupIndexesInfo.GroupIndexColsInStruct) > 0 {
-		groupIndexValuesMaps = make([]map[interface{}][]int, len(rows.GroupIndexesInfo.GroupIndexColsInStruct))
+		groupIndexValuesMaps := make([]map[interface{}][]int, len(rows.GroupIndexesInfo.GroupIndexColsInStruct))
 		for i := range rows.GroupIndexesInfo.GroupIndexColsInStruct {
 			groupIndexValuesMaps[i] = make(map[interface{}][]int)
 		}
+		parsedRowsData.GroupIndexData.GroupIndexMaps = groupIndexValuesMaps
 		parsedRowsData.GroupIndexData.HasGroupIndex = true
 	}
 	if len(rows.UnionGroupIndexesInfo.UnionGroupIndexColsInStruct) > 0 {
-		unionGroupIndexValuesMaps = make(map[string]map[string][]int)
+		unionGroupIndexValuesMaps := make(map[string]map[string][]int)
 		for k := range rows.UnionGroupIndexesInfo.UnionGroupIndexColsInStruct {
 			unionGroupIndexValuesMaps[k] = make(map[string][]int) // 存储具体的值对应的行
 		}
+		parsedRowsData.UnionGroupIndexData.UnionGroupIndexMaps = unionGroupIndexValuesMaps
 		parsedRowsData.UnionGroupIndexData.HasUnionGroupIndex = true
 	}
 	if len(rows.UnionUniqueIndexesInfo.UnionUniqueIndexColInStruct) > 0 {
-		unionUniqueIndexValuesMaps = make(map[string]map[string]int)
+		unionUniqueIndexValuesMaps := make(map[string]map[string]int)
 		for k := range rows.UnionUniqueIndexesInfo.UnionUniqueIndexColInStruct {
 			unionUniqueIndexValuesMaps[k] = make(map[string]int) // 存储具体的值对应的行
 		}
+		parsedRowsData.UnionUniqueIndexData.UnionUniqueIndexMaps = unionUniqueIndexValuesMaps
 		parsedRowsData.UnionUniqueIndexData.HasUnionUniqueIndex = true
 	}
+	return parsedRowsData
+}
+
+// buildZone 以匹配的行生成一个区服的完整数据
+func (rows *csvRowsData) buildZone(region string, zone int, matched []int) (*CsvOriginRowsData, RowErrors) {
+	parsedRowsData := rows.newZoneData(region, zone)
+	filtered := make([]*csvRowData, 0, len(matched))
+	positions := make([]int, 0, len(matched))
+	for _, i := range matched {
+		v := rows.Rows[i]
+		filtered = append(filtered, v)
+		positions = append(positions, len(parsedRowsData.Rows))
+		parsedRowsData.Rows = append(parsedRowsData.Rows, v.GetRowData())
+		parsedRowsData.Lines = append(parsedRowsData.Lines, v.Line)
+	}
+	errs := rows.buildIndexes(parsedRowsData, filtered, positions, zone)
+	errs = append(errs, rows.buildSortedIndexes(parsedRowsData, filtered, zone)...)
+	return parsedRowsData, errs
+}
 
-	for originI, v := range rows.Rows {
-		if v.matchRegionAndZone(region, zone) {
-			originRows = append(originRows, v.GetRowData())
-			rowIndex := len(originRows) - 1
+// buildIndexes 把行加入哈希索引，positions为每行在区服数据Rows中的位置
+func (rows *csvRowsData) buildIndexes(parsedRowsData *CsvOriginRowsData, filtered []*csvRowData, positions []int,
+	zone int) RowErrors {
+	var errs RowErrors
+	keyIndexValuesMap := parsedRowsData.KeyIndexData.KeyIndexMap
+	groupIndexValuesMaps := parsedRowsData.GroupIndexData.GroupIndexMaps
+	unionGroupIndexValuesMaps := parsedRowsData.UnionGroupIndexData.UnionGroupIndexMaps
+	unionUniqueIndexValuesMaps := parsedRowsData.UnionUniqueIndexData.UnionUniqueIndexMaps
+	for n, v := range filtered {
+		rowIndex := positions[n]
 
-			// 过滤主键
-			if rows.KeyIndexInfo.KeyIndexColInStruct >= 0 {
-				parsedKeyFieldValue, _ := v.getKeyColValue(rows.KeyIndexInfo.KeyIndexColInStruct)
-				_, find := keyIndexValuesMap[parsedKeyFieldValue]
-				if find {
-					err = fmt.Errorf("唯一索引在第[%v]行出现重复值[%v]", originI+1, parsedKeyFieldValue)
-					return
-				}
+		// 过滤主键
+		if rows.KeyIndexInfo.KeyIndexColInStruct >= 0 {
+			parsedKeyFieldValue, _ := v.getKeyColValue(rows.KeyIndexInfo.KeyIndexColInStruct)
+			_, find := keyIndexValuesMap[parsedKeyFieldValue]
+			if find {
+				errs = append(errs, &RowError{
+					Line:   v.Line,
+					Column: v.colName(rows.KeyIndexInfo.KeyIndexColInStruct),
+					Value:  fmt.Sprint(parsedKeyFieldValue),
+					Reason: fmt.Sprintf("区服[%v]唯一索引出现重复值", zone),
+				})
+			} else {
 				keyIndexValuesMap[parsedKeyFieldValue] = rowIndex
 			}
-			// 过滤组索引
-			for i, col := range rows.GroupIndexesInfo.GroupIndexColsInStruct {
-				// 取设置了group索引的列的值
-				parsedKeyFieldValue, _ := v.getKeyColValue(col)
-				curGroupMap := groupIndexValuesMaps[i]
-				list, find := curGroupMap[parsedKeyFieldValue]
-				if !find {
-					list = make([]int, 0, 1)
-				}
-				list = append(list, rowIndex)
-				curGroupMap[parsedKeyFieldValue] = list
-				groupIndexValuesMaps[i] = curGroupMap
-			}
-			// 过滤联合普通索引
-			for k, is := range rows.UnionGroupIndexesInfo.UnionGroupIndexColsInStruct {
-				unionKey := ""
-				for _, i := range is {
-					fieldValueString := v.getKeyColString(i)
-					unionKey += fieldValueString + "."
-				}
-				valuesM, _ := unionGroupIndexValuesMaps[k]
-				list := valuesM[unionKey]
-				list = append(list, rowIndex)
-				valuesM[unionKey] = list
-				unionGroupIndexValuesMaps[k] = valuesM
-			}
-			// 过滤联合唯一索引
-			for k, is := range rows.UnionUniqueIndexesInfo.UnionUniqueIndexColInStruct {
-				unionKey := ""
-				for _, i := range is {
-					fieldValueString := v.getKeyColString(i)
-					unionKey += fieldValueString + "."
-				}
-				valuesM, _ := unionUniqueIndexValuesMaps[k]
-				_, find := valuesM[unionKey]
-				if find {
-					err = fmt.Errorf("联合唯一索引[%v]在[%v]行出现重复值[%v]", k, originI+1, unionKey)
-					return
-				}
-				valuesM[unionKey] = rowIndex
-				unionUniqueIndexValuesMaps[k] = valuesM
+		}
+		// 过滤组索引
+		for i, col := range rows.GroupIndexesInfo.GroupIndexColsInStruct {
+			// 取设置了group索引的列的值
+			parsedKeyFieldValue, _ := v.getKeyColValue(col)
+			curGroupMap := groupIndexValuesMaps[i]
+			curGroupMap[parsedKeyFieldValue] = append(curGroupMap[parsedKeyFieldValue], rowIndex)
+		}
+		// 过滤联合普通索引
+		for k, is := range rows.UnionGroupIndexesInfo.UnionGroupIndexColsInStruct {
+			unionKey := v.getUnionKey(is)
+			valuesM := unionGroupIndexValuesMaps[k]
+			valuesM[unionKey] = append(valuesM[unionKey], rowIndex)
+		}
+		// 过滤联合唯一索引
+		for k, is := range rows.UnionUniqueIndexesInfo.UnionUniqueIndexColInStruct {
+			unionKey := v.getUnionKey(is)
+			valuesM := unionUniqueIndexValuesMaps[k]
+			_, find := valuesM[unionKey]
+			if find {
+				errs = append(errs, &RowError{
+					Line:   v.Line,
+					Column: k,
+					Value:  unionKey,
+					Reason: fmt.Sprintf("区服[%v]联合唯一索引出现重复值", zone),
+				})
+				continue
 			}
+			valuesM[unionKey] = rowIndex
 		}
 	}
-
-	parsedRowsData.Rows = originRows
-	parsedRowsData.KeyIndexData.KeyIndexMap = keyIndexValuesMap
-	parsedRowsData.GroupIndexData.GroupIndexMaps = groupIndexValuesMaps
-	parsedRowsData.UnionGroupIndexData.UnionGroupIndexMaps = unionGroupIndexValuesMaps
-	parsedRowsData.UnionUniqueIndexData.UnionUniqueIndexMaps = unionUniqueIndexValuesMaps
-
-	return
+	return errs
 }
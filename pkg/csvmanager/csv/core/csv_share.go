@@ -0,0 +1,290 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// 多区服共用数据：同一进程承载很多区服时，匹配的行完全相同的区服共用一份行数据和索引，
+// 行不同的区服以匹配区服最多的一份数据为基础，只保存多出来的行和它们的索引、少了的行的序号，
+// 按序号读取时换算到自己的行或基础数据的行，查询时合并自己和基础数据的索引结果，跳过少了的行
+
+// RowsMemoryStats 一个区服数据自己持有的内存，共用的部分不计入
+type RowsMemoryStats struct {
+	Shared       bool // 和其他区服共用同一份数据
+	Overlay      bool // 是其他区服数据之上的差异层
+	OverlayRows  int  // 差异层比基础数据多的行数
+	RemovedRows  int  // 差异层比基础数据少的行数
+	RowPointers  int  // 持有的行数，每行一个行引用和一个行号，差异层为多出来的行数加少了的行数
+	IndexEntries int  // 持有的索引条目数
+}
+
+// FilterZones 按region和多个zone过滤数据，返回和zones一一对应的数据和错误，
+// 匹配的行相同的区服共用数据，见SharedWith
+func (rows *csvRowsData) FilterZones(region string, zones []int) ([]*CsvOriginRowsData, []error) {
+	list := make([]*CsvOriginRowsData, len(zones))
+	errs := make([]error, len(zones))
+
+	// 匹配的行相同的区服分为一组
+	var groups [][]int
+	var groupMatched [][]int
+	groupByKey := make(map[string]int)
+	for i, zone := range zones {
+		matched := rows.match(region, zone)
+		key := matchedKey(matched)
+		g, find := groupByKey[key]
+		if !find {
+			g = len(groups)
+			groupByKey[key] = g
+			groups = append(groups, nil)
+			groupMatched = append(groupMatched, matched)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	if len(groups) <= 0 {
+		return list, errs
+	}
+
+	baseGroup := 0
+	for g := range groups {
+		if len(groups[g]) > len(groups[baseGroup]) {
+			baseGroup = g
+		}
+	}
+	base, baseErrs := rows.buildZone(region, zones[groups[baseGroup][0]], groupMatched[baseGroup])
+	if len(baseErrs) > 0 {
+		base = nil
+	}
+
+	for g, members := range groups {
+		var data *CsvOriginRowsData
+		var dataErrs RowErrors
+		switch {
+		case g == baseGroup:
+			data, dataErrs = base, baseErrs
+		case base != nil:
+			data, dataErrs = rows.buildOverlay(base, groupMatched[baseGroup], region, zones[members[0]], groupMatched[g])
+		default:
+			data, dataErrs = rows.buildZone(region, zones[members[0]], groupMatched[g])
+		}
+		for n, i := range members {
+			if len(dataErrs) > 0 {
+				// 错误信息带有区服，每个区服单独报告
+				if n == 0 {
+					errs[i] = dataErrs
+				} else {
+					_, errs[i] = rows.FilterWithRegionZone(region, zones[i])
+				}
+				continue
+			}
+			if n == 0 {
+				list[i] = data
+				continue
+			}
+			view := *data
+			view.Zone = zones[i]
+			list[i] = &view
+		}
+	}
+	return list, errs
+}
+
+func matchedKey(matched []int) string {
+	b := make([]byte, 0, len(matched)*4)
+	for _, i := range matched {
+		b = strconv.AppendInt(b, int64(i), 36)
+		b = append(b, ',')
+	}
+	return string(b)
+}
+
+// buildOverlay 以base为基础生成区服数据，差异太大时直接生成完整数据
+func (rows *csvRowsData) buildOverlay(base *CsvOriginRowsData, baseMatched []int, region string, zone int,
+	matched []int) (*CsvOriginRowsData, RowErrors) {
+	inBase := make(map[int]int, len(baseMatched))
+	for pos, i := range baseMatched {
+		inBase[i] = pos
+	}
+	inZone := make(map[int]bool, len(matched))
+	extra := 0
+	for _, i := range matched {
+		inZone[i] = true
+		if _, find := inBase[i]; !find {
+			extra++
+		}
+	}
+	removed := make(map[int]bool)
+	var removedRows []int
+	for pos, i := range baseMatched {
+		if !inZone[i] {
+			removed[pos] = true
+			removedRows = append(removedRows, pos)
+		}
+	}
+	if (extra+len(removed))*2 > len(matched) {
+		return rows.buildZone(region, zone, matched)
+	}
+
+	overlay := rows.newZoneData(region, zone)
+	overlay.base = base
+	overlay.removed = removed
+	overlay.removedRows = removedRows
+	extraRows := make([]*csvRowData, 0, extra)
+	positions := make([]int, 0, extra)
+	for n, i := range matched {
+		if _, find := inBase[i]; find {
+			continue
+		}
+		v := rows.Rows[i]
+		extraRows = append(extraRows, v)
+		positions = append(positions, len(overlay.Rows))
+		overlay.positions = append(overlay.positions, n)
+		overlay.Rows = append(overlay.Rows, v.GetRowData())
+		overlay.Lines = append(overlay.Lines, v.Line)
+	}
+	errs := rows.buildIndexes(overlay, extraRows, positions, zone)
+	errs = append(errs, rows.checkOverlayUnique(overlay, extraRows, zone)...)
+	errs = append(errs, rows.buildSortedIndexes(overlay, extraRows, zone)...)
+	return overlay, errs
+}
+
+// locate 差异层第i条数据的位置，是多出来的行时返回它在Rows中的序号和true，否则返回基础数据中的行序号
+func (td *CsvOriginRowsData) locate(i int) (int, bool) {
+	own := sort.SearchInts(td.positions, i)
+	if own < len(td.positions) && td.positions[own] == i {
+		return own, true
+	}
+	// 前面有own个多出来的行，是基础数据中第i-own个没有去掉的行
+	j := i - own
+	return sort.Search(len(td.base.Rows), func(p int) bool {
+		return p+1-sort.SearchInts(td.removedRows, p+1) > j
+	}), false
+}
+
+// overlayRange 按文件中的顺序遍历差异层的所有行
+func (td *CsvOriginRowsData) overlayRange(f func(row interface{}, line int)) {
+	base := td.base
+	own, pos := 0, 0
+	for i, n := 0, td.NumRecord(); i < n; i++ {
+		if own < len(td.positions) && td.positions[own] == i {
+			f(td.Rows[own], td.Lines[own])
+			own++
+			continue
+		}
+		for td.removed[pos] {
+			pos++
+		}
+		f(base.Rows[pos], base.Lines[pos])
+		pos++
+	}
+}
+
+// checkOverlayUnique 差异层多出来的行和基础数据中本区服仍有的行不能有重复的唯一键
+func (rows *csvRowsData) checkOverlayUnique(overlay *CsvOriginRowsData, extraRows []*csvRowData, zone int) RowErrors {
+	var errs RowErrors
+	base := overlay.base
+	for _, v := range extraRows {
+		if rows.KeyIndexInfo.KeyIndexColInStruct >= 0 {
+			parsedKeyFieldValue, _ := v.getKeyColValue(rows.KeyIndexInfo.KeyIndexColInStruct)
+			if pos, find := base.KeyIndexData.KeyIndexMap[parsedKeyFieldValue]; find && !overlay.removed[pos] {
+				errs = append(errs, &RowError{
+					Line:   v.Line,
+					Column: v.colName(rows.KeyIndexInfo.KeyIndexColInStruct),
+					Value:  fmt.Sprint(parsedKeyFieldValue),
+					Reason: fmt.Sprintf("区服[%v]唯一索引出现重复值", zone),
+				})
+			}
+		}
+		for k, is := range rows.UnionUniqueIndexesInfo.UnionUniqueIndexColInStruct {
+			unionKey := v.getUnionKey(is)
+			if pos, find := base.UnionUniqueIndexData.UnionUniqueIndexMaps[k][unionKey]; find && !overlay.removed[pos] {
+				errs = append(errs, &RowError{
+					Line:   v.Line,
+					Column: k,
+					Value:  unionKey,
+					Reason: fmt.Sprintf("区服[%v]联合唯一索引出现重复值", zone),
+				})
+			}
+		}
+	}
+	return errs
+}
+
+// mergeBase 合并差异层和基础数据的组索引结果，按文件行号排列
+func (td *CsvOriginRowsData) mergeBase(own []int, inBase []int) []interface{} {
+	if len(own)+len(inBase) <= 0 {
+		return nil
+	}
+	base := td.base
+	ret := make([]interface{}, 0, len(own)+len(inBase))
+	i, j := 0, 0
+	for i < len(own) || j < len(inBase) {
+		if j < len(inBase) && td.removed[inBase[j]] {
+			j++
+			continue
+		}
+		if j >= len(inBase) || (i < len(own) && td.Lines[own[i]] < base.Lines[inBase[j]]) {
+			ret = append(ret, td.Rows[own[i]])
+			i++
+		} else {
+			ret = append(ret, base.Rows[inBase[j]])
+			j++
+		}
+	}
+	if len(ret) <= 0 {
+		return nil
+	}
+	return ret
+}
+
+// SharedWith 两个区服的数据是否共用同一份行数据和索引，或者一个是另一个的差异层
+func (td *CsvOriginRowsData) SharedWith(other *CsvOriginRowsData) bool {
+	if td == nil || other == nil || td.owner == nil || other.owner == nil {
+		return false
+	}
+	return td.owner == other.owner || td.base == other.owner || other.base == td.owner ||
+		(td.base != nil && td.base == other.base)
+}
+
+// MemoryStats 统计自己持有的行和索引条目，共用其他区服数据的视图都为0，差异层只统计差异部分
+func (td *CsvOriginRowsData) MemoryStats() RowsMemoryStats {
+	stats := RowsMemoryStats{
+		Shared:  td.owner != nil && td.owner != td,
+		Overlay: td.base != nil,
+	}
+	if td.base != nil {
+		stats.RemovedRows = len(td.removed)
+		stats.OverlayRows = len(td.Rows)
+	}
+	if stats.Shared {
+		return stats
+	}
+	stats.RowPointers = len(td.Rows) + len(td.removed)
+	stats.IndexEntries = len(td.KeyIndexData.KeyIndexMap)
+	for _, m := range td.GroupIndexData.GroupIndexMaps {
+		for _, list := range m {
+			stats.IndexEntries += len(list)
+		}
+	}
+	for _, m := range td.UnionGroupIndexData.UnionGroupIndexMaps {
+		for _, list := range m {
+			stats.IndexEntries += len(list)
+		}
+	}
+	for _, m := range td.UnionUniqueIndexData.UnionUniqueIndexMaps {
+		stats.IndexEntries += len(m)
+	}
+	for _, index := range td.SortedIndexData.SortedIndexMaps {
+		stats.IndexEntries += len(index.rows)
+	}
+	for _, index := range td.IntervalIndexData.IntervalIndexMaps {
+		stats.IndexEntries += len(index.rows)
+	}
+	return stats
+}
+
+// SameRows 两个区服共用同一份数据，行完全相同
+func (td *CsvOriginRowsData) SameRows(other *CsvOriginRowsData) bool {
+	return td != nil && other != nil && td.owner != nil && td.owner == other.owner
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type shareRow struct {
+	ID   int `csv:"id" index:"true"`
+	Kind int `csv:"kind" group:"true"`
+	Slot int `csv:"slot" unionu:"slot"`
+}
+
+func shareIDs(list []interface{}) []int {
+	ids := make([]int, 0, len(list))
+	for _, v := range list {
+		ids = append(ids, v.(*shareRow).ID)
+	}
+	return ids
+}
+
+func TestFilterZones(t *testing.T) {
+	fields := []string{"id", "kind", "slot", "zone_id"}
+	rows := [][]string{
+		{"1", "1", "1", ""},
+		{"2", "1", "2", ""},
+		{"3", "2", "3", "1,2,3"},
+		{"4", "1", "4", "4"},
+		{"5", "2", "5", "1,2,3,4"},
+		{"6", "1", "6", ""},
+		{"7", "2", "7", ""},
+		{"8", "1", "8", ""},
+		{"1", "2", "9", "6"},
+	}
+	csvRows, err := parseOriginFileData(fields, rows, reflect.TypeOf(shareRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zones := []int{1, 2, 3, 4, 5, 6}
+	list, errs := csvRows.FilterZones("1", zones)
+	for i, zone := range zones {
+		full, err := csvRows.FilterWithRegionZone("1", zone)
+		if zone == 6 {
+			if errs[i] == nil || err == nil || !strings.Contains(errs[i].Error(), "区服[6]") {
+				t.Fatalf("expect duplicate key error, got %v", errs[i])
+			}
+			continue
+		}
+		if errs[i] != nil || err != nil {
+			t.Fatalf("zone %v error %v %v", zone, errs[i], err)
+		}
+		if list[i].Zone != zone || list[i].NumRecord() != full.NumRecord() ||
+			!reflect.DeepEqual(list[i].Records(), full.Rows) {
+			t.Fatalf("zone %v rows not equal", zone)
+		}
+		for n := 0; n < full.NumRecord(); n++ {
+			if !reflect.DeepEqual(list[i].Record(n), full.Rows[n]) || list[i].Line(n) != full.Lines[n] {
+				t.Fatalf("zone %v record %v not equal", zone, n)
+			}
+		}
+	}
+
+	if !list[0].SameRows(list[1]) || !list[1].SameRows(list[2]) || list[0].SameRows(list[3]) {
+		t.Fatal("zones with same rows should share data")
+	}
+	if !list[3].SharedWith(list[0]) || !list[4].SharedWith(list[3]) {
+		t.Fatal("overlay should share base data")
+	}
+	if s := list[0].MemoryStats(); s.Shared || s.Overlay || s.RowPointers == 0 || s.IndexEntries == 0 {
+		t.Fatalf("unexpected base stats %+v", s)
+	}
+	if s := list[1].MemoryStats(); !s.Shared || s.RowPointers != 0 || s.IndexEntries != 0 {
+		t.Fatalf("unexpected shared stats %+v", s)
+	}
+	// 差异层只持有差异行
+	if s := list[3].MemoryStats(); !s.Overlay || s.OverlayRows != 1 || s.RemovedRows != 1 ||
+		s.RowPointers != s.OverlayRows+s.RemovedRows || len(list[3].Rows) != 1 {
+		t.Fatalf("unexpected overlay stats %+v", s)
+	}
+
+	overlay := list[3]
+	if overlay.Index(4) == nil || overlay.Index(3) != nil || overlay.Index(1) == nil || overlay.NumRecord() != 7 {
+		t.Fatal("unexpected overlay index")
+	}
+	if got := shareIDs(overlay.IndexGroup(0, 1)); !reflect.DeepEqual(got, []int{1, 2, 4, 6, 8}) {
+		t.Fatalf("unexpected overlay group %v", got)
+	}
+	if overlay.IndexUnionUnique("slot", 4) == nil || overlay.IndexUnionUnique("slot", 3) != nil {
+		t.Fatal("unexpected overlay union unique")
+	}
+	if got := shareIDs(list[4].IndexGroup(0, 2)); !reflect.DeepEqual(got, []int{7}) {
+		t.Fatalf("unexpected removed rows group %v", got)
+	}
+	if list[4].Index(5) != nil || list[4].IndexGroup(0, 3) != nil {
+		t.Fatal("removed rows should not be found")
+	}
+}
+
+func TestFilterZonesSorted(t *testing.T) {
+	fields := []string{"level", "exp", "start", "end", "rate", "zone_id"}
+	rows := [][]string{
+		{"1", "0", "0", "20", "0.1", ""},
+		{"2", "100", "30", "50", "0.2", ""},
+		{"3", "300", "10", "40", "0.3", "1,2,3"},
+		{"4", "300", "60", "70", "0.4", ""},
+		{"5", "100", "30", "45", "0.5", "4"},
+		{"6", "500", "80", "90", "0.6", ""},
+		{"7", "700", "60", "65", "0.7", ""},
+		{"8", "300", "15", "35", "0.8", ""},
+	}
+	csvRows, err := parseOriginFileData(fields, rows, reflect.TypeOf(sortedRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, errs := csvRows.FilterZones("1", []int{1, 2, 4})
+	if errs[2] != nil || !list[2].MemoryStats().Overlay {
+		t.Fatalf("zone 4 should be overlay %v", errs[2])
+	}
+	overlay := list[2]
+	full, err := csvRows.FilterWithRegionZone("1", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 差异层的查询结果和完整数据相同
+	for _, key := range []interface{}{-1, 0, 50, 100, 150, 300, 301, 500, 1000, "x"} {
+		if !reflect.DeepEqual(overlay.Floor("exp", key), full.Floor("exp", key)) {
+			t.Fatalf("floor %v", key)
+		}
+		if !reflect.DeepEqual(overlay.Ceil("exp", key), full.Ceil("exp", key)) {
+			t.Fatalf("ceil %v", key)
+		}
+		if !reflect.DeepEqual(overlay.RangeBetween("exp", key, 500), full.RangeBetween("exp", key, 500)) {
+			t.Fatalf("range %v", key)
+		}
+	}
+	for v := int64(-1); v <= 95; v += 5 {
+		if got, want := overlay.Containing("time", v), full.Containing("time", v); !reflect.DeepEqual(got, want) {
+			t.Fatalf("containing %v expect %v, got %v", v, want, got)
+		}
+	}
+	if overlay.Floor("rate", 0.35) == nil || overlay.Floor("rate", 0.35).(*sortedRow).Level != 2 {
+		t.Fatal("unexpected rate floor")
+	}
+}
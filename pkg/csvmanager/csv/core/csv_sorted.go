@@ -0,0 +1,424 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 有序索引和区间索引，加载时建好，查询为二分查找
+// 例如：
+//
+//	type Level struct {
+//	    Level int32 `csv:"level" index:"true"`
+//	    Exp   int64 `csv:"exp" sorted:"exp"`
+//	}
+//
+//	type Activity struct {
+//	    ID    int32 `csv:"id" index:"true"`
+//	    Start int64 `csv:"start" interval:"time"`
+//	    End   int64 `csv:"end" interval:"time"`
+//	}
+//
+// Floor("exp", 1500)取经验不超过1500的最大一行，Containing("time", now)取start<=now<end的所有行，
+// 区间索引的两个字段按结构体字段顺序，第一个为开始，第二个为结束
+
+// sortedIndex 有序索引，rows为行序号，按键从小到大排列，键相同的保持文件顺序
+type sortedIndex struct {
+	keys []interface{}
+	rows []int
+}
+
+// intervalIndex 区间索引，按开始值从小到大排列，maxEnds[i]为前i+1个区间结束值的最大值，用于提前结束查找
+type intervalIndex struct {
+	starts  []interface{}
+	ends    []interface{}
+	maxEnds []interface{}
+	rows    []int
+}
+
+// compareKey 比较两个normalizeKey转换过的键，整数和浮点数可以互相比较，类型不能比较返回false
+func compareKey(a, b interface{}) (int, bool) {
+	switch av := a.(type) {
+	case int64:
+		switch bv := b.(type) {
+		case int64:
+			return compareOrdered(av, bv), true
+		case float64:
+			return compareOrdered(float64(av), bv), true
+		}
+	case float64:
+		switch bv := b.(type) {
+		case int64:
+			return compareOrdered(av, float64(bv)), true
+		case float64:
+			return compareOrdered(av, bv), true
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), true
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | float64](a, b T) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// less 建索引时使用，键已经校验过类型
+func less(a, b interface{}) bool {
+	c, _ := compareKey(a, b)
+	return c < 0
+}
+
+func newSortedIndex(keys []interface{}) *sortedIndex {
+	index := &sortedIndex{keys: make([]interface{}, len(keys)), rows: make([]int, len(keys))}
+	for i := range keys {
+		index.rows[i] = i
+	}
+	sort.SliceStable(index.rows, func(i, j int) bool {
+		return less(keys[index.rows[i]], keys[index.rows[j]])
+	})
+	for i, row := range index.rows {
+		index.keys[i] = keys[row]
+	}
+	return index
+}
+
+// search 第一个键满足cmp(key)为true的位置，cmp需要单调
+func (index *sortedIndex) search(cmp func(c int) bool, key interface{}) (int, bool) {
+	if len(index.keys) > 0 {
+		if _, ok := compareKey(index.keys[0], key); !ok {
+			return 0, false
+		}
+	}
+	return sort.Search(len(index.keys), func(i int) bool {
+		c, _ := compareKey(index.keys[i], key)
+		return cmp(c)
+	}), true
+}
+
+func newIntervalIndex(starts []interface{}, ends []interface{}) *intervalIndex {
+	sorted := newSortedIndex(starts)
+	index := &intervalIndex{
+		starts:  sorted.keys,
+		ends:    make([]interface{}, len(ends)),
+		maxEnds: make([]interface{}, len(ends)),
+		rows:    sorted.rows,
+	}
+	for i, row := range sorted.rows {
+		index.ends[i] = ends[row]
+		index.maxEnds[i] = ends[row]
+		if i > 0 && less(ends[row], index.maxEnds[i-1]) {
+			index.maxEnds[i] = index.maxEnds[i-1]
+		}
+	}
+	return index
+}
+
+// checkSortedKind 有序索引、区间索引只支持数字和字符串
+func checkSortedKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// buildSortedIndexes 过滤完区服之后建有序索引和区间索引，区间开始大于结束的行报错
+func (rows *csvRowsData) buildSortedIndexes(parsedRowsData *CsvOriginRowsData, filtered []*csvRowData, zone int) RowErrors {
+	if len(rows.SortedIndexesInfo.SortedIndexColInStruct) > 0 {
+		parsedRowsData.SortedIndexData.HasSortedIndex = true
+		parsedRowsData.SortedIndexData.SortedIndexMaps = make(map[string]*sortedIndex)
+		for name, col := range rows.SortedIndexesInfo.SortedIndexColInStruct {
+			keys := make([]interface{}, len(filtered))
+			for i, v := range filtered {
+				keys[i], _ = v.getKeyColValue(col)
+			}
+			parsedRowsData.SortedIndexData.SortedIndexMaps[name] = newSortedIndex(keys)
+		}
+	}
+
+	var errs RowErrors
+	if len(rows.IntervalIndexesInfo.IntervalIndexColsInStruct) > 0 {
+		parsedRowsData.IntervalIndexData.HasIntervalIndex = true
+		parsedRowsData.IntervalIndexData.IntervalIndexMaps = make(map[string]*intervalIndex)
+		for name, cols := range rows.IntervalIndexesInfo.IntervalIndexColsInStruct {
+			starts := make([]interface{}, len(filtered))
+			ends := make([]interface{}, len(filtered))
+			for i, v := range filtered {
+				starts[i], _ = v.getKeyColValue(cols[0])
+				ends[i], _ = v.getKeyColValue(cols[1])
+				if less(ends[i], starts[i]) {
+					errs = append(errs, &RowError{
+						Line:   v.Line,
+						Column: v.colName(cols[1]),
+						Value:  fmt.Sprint(ends[i]),
+						Reason: fmt.Sprintf("区服[%v]区间索引[%v]结束值小于开始值[%v]", zone, name, starts[i]),
+					})
+				}
+			}
+			parsedRowsData.IntervalIndexData.IntervalIndexMaps[name] = newIntervalIndex(starts, ends)
+		}
+	}
+	return errs
+}
+
+// Floor 有序索引中键小于等于key的最大一行，键相同时取文件中最后一行，找不到返回nil
+func (td *CsvOriginRowsData) Floor(name string, key interface{}) interface{} {
+	index, indexKey, ok := td.sortedIndex(name, key)
+	if !ok {
+		return nil
+	}
+	i, ok := index.search(func(c int) bool { return c > 0 }, indexKey)
+	if !ok {
+		return nil
+	}
+	if td.base != nil {
+		return td.overlayFloor(name, index, i, indexKey)
+	}
+	if i <= 0 {
+		return nil
+	}
+	return td.Rows[index.rows[i-1]]
+}
+
+// Ceil 有序索引中键大于等于key的最小一行，键相同时取文件中第一行，找不到返回nil
+func (td *CsvOriginRowsData) Ceil(name string, key interface{}) interface{} {
+	index, indexKey, ok := td.sortedIndex(name, key)
+	if !ok {
+		return nil
+	}
+	i, ok := index.search(func(c int) bool { return c >= 0 }, indexKey)
+	if !ok {
+		return nil
+	}
+	if td.base != nil {
+		return td.overlayCeil(name, index, i, indexKey)
+	}
+	if i >= len(index.rows) {
+		return nil
+	}
+	return td.Rows[index.rows[i]]
+}
+
+// RangeBetween 有序索引中键在[lo, hi]之间的所有行，按键从小到大排列
+func (td *CsvOriginRowsData) RangeBetween(name string, lo interface{}, hi interface{}) []interface{} {
+	index, loKey, ok := td.sortedIndex(name, lo)
+	if !ok {
+		return nil
+	}
+	hiKey, ok := normalizeKey(hi)
+	if !ok {
+		return nil
+	}
+	if td.base != nil {
+		base := td.base.SortedIndexData.SortedIndexMaps[name]
+		return mergeHits(sortedHits(index, loKey, hiKey, td, nil), sortedHits(base, loKey, hiKey, td.base, td.removed))
+	}
+	begin, end, ok := index.between(loKey, hiKey)
+	if !ok || begin >= end {
+		return nil
+	}
+	ret := make([]interface{}, 0, end-begin)
+	for _, row := range index.rows[begin:end] {
+		ret = append(ret, td.Rows[row])
+	}
+	return ret
+}
+
+// between 键在[lo, hi]之间的行在索引中的范围
+func (index *sortedIndex) between(lo interface{}, hi interface{}) (int, int, bool) {
+	begin, ok := index.search(func(c int) bool { return c >= 0 }, lo)
+	if !ok {
+		return 0, 0, false
+	}
+	end, ok := index.search(func(c int) bool { return c > 0 }, hi)
+	return begin, end, ok
+}
+
+// Containing 区间索引中满足开始<=key<结束的所有行，按开始值从小到大排列
+func (td *CsvOriginRowsData) Containing(name string, key interface{}) []interface{} {
+	index, find := td.IntervalIndexData.IntervalIndexMaps[name]
+	if !find {
+		return nil
+	}
+	indexKey, ok := normalizeKey(key)
+	if !ok {
+		return nil
+	}
+	if td.base != nil {
+		base := td.base.IntervalIndexData.IntervalIndexMaps[name]
+		return mergeHits(intervalHits(index, indexKey, td, nil), intervalHits(base, indexKey, td.base, td.removed))
+	}
+	found := index.containing(indexKey)
+	if len(found) <= 0 {
+		return nil
+	}
+	ret := make([]interface{}, 0, len(found))
+	for _, i := range found {
+		ret = append(ret, td.Rows[index.rows[i]])
+	}
+	return ret
+}
+
+// containing 满足开始<=key<结束的区间在索引中的位置，从小到大排列
+func (index *intervalIndex) containing(key interface{}) []int {
+	if len(index.rows) <= 0 {
+		return nil
+	}
+	if _, ok := compareKey(index.starts[0], key); !ok {
+		return nil
+	}
+	// 开始值<=key的区间都在upper之前，从后往前找，之前所有区间的结束值都<=key时停止
+	upper := sort.Search(len(index.starts), func(i int) bool {
+		c, _ := compareKey(index.starts[i], key)
+		return c > 0
+	})
+	var ret []int
+	for i := upper - 1; i >= 0; i-- {
+		if c, _ := compareKey(index.maxEnds[i], key); c <= 0 {
+			break
+		}
+		if c, _ := compareKey(index.ends[i], key); c > 0 {
+			ret = append(ret, i)
+		}
+	}
+	for i, j := 0, len(ret)-1; i < j; i, j = i+1, j-1 {
+		ret[i], ret[j] = ret[j], ret[i]
+	}
+	return ret
+}
+
+func (td *CsvOriginRowsData) sortedIndex(name string, key interface{}) (*sortedIndex, interface{}, bool) {
+	index, find := td.SortedIndexData.SortedIndexMaps[name]
+	if !find {
+		return nil, nil, false
+	}
+	indexKey, ok := normalizeKey(key)
+	if !ok {
+		return nil, nil, false
+	}
+	return index, indexKey, true
+}
+
+// sortedHit 差异层查询时自己或基础数据中查到的一行，按键和文件中的行号排序
+type sortedHit struct {
+	key  interface{}
+	line int
+	row  interface{}
+}
+
+func hitLess(a, b *sortedHit) bool {
+	if c, _ := compareKey(a.key, b.key); c != 0 {
+		return c < 0
+	}
+	return a.line < b.line
+}
+
+// mergeHits 合并两个有序的查询结果
+func mergeHits(a, b []*sortedHit) []interface{} {
+	if len(a)+len(b) <= 0 {
+		return nil
+	}
+	ret := make([]interface{}, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		if len(b) <= 0 || (len(a) > 0 && hitLess(a[0], b[0])) {
+			ret = append(ret, a[0].row)
+			a = a[1:]
+		} else {
+			ret = append(ret, b[0].row)
+			b = b[1:]
+		}
+	}
+	return ret
+}
+
+// sortedHits 有序索引中键在[lo, hi]之间的行，跳过removed中的行
+func sortedHits(index *sortedIndex, lo interface{}, hi interface{}, data *CsvOriginRowsData,
+	removed map[int]bool) []*sortedHit {
+	begin, end, ok := index.between(lo, hi)
+	if !ok {
+		return nil
+	}
+	var hits []*sortedHit
+	for i := begin; i < end; i++ {
+		if row := index.rows[i]; !removed[row] {
+			hits = append(hits, &sortedHit{key: index.keys[i], line: data.Lines[row], row: data.Rows[row]})
+		}
+	}
+	return hits
+}
+
+// intervalHits 区间索引中包含key的行，跳过removed中的行
+func intervalHits(index *intervalIndex, key interface{}, data *CsvOriginRowsData,
+	removed map[int]bool) []*sortedHit {
+	var hits []*sortedHit
+	for _, i := range index.containing(key) {
+		if row := index.rows[i]; !removed[row] {
+			hits = append(hits, &sortedHit{key: index.starts[i], line: data.Lines[row], row: data.Rows[row]})
+		}
+	}
+	return hits
+}
+
+// overlayFloor 差异层的Floor，i为自己的索引中第一个键大于key的位置
+func (td *CsvOriginRowsData) overlayFloor(name string, index *sortedIndex, i int, key interface{}) interface{} {
+	var own, inBase *sortedHit
+	if i > 0 {
+		row := index.rows[i-1]
+		own = &sortedHit{key: index.keys[i-1], line: td.Lines[row], row: td.Rows[row]}
+	}
+	base := td.base.SortedIndexData.SortedIndexMaps[name]
+	if j, ok := base.search(func(c int) bool { return c > 0 }, key); ok {
+		for j--; j >= 0 && td.removed[base.rows[j]]; j-- {
+		}
+		if j >= 0 {
+			row := base.rows[j]
+			inBase = &sortedHit{key: base.keys[j], line: td.base.Lines[row], row: td.base.Rows[row]}
+		}
+	}
+	switch {
+	case own == nil && inBase == nil:
+		return nil
+	case inBase == nil || (own != nil && hitLess(inBase, own)):
+		return own.row
+	}
+	return inBase.row
+}
+
+// overlayCeil 差异层的Ceil，i为自己的索引中第一个键大于等于key的位置
+func (td *CsvOriginRowsData) overlayCeil(name string, index *sortedIndex, i int, key interface{}) interface{} {
+	var own, inBase *sortedHit
+	if i < len(index.rows) {
+		row := index.rows[i]
+		own = &sortedHit{key: index.keys[i], line: td.Lines[row], row: td.Rows[row]}
+	}
+	base := td.base.SortedIndexData.SortedIndexMaps[name]
+	if j, ok := base.search(func(c int) bool { return c >= 0 }, key); ok {
+		for ; j < len(base.rows) && td.removed[base.rows[j]]; j++ {
+		}
+		if j < len(base.rows) {
+			row := base.rows[j]
+			inBase = &sortedHit{key: base.keys[j], line: td.base.Lines[row], row: td.base.Rows[row]}
+		}
+	}
+	switch {
+	case own == nil && inBase == nil:
+		return nil
+	case inBase == nil || (own != nil && hitLess(own, inBase)):
+		return own.row
+	}
+	return inBase.row
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"reflect"
 )
 
@@ -8,6 +9,35 @@ type templateTypeRecord struct {
 	to reflect.Type
 }
 
+// getFieldColsInFile 结构体每个字段对应文件中的列序号，不需要读取的字段为-1，
+// 结构体字段在文件中找不到时返回所有找不到的字段
+func (r *templateTypeRecord) getFieldColsInFile(fieldsNameRowInFile []string) ([]int, error) {
+	cols := make([]int, r.to.NumField())
+	missing := make([]string, 0)
+	for i := 0; i < r.to.NumField(); i++ {
+		cols[i] = -1
+		f := r.to.Field(i)
+		fieldTagName := f.Tag.Get("csv")
+		if fieldTagName == "" || fieldTagName == "_" {
+			continue
+		}
+		for iInFile, fieldNameInFile := range fieldsNameRowInFile {
+			if fieldTagName == fieldNameInFile {
+				// 结构体字段在文件也定义了
+				cols[i] = iInFile
+				break
+			}
+		}
+		if cols[i] < 0 {
+			missing = append(missing, fmt.Sprintf("%v,%s", f.Name, f.Tag))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("代码和配置表不匹配，表结构体字段%v没有在配置表找到:%+v", missing, fieldsNameRowInFile)
+	}
+	return cols, nil
+}
+
 func (r *templateTypeRecord) getKeyColIndex() int {
 	for i := 0; i < r.to.NumField(); i++ {
 		field := r.to.Field(i)
@@ -64,3 +94,42 @@ func (r *templateTypeRecord) getUnionUniqueGroupKeyColsIndex() (cols map[string]
 	}
 	return
 }
+
+// getSortedColsIndex 有序索引和区间索引字段，有序索引一个名字一个字段，区间索引一个名字两个字段
+func (r *templateTypeRecord) getSortedColsIndex() (sorted map[string]int, interval map[string][2]int, err error) {
+	sorted = make(map[string]int)
+	intervalCols := make(map[string][]int)
+	names := make([]string, 0)
+	for i := 0; i < r.to.NumField(); i++ {
+		field := r.to.Field(i)
+		sortedTag := field.Tag.Get("sorted")
+		intervalTag := field.Tag.Get("interval")
+		if (sortedTag != "" || intervalTag != "") && !checkSortedKind(field.Type.Kind()) {
+			return nil, nil, fmt.Errorf("字段[%v]类型[%v]不能作为有序索引或区间索引", field.Name, field.Type)
+		}
+		if sortedTag != "" {
+			if _, find := sorted[sortedTag]; find {
+				return nil, nil, fmt.Errorf("有序索引[%v]重复", sortedTag)
+			}
+			sorted[sortedTag] = i
+		}
+		if intervalTag != "" {
+			if _, find := intervalCols[intervalTag]; !find {
+				names = append(names, intervalTag)
+			}
+			intervalCols[intervalTag] = append(intervalCols[intervalTag], i)
+		}
+	}
+	interval = make(map[string][2]int)
+	for _, name := range names {
+		cols := intervalCols[name]
+		if len(cols) != 2 {
+			return nil, nil, fmt.Errorf("区间索引[%v]需要开始和结束两个字段", name)
+		}
+		if (r.to.Field(cols[0]).Type.Kind() == reflect.String) != (r.to.Field(cols[1]).Type.Kind() == reflect.String) {
+			return nil, nil, fmt.Errorf("区间索引[%v]开始和结束字段类型不能比较", name)
+		}
+		interval[name] = [2]int{cols[0], cols[1]}
+	}
+	return sorted, interval, nil
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"joynova.com/library/supernova/pkg/csvmanager/utils"
+)
+
+var Comma rune = '\t'
+var Comment = '#'
+
+// SourceData 数据源读取出的原始表格，所有格式都转换为字段名和字符串单元格，再走同样的解析、过滤、索引流程
+type SourceData struct {
+	FieldTypes []string   // 字段类型行，没有可以为空
+	FieldNames []string   // 字段名行
+	Rows       [][]string // 数据行，每行单元格数量和字段名一致
+	Lines      []int      // 每行数据在源文件中的行号，用于报错定位，可以为空
+}
+
+// SourceLoader 配置表数据源读取器
+type SourceLoader interface {
+	Load(fileName string) (*SourceData, error)
+}
+
+var sourceLoaders = struct {
+	sync.RWMutex
+	m map[string]SourceLoader
+}{m: map[string]SourceLoader{}}
+
+// RegisterSourceLoader 注册扩展名对应的读取器，扩展名带点，不区分大小写，例如".xlsx"
+func RegisterSourceLoader(ext string, loader SourceLoader) {
+	sourceLoaders.Lock()
+	defer sourceLoaders.Unlock()
+	sourceLoaders.m[strings.ToLower(ext)] = loader
+}
+
+// GetSourceLoader 按文件扩展名查找读取器，没有注册的扩展名按tab分隔的csv读取
+func GetSourceLoader(fileName string) SourceLoader {
+	sourceLoaders.RLock()
+	defer sourceLoaders.RUnlock()
+	loader, find := sourceLoaders.m[strings.ToLower(filepath.Ext(fileName))]
+	if find {
+		return loader
+	}
+	return &CsvLoader{}
+}
+
+func init() {
+	RegisterSourceLoader(".xlsx", &XlsxLoader{})
+	RegisterSourceLoader(".json", &JSONLoader{})
+	RegisterSourceLoader(".yaml", &YAMLLoader{})
+	RegisterSourceLoader(".yml", &YAMLLoader{})
+}
+
+// CsvLoader 分隔符文本读取器，第一行为字段类型，第二行为字段名，之后为数据
+type CsvLoader struct {
+	Comma   rune // 分隔符，默认为Comma
+	Comment rune // 注释符，默认为Comment
+}
+
+func (l *CsvLoader) Load(fileName string) (*SourceData, error) {
+	file, err := utils.OpenFileFunc(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件[%v]错误:%v", fileName, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = Comma
+	reader.Comment = Comment
+	if l.Comma != 0 {
+		reader.Comma = l.Comma
+	}
+	if l.Comment != 0 {
+		reader.Comment = l.Comment
+	}
+
+	data := &SourceData{}
+	data.FieldTypes, err = reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取文件[%v]字段类型行错误:%v", fileName, err)
+	}
+
+	data.FieldNames, err = reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取文件[%v]字段名行错误:%v", fileName, err)
+	}
+
+	for {
+		dataRow, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取文件[%v]所有数据行错误:%v", fileName, err)
+		}
+		line, _ := reader.FieldPos(0)
+		data.Rows = append(data.Rows, dataRow)
+		data.Lines = append(data.Lines, line)
+	}
+	return data, nil
+}
+
+// readSourceFile 通过OpenFileFunc读取整个文件
+func readSourceFile(fileName string) ([]byte, error) {
+	file, err := utils.OpenFileFunc(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件[%v]错误:%v", fileName, err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件[%v]错误:%v", fileName, err)
+	}
+	return content, nil
+}
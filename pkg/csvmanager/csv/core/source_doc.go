@@ -0,0 +1,231 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JSONLoader 读取对象数组格式的json，对象的键为字段名，字段名按第一次出现的顺序排列，
+// 数组值用逗号拼接，和csv单元格内的切片格式一致，对象值保留为json字符串交给Parser解析
+type JSONLoader struct{}
+
+// YAMLLoader 读取映射列表格式的yaml，规则同JSONLoader
+type YAMLLoader struct{}
+
+type docRecord struct {
+	line   int
+	values map[string]string
+}
+
+type docTable struct {
+	fields   []string
+	fieldSet map[string]bool
+	records  []*docRecord
+}
+
+func (t *docTable) add(key string, value string, record *docRecord) {
+	if t.fieldSet == nil {
+		t.fieldSet = make(map[string]bool)
+	}
+	if !t.fieldSet[key] {
+		t.fieldSet[key] = true
+		t.fields = append(t.fields, key)
+	}
+	record.values[key] = value
+}
+
+func (t *docTable) sourceData() *SourceData {
+	data := &SourceData{FieldNames: t.fields}
+	for _, r := range t.records {
+		row := make([]string, len(t.fields))
+		for i, f := range t.fields {
+			row[i] = r.values[f]
+		}
+		data.Rows = append(data.Rows, row)
+		data.Lines = append(data.Lines, r.line)
+	}
+	return data
+}
+
+func (l *JSONLoader) Load(fileName string) (*SourceData, error) {
+	content, err := readSourceFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &docTable{}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, fmt.Errorf("文件[%v]必须是对象数组:%v", fileName, err)
+	}
+	for dec.More() {
+		line := lineAt(content, int(dec.InputOffset()))
+		if err := expectDelim(dec, '{'); err != nil {
+			return nil, fmt.Errorf("文件[%v]第[%v]行必须是对象:%v", fileName, line, err)
+		}
+		record := &docRecord{line: line, values: make(map[string]string)}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, fmt.Errorf("文件[%v]第[%v]行读取字段名错误:%v", fileName, line, err)
+			}
+			key, _ := tok.(string)
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, fmt.Errorf("文件[%v]第[%v]行读取字段[%v]错误:%v", fileName, line, key, err)
+			}
+			value, err := jsonCell(raw, true)
+			if err != nil {
+				return nil, fmt.Errorf("文件[%v]第[%v]行字段[%v]:%v", fileName, line, key, err)
+			}
+			table.add(key, value, record)
+		}
+		if err := expectDelim(dec, '}'); err != nil {
+			return nil, fmt.Errorf("文件[%v]第[%v]行对象格式错误:%v", fileName, line, err)
+		}
+		table.records = append(table.records, record)
+	}
+	if err := expectDelim(dec, ']'); err != nil {
+		return nil, fmt.Errorf("文件[%v]数组格式错误:%v", fileName, err)
+	}
+	return table.sourceData(), nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("期望[%v]，读到[%v]", delim, tok)
+	}
+	return nil
+}
+
+// jsonCell json值转为单元格字符串，allowArray为false时不允许嵌套数组
+func jsonCell(raw json.RawMessage, allowArray bool) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	switch raw[0] {
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case '[':
+		if !allowArray {
+			return "", fmt.Errorf("不支持嵌套数组")
+		}
+		var list []json.RawMessage
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return "", err
+		}
+		values := make([]string, 0, len(list))
+		for _, v := range list {
+			s, err := jsonCell(v, false)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, s)
+		}
+		return strings.Join(values, ","), nil
+	case '{':
+		buf := new(bytes.Buffer)
+		if err := json.Compact(buf, raw); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	// 数字、布尔保留原文
+	return string(raw), nil
+}
+
+// lineAt 偏移位置之后第一个非空白字符所在的行号
+func lineAt(content []byte, offset int) int {
+	for offset < len(content) {
+		c := content[offset]
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' && c != ',' {
+			break
+		}
+		offset++
+	}
+	return bytes.Count(content[:offset], []byte("\n")) + 1
+}
+
+func (l *YAMLLoader) Load(fileName string) (*SourceData, error) {
+	content, err := readSourceFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("解析文件[%v]错误:%v", fileName, err)
+	}
+	table := &docTable{}
+	if len(doc.Content) == 0 {
+		return table.sourceData(), nil
+	}
+	list := doc.Content[0]
+	if list.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("文件[%v]必须是映射列表", fileName)
+	}
+	for _, item := range list.Content {
+		if item.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("文件[%v]第[%v]行必须是映射", fileName, item.Line)
+		}
+		record := &docRecord{line: item.Line, values: make(map[string]string)}
+		for i := 0; i+1 < len(item.Content); i += 2 {
+			key := item.Content[i].Value
+			value, err := yamlCell(item.Content[i+1], true)
+			if err != nil {
+				return nil, fmt.Errorf("文件[%v]第[%v]行字段[%v]:%v", fileName, item.Content[i+1].Line, key, err)
+			}
+			table.add(key, value, record)
+		}
+		table.records = append(table.records, record)
+	}
+	return table.sourceData(), nil
+}
+
+func yamlCell(node *yaml.Node, allowArray bool) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return "", nil
+		}
+		return node.Value, nil
+	case yaml.AliasNode:
+		return yamlCell(node.Alias, allowArray)
+	case yaml.SequenceNode:
+		if !allowArray {
+			return "", fmt.Errorf("不支持嵌套列表")
+		}
+		values := make([]string, 0, len(node.Content))
+		for _, v := range node.Content {
+			s, err := yamlCell(v, false)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, s)
+		}
+		return strings.Join(values, ","), nil
+	case yaml.MappingNode:
+		// 映射转为json字符串，和JSONLoader一致
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", fmt.Errorf("不支持的yaml节点类型[%v]", node.Kind)
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type sourceRow struct {
+	ID    int32   `csv:"id" index:"true"`
+	Name  string  `csv:"name"`
+	Items []int32 `csv:"items"`
+}
+
+func checkSourceRows(t *testing.T, file string, lines []int) {
+	rows, err := ReadCsv(file, reflect.TypeOf(sourceRow{}))
+	if err != nil {
+		t.Fatalf("read %v error:%v", file, err)
+	}
+	table, err := rows.FilterWithRegionZone("1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.NumRecord() != len(lines) {
+		t.Fatalf("%v expect %v rows, got %v", file, len(lines), table.NumRecord())
+	}
+	for i, line := range lines {
+		if table.Line(i) != line {
+			t.Fatalf("%v row %v expect line %v, got %v", file, i, line, table.Line(i))
+		}
+	}
+	row, ok := table.Index(int32(2)).(*sourceRow)
+	if !ok || row.Name != "b" || !reflect.DeepEqual(row.Items, []int32{3, 4}) {
+		t.Fatalf("%v unexpected row %+v", file, row)
+	}
+}
+
+func TestJSONSource(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "item.json")
+	content := `[
+  {"id": 1, "name": "a", "items": [1]},
+  {"id": 2, "name": "b", "items": [3, 4]}
+]`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkSourceRows(t, file, []int{2, 3})
+}
+
+func TestYAMLSource(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "item.yaml")
+	content := `- id: 1
+  name: a
+  items: [1]
+- id: 2
+  name: b
+  items:
+    - 3
+    - 4
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkSourceRows(t, file, []int{1, 4})
+}
+
+func TestXlsxSource(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "item.xlsx")
+	fd, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(fd)
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="note" sheetId="1" r:id="rId1"/><sheet name="item" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Target="worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>id</t></si><si><t>name</t></si><si><r><t>it</t></r><r><t>ems</t></r></si>` +
+			`<si><t>b</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData>` +
+			`<row r="1"><c r="A1" t="inlineStr"><is><t>int</t></is></c><c r="B1" t="inlineStr"><is><t>string</t></is></c>` +
+			`<c r="C1" t="inlineStr"><is><t>[]int</t></is></c></row>` +
+			`<row r="2"><c r="A2" t="s"><v>0</v></c><c r="B2" t="s"><v>1</v></c><c r="C2" t="s"><v>2</v></c></row>` +
+			`<row r="3"><c r="A3"><v>1</v></c><c r="B3" t="str"><v>a</v></c><c r="C3"><v>1</v></c></row>` +
+			`<row r="5"><c r="A5" t="inlineStr"><is><t>#comment</t></is></c></row>` +
+			`<row r="6"><c r="A6"><v>2</v></c><c r="B6" t="s"><v>3</v></c><c r="C6" t="inlineStr"><is><t>3,4</t></is></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	for name, content := range parts {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	w.Close()
+	fd.Close()
+
+	_, err = ReadCsv(file, reflect.TypeOf(sourceRow{}))
+	if err == nil {
+		t.Fatal("first sheet is empty, expect error")
+	}
+	RegisterSourceLoader(".xlsx", &XlsxLoader{Sheet: "item"})
+	defer RegisterSourceLoader(".xlsx", &XlsxLoader{})
+	checkSourceRows(t, file, []int{3, 6})
+}
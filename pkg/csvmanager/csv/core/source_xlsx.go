@@ -0,0 +1,285 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// XlsxLoader 读取Excel的xlsx文件，只读取单元格的值，公式读取文件中缓存的计算结果，
+// 空行和首个单元格以注释符开头的行忽略
+type XlsxLoader struct {
+	Sheet   string // 工作表名，默认第一个工作表
+	TypeRow int    // 字段类型行号，从1开始，默认1，小于0表示没有类型行
+	NameRow int    // 字段名行号，从1开始，默认2，数据从类型行和字段名行之后开始
+}
+
+const xlsxRelNamespace = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t *xlsxText) String() string {
+	if len(t.R) == 0 {
+		return t.T
+	}
+	s := t.T
+	for _, r := range t.R {
+		s += r.T
+	}
+	return s
+}
+
+type xlsxSharedStrings struct {
+	SI []xlsxText `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R  string   `xml:"r,attr"`
+			T  string   `xml:"t,attr"`
+			V  string   `xml:"v"`
+			IS xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func (l *XlsxLoader) Load(fileName string) (*SourceData, error) {
+	content, err := readSourceFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	grid, err := l.readSheet(content)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件[%v]错误:%v", fileName, err)
+	}
+
+	typeRow, nameRow := l.TypeRow, l.NameRow
+	if typeRow == 0 {
+		typeRow = 1
+	}
+	if nameRow <= 0 {
+		nameRow = 2
+	}
+	dataStart := nameRow
+	if typeRow > dataStart {
+		dataStart = typeRow
+	}
+
+	data := &SourceData{}
+	data.FieldNames = grid[nameRow]
+	if data.FieldNames == nil {
+		return nil, fmt.Errorf("文件[%v]第[%v]行字段名行为空", fileName, nameRow)
+	}
+	// 去掉表头末尾的空列
+	width := len(data.FieldNames)
+	for width > 0 && data.FieldNames[width-1] == "" {
+		width--
+	}
+	data.FieldNames = data.FieldNames[:width]
+	if typeRow > 0 {
+		data.FieldTypes = fitRow(grid[typeRow], width)
+	}
+
+	lines := make([]int, 0, len(grid))
+	for line := range grid {
+		if line > dataStart {
+			lines = append(lines, line)
+		}
+	}
+	sort.Ints(lines)
+	for _, line := range lines {
+		row := grid[line]
+		if isEmptyRow(row) || (len(row) > 0 && strings.HasPrefix(row[0], string(Comment))) {
+			continue
+		}
+		data.Rows = append(data.Rows, fitRow(row, width))
+		data.Lines = append(data.Lines, line)
+	}
+	return data, nil
+}
+
+// readSheet 读取工作表所有单元格，返回行号到单元格的映射
+func (l *XlsxLoader) readSheet(content []byte) (map[int][]string, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(reader.File))
+	for _, f := range reader.File {
+		files[f.Name] = f
+	}
+
+	var workbook xlsxWorkbook
+	if err := decodeZipXML(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := decodeZipXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("没有工作表")
+	}
+	sheet := workbook.Sheets[0]
+	if l.Sheet != "" {
+		found := false
+		for _, s := range workbook.Sheets {
+			if s.Name == l.Sheet {
+				sheet, found = s, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("没有工作表[%v]", l.Sheet)
+		}
+	}
+	sheetFile := ""
+	for _, r := range rels.Relationships {
+		if r.ID == sheet.RID {
+			sheetFile = r.Target
+			break
+		}
+	}
+	if strings.HasPrefix(sheetFile, "/") {
+		sheetFile = strings.TrimPrefix(sheetFile, "/")
+	} else {
+		sheetFile = path.Join("xl", sheetFile)
+	}
+
+	var shared xlsxSharedStrings
+	if _, find := files["xl/sharedStrings.xml"]; find {
+		if err := decodeZipXML(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+	var ws xlsxSheet
+	if err := decodeZipXML(files, sheetFile, &ws); err != nil {
+		return nil, err
+	}
+
+	grid := make(map[int][]string, len(ws.Rows))
+	lastRow := 0
+	for _, row := range ws.Rows {
+		line := row.R
+		if line <= 0 {
+			line = lastRow + 1
+		}
+		lastRow = line
+		cells := make([]string, 0, len(row.Cells))
+		for _, c := range row.Cells {
+			col := len(cells)
+			if c.R != "" {
+				col, err = xlsxColumn(c.R)
+				if err != nil {
+					return nil, err
+				}
+			}
+			value := c.V
+			switch c.T {
+			case "s":
+				i, err := strconv.Atoi(c.V)
+				if err != nil || i < 0 || i >= len(shared.SI) {
+					return nil, fmt.Errorf("单元格[%v]共享字符串序号[%v]错误", c.R, c.V)
+				}
+				value = shared.SI[i].String()
+			case "inlineStr":
+				value = c.IS.String()
+			case "b":
+				value = strconv.FormatBool(c.V == "1")
+			}
+			for len(cells) < col {
+				cells = append(cells, "")
+			}
+			if col < len(cells) {
+				cells[col] = value
+			} else {
+				cells = append(cells, value)
+			}
+		}
+		grid[line] = cells
+	}
+	return grid, nil
+}
+
+func decodeZipXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, find := files[name]
+	if !find {
+		return fmt.Errorf("缺少[%v]", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("解析[%v]错误:%v", name, err)
+	}
+	return nil
+}
+
+// xlsxColumn 单元格引用转为列序号，"B3" -> 1
+func xlsxColumn(ref string) (int, error) {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			col = col*26 + int(r-'A'+1)
+			n++
+		} else if r >= 'a' && r <= 'z' {
+			col = col*26 + int(r-'a'+1)
+			n++
+		} else {
+			break
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("单元格引用[%v]错误", ref)
+	}
+	return col - 1, nil
+}
+
+func fitRow(row []string, width int) []string {
+	fitted := make([]string, width)
+	copy(fitted, row)
+	return fitted
+}
+
+func isEmptyRow(row []string) bool {
+	for _, v := range row {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
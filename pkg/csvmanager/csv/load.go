@@ -1,6 +1,7 @@
 package csv
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 	"reflect"
@@ -8,37 +9,114 @@ import (
 	"joynova.com/library/supernova/pkg/csvmanager/csv/core"
 )
 
+// ReadCsv 读取csv文件按区服过滤，tableCheckFun为表级校验函数，每个区服的数据过滤之后调用，
+// 返回的错误为RowErrors时包含所有行的错误
 func ReadCsv(region string, zones []int, file string, templateTypeRecord interface{},
-	extraLoadFun func([]interface{}) (interface{}, error)) ([]*CsvTable, error) {
-	csvOriginData, err := core.ReadCsv(file, reflect.TypeOf(templateTypeRecord))
+	extraLoadFun func([]interface{}) (interface{}, error), tableCheckFun func([]interface{}) error) ([]*CsvTable, error) {
+	return ReadSource(region, zones, file, nil, templateTypeRecord, extraLoadFun, tableCheckFun)
+}
+
+// ReadSource 和ReadCsv相同，loader指定文件格式，为nil时按扩展名选择，见core.RegisterSourceLoader
+func ReadSource(region string, zones []int, file string, loader core.SourceLoader, templateTypeRecord interface{},
+	extraLoadFun func([]interface{}) (interface{}, error), tableCheckFun func([]interface{}) error) ([]*CsvTable, error) {
+	csvOriginData, err := core.ReadSource(file, loader, reflect.TypeOf(templateTypeRecord))
+	if err != nil {
+		return nil, err
+	}
+	return filterZones(region, zones, file, csvOriginData, extraLoadFun, tableCheckFun)
+}
+
+// CompileSource 读取文件并编码为预编译快照的行数据，见core.EncodeRows
+func CompileSource(file string, loader SourceLoader, templateTypeRecord interface{}) ([]byte, error) {
+	csvOriginData, err := core.ReadSource(file, loader, reflect.TypeOf(templateTypeRecord))
+	if err != nil {
+		return nil, err
+	}
+	return core.EncodeRows(csvOriginData)
+}
+
+// ReadCompiled 和ReadSource相同，行数据从CompileSource生成的数据解码，file只用于报错和表信息
+func ReadCompiled(region string, zones []int, file string, data []byte, templateTypeRecord interface{},
+	extraLoadFun func([]interface{}) (interface{}, error), tableCheckFun func([]interface{}) error) ([]*CsvTable, error) {
+	csvOriginData, err := core.DecodeRows(data, reflect.TypeOf(templateTypeRecord))
 	if err != nil {
 		return nil, err
 	}
+	return filterZones(region, zones, file, csvOriginData, extraLoadFun, tableCheckFun)
+}
+
+// TypeSignature 表结构体的类型签名
+func TypeSignature(templateTypeRecord interface{}) string {
+	return core.TypeSignature(reflect.TypeOf(templateTypeRecord))
+}
 
+type zoneFilter interface {
+	FilterZones(region string, zones []int) ([]*core.CsvOriginRowsData, []error)
+}
+
+// filterZones 原始行数据按区服过滤，生成每个区服的表，行相同的区服共用数据，表校验只做一次
+func filterZones(region string, zones []int, file string, csvOriginData zoneFilter,
+	extraLoadFun func([]interface{}) (interface{}, error), tableCheckFun func([]interface{}) error) ([]*CsvTable, error) {
+	fileName := filepath.Base(file)
 	list := make([]*CsvTable, 0, len(zones))
-	for _, zone := range zones {
-		csvOriginParsedData, err := csvOriginData.FilterWithRegionZone(region, zone)
-		if err != nil {
-			return nil, err
+	var errs RowErrors
+	parsedList, filterErrs := csvOriginData.FilterZones(region, zones)
+	var checked []*core.CsvOriginRowsData
+	for i, zone := range zones {
+		if filterErrs[i] != nil {
+			errs = AppendRowErrors(errs, fileName, filterErrs[i])
+			continue
+		}
+		csvOriginParsedData := parsedList[i]
+
+		if tableCheckFun != nil && !sharedChecked(checked, csvOriginParsedData) {
+			if err := tableCheckFun(csvOriginParsedData.Records()); err != nil {
+				errs = AppendRowErrors(errs, fileName, fmt.Errorf("区服[%v]表校验失败:%w", zone, err))
+				continue
+			}
+			checked = append(checked, csvOriginParsedData)
 		}
 
 		csvTable := newCsvTable(file, region, zone)
 		csvTable.CsvOriginRowsData = csvOriginParsedData
 
 		if extraLoadFun != nil {
-			extraData, err := extraLoadFun(csvOriginParsedData.Rows)
+			extraData, err := extraLoadFun(csvOriginParsedData.Records())
 			if err != nil {
-				return nil, fmt.Errorf("表[%v]加载额外数据错误:%v", filepath.Base(file), err)
+				errs = AppendRowErrors(errs, fileName, fmt.Errorf("加载额外数据错误:%v", err))
+				continue
 			}
 			csvTable.extraData = extraData
 		}
 
 		list = append(list, csvTable)
 	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
 
 	return list, nil
 }
 
+// sharedChecked 行完全相同的数据已经校验过
+func sharedChecked(checked []*core.CsvOriginRowsData, data *core.CsvOriginRowsData) bool {
+	for _, c := range checked {
+		if c.SameRows(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// AppendRowErrors 把一个表的错误并入错误报告，err不是RowErrors时作为表级错误记录
+func AppendRowErrors(errs RowErrors, file string, err error) RowErrors {
+	var rowErrs RowErrors
+	if errors.As(err, &rowErrs) {
+		return append(errs, rowErrs.WithFile(file)...)
+	}
+	return append(errs, &RowError{File: file, Reason: err.Error()})
+}
+
 func newCsvTable(file string, region string, zone int) *CsvTable {
 	table := new(CsvTable)
 	table.MetaInfo.FileName = filepath.Base(file)
@@ -51,3 +129,11 @@ func newCsvTable(file string, region string, zone int) *CsvTable {
 func (cr *CsvTable) GetExtraData() interface{} {
 	return cr.extraData
 }
+
+// ReadSourceData 只读取文件的原始表格，不解析到结构体，loader为nil时按扩展名选择
+func ReadSourceData(file string, loader SourceLoader) (*SourceData, error) {
+	if loader == nil {
+		loader = core.GetSourceLoader(file)
+	}
+	return loader.Load(file)
+}
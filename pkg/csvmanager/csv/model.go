@@ -26,3 +26,15 @@ type CsvTable struct {
 	*core.CsvOriginRowsData
 	extraData interface{} // 额外数据
 }
+
+// RowError 配置表某行某列的错误
+type RowError = core.RowError
+
+// RowErrors 一次收集的所有行错误
+type RowErrors = core.RowErrors
+
+// SourceLoader 配置表文件格式的读取器
+type SourceLoader = core.SourceLoader
+
+// SourceData 数据源读取出的原始表格
+type SourceData = core.SourceData
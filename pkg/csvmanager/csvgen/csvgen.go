@@ -0,0 +1,298 @@
+// Package csvgen 根据配置表的类型行和字段名行生成表结构体、TableMetaData注册代码和类型化的读取函数，
+// 配置表改了字段重新生成，代码和配置表不会不一致，用法：
+//
+//	//go:generate go run joynova.com/library/supernova/pkg/csvmanager/cmd/csvgen -dir ../../gamedata -o tables_gen.go
+//
+// 类型行的格式见schema.go
+package csvgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+type Options struct {
+	Package string // 生成代码的包名
+	StartNo int    // 表序号起始值，按文件路径排序依次分配，默认1
+}
+
+type tableData struct {
+	*TableSchema
+	No       int
+	Accessor []*accessorData
+}
+
+type accessorData struct {
+	Name   string
+	Desc   string
+	Params []string // 参数名 类型
+	Call   string
+	Unique bool
+}
+
+// Generate 读取目录下的配置表生成源码
+func Generate(dir string, opts Options) ([]byte, error) {
+	schemas, err := LoadSchemas(dir)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateSchemas(schemas, opts)
+}
+
+// GenerateSchemas 以已经解析的表结构生成源码
+func GenerateSchemas(schemas []*TableSchema, opts Options) ([]byte, error) {
+	if opts.Package == "" {
+		return nil, fmt.Errorf("package name is required")
+	}
+	if opts.StartNo <= 0 {
+		opts.StartNo = 1
+	}
+
+	tables := make([]*tableData, 0, len(schemas))
+	names := make(map[string]string) // 生成的全局标识符，检查重名
+	for i, schema := range schemas {
+		table := &tableData{TableSchema: schema, No: opts.StartNo + i}
+		table.buildAccessors()
+		idents := []string{schema.StructName, schema.StructName + "Meta", "Get" + schema.StructName + "Table",
+			schema.StructName + "All"}
+		for _, a := range table.Accessor {
+			idents = append(idents, a.Name)
+		}
+		for _, ident := range idents {
+			if other, find := names[ident]; find {
+				return nil, fmt.Errorf("文件[%v]和[%v]生成的标识符[%v]重复", other, schema.File, ident)
+			}
+			names[ident] = schema.File
+		}
+		tables = append(tables, table)
+	}
+
+	buf := new(bytes.Buffer)
+	err := fileTemplate.Execute(buf, map[string]interface{}{
+		"Package": opts.Package,
+		"Tables":  tables,
+	})
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code error:%v\n%s", err, buf.Bytes())
+	}
+	return src, nil
+}
+
+// Main 命令行入口
+func Main() {
+	dir := flag.String("dir", ".", "config files directory")
+	output := flag.String("o", "tables_gen.go", "output file")
+	pkg := flag.String("pkg", "", "package name, default output dir name")
+	start := flag.Int("start", 1, "first table number")
+	schemaOut := flag.String("schema", "", "also write table schemas as json to this file, used by csvlint")
+	flag.Parse()
+
+	if *pkg == "" {
+		abs, err := filepath.Abs(*output)
+		if err == nil {
+			*pkg = filepath.Base(filepath.Dir(abs))
+		}
+	}
+	schemas, err := LoadSchemas(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load schemas error:%v\n", err)
+		os.Exit(1)
+	}
+	if *schemaOut != "" {
+		content, _ := json.MarshalIndent(schemas, "", "  ")
+		if err := os.WriteFile(*schemaOut, content, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "write %v error:%v\n", *schemaOut, err)
+			os.Exit(1)
+		}
+	}
+	src, err := GenerateSchemas(schemas, Options{Package: *pkg, StartNo: *start})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "generate tables error:%v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "write %v error:%v\n", *output, err)
+		os.Exit(1)
+	}
+}
+
+func (t *tableData) buildAccessors() {
+	group := 0
+	unions := make(map[string][]*ColumnSchema)
+	unionUniques := make(map[string][]*ColumnSchema)
+	unionOrder := make([]string, 0)
+	unionUniqueOrder := make([]string, 0)
+	intervals := make(map[string]bool)
+	for _, col := range t.Columns {
+		if col.Index {
+			t.Accessor = append(t.Accessor, &accessorData{
+				Name:   "Get" + t.StructName,
+				Desc:   fmt.Sprintf("按主键%v读取", col.Name),
+				Params: []string{"key " + col.GoType},
+				Call:   "table.Get(key)",
+				Unique: true,
+			})
+		}
+		if col.Group {
+			t.Accessor = append(t.Accessor, &accessorData{
+				Name:   "Find" + t.StructName + "By" + col.Field,
+				Desc:   fmt.Sprintf("按组索引%v读取", col.Name),
+				Params: []string{"key " + col.GoType},
+				Call:   fmt.Sprintf("table.Group(%v, key)", group),
+			})
+			group++
+		}
+		if col.Union != "" {
+			if _, find := unions[col.Union]; !find {
+				unionOrder = append(unionOrder, col.Union)
+			}
+			unions[col.Union] = append(unions[col.Union], col)
+		}
+		if col.UnionUnique != "" {
+			if _, find := unionUniques[col.UnionUnique]; !find {
+				unionUniqueOrder = append(unionUniqueOrder, col.UnionUnique)
+			}
+			unionUniques[col.UnionUnique] = append(unionUniques[col.UnionUnique], col)
+		}
+		if col.Sorted != "" {
+			name := goName(col.Sorted)
+			t.Accessor = append(t.Accessor, &accessorData{
+				Name:   "Floor" + t.StructName + "By" + name,
+				Desc:   fmt.Sprintf("按有序索引%v读取不超过key的最大一行", col.Sorted),
+				Params: []string{"key " + col.GoType},
+				Call:   fmt.Sprintf("table.Floor(%q, key)", col.Sorted),
+				Unique: true,
+			}, &accessorData{
+				Name:   "Ceil" + t.StructName + "By" + name,
+				Desc:   fmt.Sprintf("按有序索引%v读取不小于key的最小一行", col.Sorted),
+				Params: []string{"key " + col.GoType},
+				Call:   fmt.Sprintf("table.Ceil(%q, key)", col.Sorted),
+				Unique: true,
+			}, &accessorData{
+				Name:   "Range" + t.StructName + "By" + name,
+				Desc:   fmt.Sprintf("按有序索引%v读取[lo, hi]之间的所有行", col.Sorted),
+				Params: []string{"lo " + col.GoType, "hi " + col.GoType},
+				Call:   fmt.Sprintf("table.RangeBetween(%q, lo, hi)", col.Sorted),
+			})
+		}
+		if col.Interval != "" && !intervals[col.Interval] {
+			// 以开始列的类型作为参数类型
+			intervals[col.Interval] = true
+			t.Accessor = append(t.Accessor, &accessorData{
+				Name:   "Find" + t.StructName + "Containing" + goName(col.Interval),
+				Desc:   fmt.Sprintf("按区间索引%v读取包含key的所有行", col.Interval),
+				Params: []string{"key " + col.GoType},
+				Call:   fmt.Sprintf("table.Containing(%q, key)", col.Interval),
+			})
+		}
+	}
+	for _, name := range unionOrder {
+		params, args := unionParams(unions[name])
+		t.Accessor = append(t.Accessor, &accessorData{
+			Name:   "Find" + t.StructName + "By" + goName(name),
+			Desc:   fmt.Sprintf("按联合索引%v读取", name),
+			Params: params,
+			Call:   fmt.Sprintf("table.Union(%q, %v)", name, strings.Join(args, ", ")),
+		})
+	}
+	for _, name := range unionUniqueOrder {
+		params, args := unionParams(unionUniques[name])
+		t.Accessor = append(t.Accessor, &accessorData{
+			Name:   "Get" + t.StructName + "By" + goName(name),
+			Desc:   fmt.Sprintf("按联合唯一索引%v读取", name),
+			Params: params,
+			Call:   fmt.Sprintf("table.UnionUnique(%q, %v)", name, strings.Join(args, ", ")),
+			Unique: true,
+		})
+	}
+}
+
+func unionParams(cols []*ColumnSchema) (params []string, args []string) {
+	for _, col := range cols {
+		runes := []rune(col.Field)
+		// ChargeID -> chargeID，ID -> id
+		i := 0
+		for i < len(runes) && unicode.IsUpper(runes[i]) && (i == 0 || i+1 == len(runes) || unicode.IsUpper(runes[i+1])) {
+			runes[i] = unicode.ToLower(runes[i])
+			i++
+		}
+		name := string(runes)
+		if token.IsKeyword(name) || name == "zm" || name == "table" {
+			name += "Key"
+		}
+		params = append(params, name+" "+col.GoType)
+		args = append(args, name)
+	}
+	return
+}
+
+var fileTemplate = template.Must(template.New("tables").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`// Code generated by csvgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"joynova.com/library/supernova/pkg/csvmanager"
+)
+{{range $t := .Tables}}
+// {{$t.StructName}} {{$t.File}}
+type {{$t.StructName}} struct {
+{{- range $t.Columns}}
+	{{.Field}} {{.GoType}} ` + "`{{.Tag}}`" + `
+{{- end}}
+}
+
+// {{$t.StructName}}Meta {{$t.File}}的表元数据
+var {{$t.StructName}}Meta = csvmanager.Typed[{{$t.StructName}}](&csvmanager.TableMetaData{
+	No:   {{$t.No}},
+	File: "{{$t.File}}",
+}).Register()
+
+// Get{{$t.StructName}}Table 读取区服的{{$t.File}}
+func Get{{$t.StructName}}Table(zm *csvmanager.CsvZoneManager) (*csvmanager.Table[{{$t.StructName}}], bool) {
+	return {{$t.StructName}}Meta.From(zm)
+}
+
+// {{$t.StructName}}All {{$t.File}}所有数据
+func {{$t.StructName}}All(zm *csvmanager.CsvZoneManager) []*{{$t.StructName}} {
+	table, find := Get{{$t.StructName}}Table(zm)
+	if !find {
+		return nil
+	}
+	return table.All()
+}
+{{range $a := $t.Accessor}}
+// {{$a.Name}} {{$a.Desc}}
+{{- if $a.Unique}}
+func {{$a.Name}}(zm *csvmanager.CsvZoneManager, {{join $a.Params ", "}}) (*{{$t.StructName}}, bool) {
+	table, find := Get{{$t.StructName}}Table(zm)
+	if !find {
+		return nil, false
+	}
+	return {{$a.Call}}
+}
+{{- else}}
+func {{$a.Name}}(zm *csvmanager.CsvZoneManager, {{join $a.Params ", "}}) []*{{$t.StructName}} {
+	table, find := Get{{$t.StructName}}Table(zm)
+	if !find {
+		return nil
+	}
+	return {{$a.Call}}
+}
+{{- end}}
+{{end}}
+{{- end}}`))
@@ -0,0 +1,120 @@
+package csvgen
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "shop_config.csv", "#说明\n"+
+		"int|index\tstring|group\tint|union=shop\tstring|union=shop\t[]int|ref=item.id\tRewardItem[]\tuint|unionu=u\tstring\t\n"+
+		"id\tname\ttype\tcharge_id\titems\trewards\tsort\tregion\t_note\n"+
+		"1\ta\t1\tx\t1,2\t1:1\t1\t\t\n")
+	writeTestFile(t, dir, "item.csv", "int|index\tstring|loc\nid\tname\n")
+	writeTestFile(t, dir, "level.csv", "int|index\tint64|sorted=exp\tint64|interval=time\tint64|interval=time\n"+
+		"level\texp\tstart\tend\n")
+
+	src, err := Generate(dir, Options{Package: "gamedata"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+	for _, want := range []string{
+		"package gamedata",
+		"ID       int32         `csv:\"id\" index:\"true\"`",
+		"Items    []int32       `csv:\"items\" ref:\"item.id\"`",
+		"Rewards  []*RewardItem `csv:\"rewards\"`",
+		"Sort     uint32        `csv:\"sort\" unionu:\"u\"`",
+		"var ItemMeta = csvmanager.Typed[Item](&csvmanager.TableMetaData{\n\tNo:   1,",
+		"var ShopConfigMeta = csvmanager.Typed[ShopConfig](&csvmanager.TableMetaData{\n\tNo:   3,",
+		"func GetShopConfig(zm *csvmanager.CsvZoneManager, key int32) (*ShopConfig, bool)",
+		"func FindShopConfigByName(zm *csvmanager.CsvZoneManager, key string) []*ShopConfig",
+		"func FindShopConfigByShop(zm *csvmanager.CsvZoneManager, typeKey int32, chargeID string) []*ShopConfig",
+		"return table.Union(\"shop\", typeKey, chargeID)",
+		"func GetShopConfigByU(zm *csvmanager.CsvZoneManager, sort uint32) (*ShopConfig, bool)",
+		"Exp   int64 `csv:\"exp\" sorted:\"exp\"`",
+		"func FloorLevelByExp(zm *csvmanager.CsvZoneManager, key int64) (*Level, bool)",
+		"func RangeLevelByExp(zm *csvmanager.CsvZoneManager, lo int64, hi int64) []*Level",
+		"return table.Containing(\"time\", key)",
+		"Name string `csv:\"name\" loc:\"true\"`",
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("generated code missing %q\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "Region") || strings.Contains(code, "Note") {
+		t.Fatalf("filter and ignored columns should not be generated\n%s", code)
+	}
+}
+
+func TestParseSchemaError(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]string{
+		"flag.csv":   "int|primary\nid\n",
+		"index.csv":  "int|index\tint|index\na\tb\n",
+		"slice.csv":  "[]int|group\nid\n",
+		"union.csv":  "int|union\nid\n",
+		"type.csv":   "map[int]int\nid\n",
+		"column.csv": "int\tint\nid\n",
+		"sorted.csv": "bool|sorted=a\nid\n",
+		"range.csv":  "int|interval=t\nid\n",
+		"loc.csv":    "int|loc\nid\n",
+	}
+	for name, content := range cases {
+		writeTestFile(t, dir, name, content)
+		if _, err := ParseSchema(filepath.Join(dir, name)); err == nil {
+			t.Fatalf("%v expect error", name)
+		}
+	}
+}
+
+// TestGenerateCompiles 生成的代码放到模块内的临时包中用go vet做类型检查，
+// 目录以_开头，不会被./...匹配
+func TestGenerateCompiles(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	dir := t.TempDir()
+	writeTestFile(t, dir, "shop_config.csv", "int|index\tstring|group\tint|union=shop\tstring|union=shop\t[]int|ref=item.id\tRewardItem[]\tuint|unionu=u\n"+
+		"id\tname\ttype\tcharge_id\titems\trewards\tsort\n")
+	writeTestFile(t, dir, "item.csv", "int|index\tstring|loc\tfloat\tbool\t[]string\nid\tname\tweight\tenable\ttags\n")
+	writeTestFile(t, dir, "level.csv", "int|index\tint64|sorted=exp\tint64|interval=time\tint64|interval=time\n"+
+		"level\texp\tstart\tend\n")
+	src, err := Generate(dir, Options{Package: "gamedata"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "tables_gen.go", src, parser.AllErrors); err != nil {
+		t.Fatalf("parse generated code error:%v\n%s", err, src)
+	}
+	if formatted, err := format.Source(src); err != nil || !bytes.Equal(formatted, src) {
+		t.Fatalf("generated code not gofmt formatted:%v\n%s", err, src)
+	}
+
+	pkgDir, err := os.MkdirTemp(".", "_gentest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(pkgDir)
+	writeTestFile(t, pkgDir, "tables_gen.go", string(src))
+	writeTestFile(t, pkgDir, "types.go", "package gamedata\n\ntype RewardItem struct {\n\tID    int32\n\tCount int32\n}\n")
+	cmd := exec.Command(goTool, "vet", "./"+filepath.Base(pkgDir))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generated code does not compile:%v\n%s\n%s", err, out, src)
+	}
+}
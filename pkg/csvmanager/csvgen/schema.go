@@ -0,0 +1,331 @@
+package csvgen
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"joynova.com/library/supernova/pkg/csvmanager/csv/core"
+)
+
+// 类型行单元格格式：类型|标记|标记...，例如：
+//
+//	int|index          主键
+//	int|group          组索引
+//	string|union=shop  联合索引shop
+//	int|unionu=shop    联合唯一索引shop
+//	int|ref=item.id    引用item表的id列
+//	int|sorted=exp     有序索引exp
+//	int|interval=time  区间索引time，开始和结束两列按列顺序
+//	string|loc         多语言文本id，校验所有语言中都有这个id
+//	[]int、int[]       切片，单元格内逗号分隔
+//	RewardItem         自定义类型，需要在生成代码的包里实现Parse(string) error
+//
+// region、zone_id列用于按地区、区服过滤，不生成字段；类型为空或者列名以_开头的列不生成字段
+
+// TableSchema 从配置表表头解析出的表结构
+type TableSchema struct {
+	File       string          `json:"file"`        // 相对目录的文件路径
+	Name       string          `json:"name"`        // 表名，文件名去掉扩展名
+	StructName string          `json:"struct_name"` // 生成的结构体名
+	Columns    []*ColumnSchema `json:"columns"`
+}
+
+// ColumnSchema 一列的结构
+type ColumnSchema struct {
+	Name        string `json:"name"`                   // csv列名
+	Type        string `json:"type"`                   // 类型行声明的类型，去掉了标记
+	Field       string `json:"field"`                  // 生成的字段名
+	GoType      string `json:"go_type"`                // 生成的字段类型
+	Index       bool   `json:"index,omitempty"`        // 主键
+	Group       bool   `json:"group,omitempty"`        // 组索引
+	Union       string `json:"union,omitempty"`        // 联合索引名
+	UnionUnique string `json:"union_unique,omitempty"` // 联合唯一索引名
+	Ref         string `json:"ref,omitempty"`          // 引用的表名.列名
+	Sorted      string `json:"sorted,omitempty"`       // 有序索引名
+	Interval    string `json:"interval,omitempty"`     // 区间索引名
+	Loc         bool   `json:"loc,omitempty"`          // 多语言文本id
+}
+
+var basicTypes = map[string]string{
+	"int": "int32", "int8": "int8", "int16": "int16", "int32": "int32", "int64": "int64",
+	"uint": "uint32", "uint8": "uint8", "uint16": "uint16", "uint32": "uint32", "uint64": "uint64",
+	"float": "float64", "float32": "float32", "float64": "float64", "double": "float64",
+	"bool": "bool", "string": "string",
+}
+
+// LoadSchemas 读取目录下所有配置表的表头，按文件路径排序
+func LoadSchemas(dir string, exts ...string) ([]*TableSchema, error) {
+	if len(exts) <= 0 {
+		exts = []string{".csv", ".txt", ".tsv"}
+	}
+	files := make([]string, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		for _, ext := range exts {
+			if strings.EqualFold(filepath.Ext(path), ext) {
+				files = append(files, path)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	schemas := make([]*TableSchema, 0, len(files))
+	structNames := make(map[string]string)
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := ParseSchema(file)
+		if err != nil {
+			return nil, err
+		}
+		schema.File = filepath.ToSlash(rel)
+		if other, find := structNames[schema.StructName]; find {
+			return nil, fmt.Errorf("文件[%v]和[%v]生成的结构体名[%v]重复", other, schema.File, schema.StructName)
+		}
+		structNames[schema.StructName] = schema.File
+		schemas = append(schemas, schema)
+	}
+	return schemas, nil
+}
+
+// ParseSchema 读取一个配置表的类型行和字段名行
+func ParseSchema(file string) (*TableSchema, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("打开文件[%v]错误:%v", file, err)
+	}
+	defer fd.Close()
+
+	reader := csv.NewReader(fd)
+	reader.Comma = core.Comma
+	reader.Comment = core.Comment
+	reader.FieldsPerRecord = -1
+	typeRow, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取文件[%v]字段类型行错误:%v", file, err)
+	}
+	nameRow, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("读取文件[%v]字段名行错误:%v", file, err)
+	}
+	if len(typeRow) != len(nameRow) {
+		return nil, fmt.Errorf("文件[%v]类型行和字段名行列数不一致:%v,%v", file, len(typeRow), len(nameRow))
+	}
+
+	base := filepath.Base(file)
+	schema := &TableSchema{
+		File: filepath.ToSlash(file),
+		Name: strings.TrimSuffix(base, filepath.Ext(base)),
+	}
+	schema.StructName = goName(schema.Name)
+	fields := make(map[string]string)
+	for i, name := range nameRow {
+		name = strings.TrimSpace(name)
+		typeCell := strings.TrimSpace(typeRow[i])
+		if name == "" || typeCell == "" || strings.HasPrefix(name, "_") || name == "region" || name == "zone_id" {
+			continue
+		}
+		col, err := parseColumn(name, typeCell)
+		if err != nil {
+			return nil, fmt.Errorf("文件[%v]第[%v]列[%v]:%v", file, i+1, name, err)
+		}
+		if other, find := fields[col.Field]; find {
+			return nil, fmt.Errorf("文件[%v]列[%v]和[%v]生成的字段名[%v]重复", file, other, name, col.Field)
+		}
+		fields[col.Field] = name
+		schema.Columns = append(schema.Columns, col)
+	}
+	if err := schema.check(); err != nil {
+		return nil, fmt.Errorf("文件[%v]:%v", file, err)
+	}
+	return schema, nil
+}
+
+func parseColumn(name string, typeCell string) (*ColumnSchema, error) {
+	parts := strings.Split(typeCell, "|")
+	col := &ColumnSchema{Name: name, Type: strings.TrimSpace(parts[0]), Field: goName(name)}
+	goType, err := parseGoType(col.Type)
+	if err != nil {
+		return nil, err
+	}
+	col.GoType = goType
+
+	for _, flag := range parts[1:] {
+		flag = strings.TrimSpace(flag)
+		key, value := flag, ""
+		if i := strings.Index(flag, "="); i >= 0 {
+			key, value = flag[:i], flag[i+1:]
+		}
+		switch key {
+		case "index":
+			col.Index = true
+		case "group":
+			col.Group = true
+		case "union":
+			col.Union = value
+		case "unionu":
+			col.UnionUnique = value
+		case "ref":
+			col.Ref = value
+		case "sorted":
+			col.Sorted = value
+		case "interval":
+			col.Interval = value
+		case "loc":
+			col.Loc = true
+		default:
+			return nil, fmt.Errorf("不支持的标记[%v]", flag)
+		}
+		if (key == "union" || key == "unionu" || key == "ref" || key == "sorted" || key == "interval") && value == "" {
+			return nil, fmt.Errorf("标记[%v]需要指定名字，例如%v=name", key, key)
+		}
+	}
+	return col, nil
+}
+
+func parseGoType(t string) (string, error) {
+	if strings.HasPrefix(t, "[]") || strings.HasSuffix(t, "[]") {
+		elem := strings.TrimSuffix(strings.TrimPrefix(t, "[]"), "[]")
+		elemType, err := parseGoType(elem)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(elemType, "[]") {
+			return "", fmt.Errorf("不支持多维切片[%v]", t)
+		}
+		return "[]" + elemType, nil
+	}
+	if goType, find := basicTypes[t]; find {
+		return goType, nil
+	}
+	if t == "" || !isIdent(t) {
+		return "", fmt.Errorf("不支持的类型[%v]", t)
+	}
+	// 自定义类型，空单元格为nil
+	return "*" + t, nil
+}
+
+func (s *TableSchema) check() error {
+	index := 0
+	sorted := make(map[string]bool)
+	intervals := make(map[string]int)
+	for _, col := range s.Columns {
+		if col.Index {
+			index++
+		}
+		if (col.Index || col.Group || col.Union != "" || col.UnionUnique != "") && !col.IsBasic() {
+			return fmt.Errorf("列[%v]类型[%v]不能作为索引", col.Name, col.Type)
+		}
+		if (col.Sorted != "" || col.Interval != "") && (!col.IsBasic() || col.GoType == "bool") {
+			return fmt.Errorf("列[%v]类型[%v]不能作为有序索引或区间索引", col.Name, col.Type)
+		}
+		if col.Loc && col.GoType != "string" && col.GoType != "[]string" {
+			return fmt.Errorf("列[%v]类型[%v]不能作为多语言文本id", col.Name, col.Type)
+		}
+		if col.Sorted != "" {
+			if sorted[col.Sorted] {
+				return fmt.Errorf("有序索引[%v]重复", col.Sorted)
+			}
+			sorted[col.Sorted] = true
+		}
+		if col.Interval != "" {
+			intervals[col.Interval]++
+		}
+	}
+	if index > 1 {
+		return fmt.Errorf("只能有一个主键列")
+	}
+	for name, n := range intervals {
+		if n != 2 {
+			return fmt.Errorf("区间索引[%v]需要开始和结束两列", name)
+		}
+	}
+	return nil
+}
+
+// IsBasic 基础类型，可以作为索引
+func (c *ColumnSchema) IsBasic() bool {
+	_, find := basicTypes[c.Type]
+	return find
+}
+
+// Tag 生成字段的结构体标签
+func (c *ColumnSchema) Tag() string {
+	tags := []string{fmt.Sprintf(`csv:"%v"`, c.Name)}
+	if c.Index {
+		tags = append(tags, `index:"true"`)
+	}
+	if c.Group {
+		tags = append(tags, `group:"true"`)
+	}
+	if c.Union != "" {
+		tags = append(tags, fmt.Sprintf(`union:"%v"`, c.Union))
+	}
+	if c.UnionUnique != "" {
+		tags = append(tags, fmt.Sprintf(`unionu:"%v"`, c.UnionUnique))
+	}
+	if c.Ref != "" {
+		tags = append(tags, fmt.Sprintf(`ref:"%v"`, c.Ref))
+	}
+	if c.Sorted != "" {
+		tags = append(tags, fmt.Sprintf(`sorted:"%v"`, c.Sorted))
+	}
+	if c.Interval != "" {
+		tags = append(tags, fmt.Sprintf(`interval:"%v"`, c.Interval))
+	}
+	if c.Loc {
+		tags = append(tags, `loc:"true"`)
+	}
+	return strings.Join(tags, " ")
+}
+
+var commonInitialisms = map[string]string{
+	"id": "ID", "url": "URL", "uid": "UID", "vip": "VIP", "ip": "IP", "api": "API", "http": "HTTP",
+}
+
+// goName item_config -> ItemConfig，charge_id -> ChargeID
+func goName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := ""
+	for _, p := range parts {
+		if v, find := commonInitialisms[strings.ToLower(p)]; find {
+			out += v
+			continue
+		}
+		runes := []rune(p)
+		runes[0] = unicode.ToUpper(runes[0])
+		out += string(runes)
+	}
+	if out == "" || unicode.IsDigit([]rune(out)[0]) {
+		out = "T" + out
+	}
+	return out
+}
+
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,355 @@
+// Package csvlint 用游戏服相同的csvmanager读取流程校验配置表：解析、主键和联合唯一索引重复、
+// region和zone_id解析、ref引用、指定了多语言配置时的loc文本，输出文本、json或者junit报告，有错误时退出码为1。
+//
+// 使用csvgen生成的注册包校验时，结构体、自定义类型的Parse和游戏服完全一致：
+//
+//	package main
+//
+//	import (
+//	    _ "game/gamedata"
+//
+//	    "joynova.com/library/supernova/pkg/csvmanager/csvlint"
+//	)
+//
+//	func main() {
+//	    csvlint.Main()
+//	}
+//
+// 没有注册的表时按-schema指定的表结构文件或者配置表表头动态生成结构体，见SchemaTables
+package csvlint
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"joynova.com/library/supernova/pkg/csvmanager"
+	"joynova.com/library/supernova/pkg/csvmanager/csv"
+	"joynova.com/library/supernova/pkg/csvmanager/csvgen"
+)
+
+type Options struct {
+	Dir     string                            // 配置表目录
+	Tables  map[int]*csvmanager.TableMetaData // 校验的表
+	Regions []string                          // 校验的地区，为空时取所有表region列出现的值
+	Zones   []int                             // 校验的区服，为空时取所有表zone_id列出现的值
+	Loc     *csvmanager.LocConfig             // 多语言配置，不为空时校验loc标签
+}
+
+// Report 校验报告
+type Report struct {
+	Dir     string         `json:"dir"`
+	Regions []string       `json:"regions"`
+	Zones   []int          `json:"zones"`
+	Tables  []*TableResult `json:"tables"`
+	Errors  int            `json:"errors"`
+}
+
+// TableResult 一张表的校验结果，File为空的是不属于某张表的错误
+type TableResult struct {
+	File   string     `json:"file"`
+	Errors []*Problem `json:"errors,omitempty"`
+}
+
+// Problem 一个错误和发现错误的地区
+type Problem struct {
+	Region string `json:"region"`
+	*csv.RowError
+}
+
+// Lint 按地区依次创建管理器读取所有表，收集所有错误，表都读取完才返回，error只表示无法开始校验
+func Lint(opts Options) (*Report, error) {
+	if len(opts.Tables) <= 0 {
+		return nil, fmt.Errorf("没有要校验的表")
+	}
+	tables := sortedTables(opts.Tables)
+	regions, zones := opts.Regions, opts.Zones
+	if len(regions) <= 0 || len(zones) <= 0 {
+		foundRegions, foundZones := collectRegionZones(opts.Dir, tables)
+		if len(regions) <= 0 {
+			regions = foundRegions
+		}
+		if len(zones) <= 0 {
+			zones = foundZones
+		}
+	}
+
+	report := &Report{Dir: opts.Dir, Regions: regions, Zones: zones}
+	results := make(map[string]*TableResult, len(tables))
+	for _, table := range tables {
+		result := &TableResult{File: table.File}
+		report.Tables = append(report.Tables, result)
+		results[filepath.Base(table.File)] = result
+	}
+	reported := make(map[csv.RowError]bool)
+	for _, region := range regions {
+		var errs csv.RowErrors
+		m, err := csvmanager.NewSpecMeta(region, zones, opts.Dir, opts.Tables)
+		if err == nil && opts.Loc != nil {
+			err = m.SetLocalization(opts.Loc)
+		}
+		if err == nil {
+			err = m.CheckAllCsvCanLoad(false)
+		}
+		if err != nil {
+			errs = csv.AppendRowErrors(errs, "", err)
+		}
+		for _, e := range errs {
+			if reported[*e] {
+				continue
+			}
+			reported[*e] = true
+			result, find := results[e.File]
+			if !find {
+				result, find = results[""]
+				if !find {
+					result = &TableResult{}
+					report.Tables = append(report.Tables, result)
+					results[""] = result
+				}
+			}
+			result.Errors = append(result.Errors, &Problem{Region: region, RowError: e})
+			report.Errors++
+		}
+	}
+	return report, nil
+}
+
+func sortedTables(tables map[int]*csvmanager.TableMetaData) []*csvmanager.TableMetaData {
+	list := make([]*csvmanager.TableMetaData, 0, len(tables))
+	for _, v := range tables {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].No < list[j].No
+	})
+	return list
+}
+
+// collectRegionZones 所有表region、zone_id列出现的值，都没有时地区为空、区服为1，只匹配通用行
+func collectRegionZones(dir string, tables []*csvmanager.TableMetaData) ([]string, []int) {
+	regionSet := make(map[string]bool)
+	zoneSet := make(map[int]bool)
+	for _, table := range tables {
+		data, err := csv.ReadSourceData(filepath.Join(dir, table.File), table.Loader)
+		if err != nil {
+			// 读取错误在校验时报告
+			continue
+		}
+		for i, name := range data.FieldNames {
+			if name != "region" && name != "zone_id" {
+				continue
+			}
+			for _, row := range data.Rows {
+				if i >= len(row) || row[i] == "" {
+					continue
+				}
+				for _, v := range strings.Split(row[i], ",") {
+					if name == "region" {
+						regionSet[v] = true
+					} else if zone, err := strconv.Atoi(v); err == nil {
+						zoneSet[zone] = true
+					}
+				}
+			}
+		}
+	}
+
+	regions := make([]string, 0, len(regionSet))
+	for v := range regionSet {
+		regions = append(regions, v)
+	}
+	sort.Strings(regions)
+	if len(regions) <= 0 {
+		regions = []string{""}
+	}
+	zones := make([]int, 0, len(zoneSet))
+	for v := range zoneSet {
+		zones = append(zones, v)
+	}
+	sort.Ints(zones)
+	if len(zones) <= 0 {
+		zones = []int{1}
+	}
+	return regions, zones
+}
+
+// WriteText 输出给人看的报告
+func WriteText(w io.Writer, report *Report) error {
+	for _, table := range report.Tables {
+		for _, p := range table.Errors {
+			if len(report.Regions) > 1 {
+				if _, err := fmt.Fprintf(w, "[%v] ", p.Region); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintln(w, p.RowError.Error()); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "csvlint: %v tables, %v errors\n", len(report.Tables), report.Errors)
+	return err
+}
+
+// WriteJSON 输出json报告
+func WriteJSON(w io.Writer, report *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit 输出junit报告，每张表为一个testcase，用于CI展示
+func WriteJUnit(w io.Writer, report *Report) error {
+	suite := junitSuite{Name: "csvlint", Tests: len(report.Tables)}
+	for _, table := range report.Tables {
+		c := junitCase{ClassName: "csvlint", Name: table.File}
+		if c.Name == "" {
+			c.Name = "tables"
+		}
+		if len(table.Errors) > 0 {
+			lines := make([]string, 0, len(table.Errors))
+			for _, p := range table.Errors {
+				lines = append(lines, fmt.Sprintf("[%v] %v", p.Region, p.RowError.Error()))
+			}
+			c.Failure = &junitFailure{
+				Message: fmt.Sprintf("%v errors", len(table.Errors)),
+				Text:    strings.Join(lines, "\n"),
+			}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Main 命令行入口，已经注册了表时校验注册的表，否则按-schema或者表头生成结构体，
+// 退出码0为没有错误，1为配置表有错误，2为无法校验
+func Main() {
+	dir := flag.String("dir", ".", "config files directory")
+	schema := flag.String("schema", "", "table schema json file, default parse table headers in dir")
+	regions := flag.String("regions", "", "comma separated regions, default all values of region columns")
+	zones := flag.String("zones", "", "comma separated zones, default all values of zone_id columns")
+	format := flag.String("format", "text", "report format: text, json or junit")
+	output := flag.String("o", "", "report file, default stdout")
+	flag.Parse()
+
+	os.Exit(lint(*dir, *schema, *regions, *zones, *format, *output))
+}
+
+// lint 校验并输出报告，返回退出码
+func lint(dir, schema, regions, zones, format, output string) int {
+	write, find := map[string]func(io.Writer, *Report) error{
+		"text": WriteText, "json": WriteJSON, "junit": WriteJUnit,
+	}[format]
+	if !find {
+		fmt.Fprintf(os.Stderr, "unknown format %v\n", format)
+		return 2
+	}
+	report, err := run(dir, schema, regions, zones)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "csvlint error:%v\n", err)
+		return 2
+	}
+
+	w := io.Writer(os.Stdout)
+	if output != "" {
+		fd, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "create %v error:%v\n", output, err)
+			return 2
+		}
+		defer fd.Close()
+		w = fd
+		// 报告写入文件时，终端仍然输出摘要
+		defer fmt.Fprintf(os.Stderr, "csvlint: %v tables, %v errors\n", len(report.Tables), report.Errors)
+	}
+	if err := write(w, report); err != nil {
+		fmt.Fprintf(os.Stderr, "write report error:%v\n", err)
+		return 2
+	}
+	if report.Errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+func run(dir, schemaFile, regionsFlag, zonesFlag string) (*Report, error) {
+	tables := csvmanager.RegisteredTables()
+	if len(tables) <= 0 {
+		var schemas []*csvgen.TableSchema
+		var err error
+		if schemaFile != "" {
+			schemas, err = LoadSchemaFile(schemaFile)
+		} else {
+			schemas, err = csvgen.LoadSchemas(dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+		tables, err = SchemaTables(schemas)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := Options{Dir: dir, Tables: tables, Regions: splitList(regionsFlag)}
+	for _, v := range splitList(zonesFlag) {
+		zone, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.New("zones must be comma separated numbers")
+		}
+		opts.Zones = append(opts.Zones, zone)
+	}
+	return Lint(opts)
+}
+
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,118 @@
+package csvlint
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"joynova.com/library/supernova/pkg/csvmanager/csvgen"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "item.csv", "int|index\tstring\tRewardItem\tstring\nid\tname\treward\tregion\n"+
+		"1\ta\t1:1\t\n2\tb\t\tcn\n2\tc\t\tcn\nx\td\t\t\n")
+	writeTestFile(t, dir, "shop.csv", "int|index\tint|ref=item.id\tstring\nid\titem_id\tzone_id\n"+
+		"1\t1\t\n2\t3\t\n3\t1\ty\n")
+	writeTestFile(t, dir, "ok.csv", "int|index\nid\n1\n")
+
+	schemas, err := csvgen.LoadSchemas(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, err := SchemaTables(schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Lint(Options{Dir: dir, Tables: tables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Regions) != 1 || report.Regions[0] != "cn" || len(report.Zones) != 1 || report.Zones[0] != 1 {
+		t.Fatalf("unexpected regions %v zones %v", report.Regions, report.Zones)
+	}
+	errs := make(map[string][]*Problem)
+	for _, table := range report.Tables {
+		errs[table.File] = table.Errors
+	}
+	if len(errs["item.csv"]) != 1 || errs["item.csv"][0].Line != 6 || errs["item.csv"][0].Column != "id" {
+		t.Fatalf("unexpected item errors %v", errs["item.csv"])
+	}
+	if len(errs["shop.csv"]) != 1 || errs["shop.csv"][0].Line != 5 || errs["shop.csv"][0].Column != "zone_id" {
+		t.Fatalf("unexpected shop errors %v", errs["shop.csv"])
+	}
+	if len(errs["ok.csv"]) != 0 || report.Errors != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := WriteText(buf, report); err != nil || !strings.Contains(buf.String(), "3 tables, 2 errors") {
+		t.Fatalf("text report %v %v", err, buf.String())
+	}
+	buf.Reset()
+	decoded := new(Report)
+	if err := WriteJSON(buf, report); err != nil || json.Unmarshal(buf.Bytes(), decoded) != nil ||
+		decoded.Errors != 2 || decoded.Tables[0].Errors[0].File != "item.csv" {
+		t.Fatalf("json report %v %v", err, buf.String())
+	}
+	buf.Reset()
+	suites := new(junitSuites)
+	if err := WriteJUnit(buf, report); err != nil || xml.Unmarshal(buf.Bytes(), suites) != nil ||
+		suites.Suites[0].Tests != 3 || suites.Suites[0].Failures != 2 {
+		t.Fatalf("junit report %v %v", err, buf.String())
+	}
+
+	// 修复解析错误之后，cn主键重复，us校验到引用错误
+	writeTestFile(t, dir, "item.csv", "int|index\tstring\tRewardItem\tstring\nid\tname\treward\tregion\n"+
+		"1\ta\t1:1\t\n2\tb\t\tcn\n2\tc\t\tcn\n")
+	writeTestFile(t, dir, "shop.csv", "int|index\tint|ref=item.id\tstring\nid\titem_id\tzone_id\n"+
+		"1\t1\t\n2\t3\t\n")
+	report, err = Lint(Options{Dir: dir, Tables: tables, Regions: []string{"cn", "us"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Errors != 2 || len(report.Tables[0].Errors) != 1 || report.Tables[0].Errors[0].Line != 5 ||
+		report.Tables[0].Errors[0].Region != "cn" || len(report.Tables[2].Errors) != 1 ||
+		report.Tables[2].Errors[0].Value != "3" || report.Tables[2].Errors[0].Region != "us" {
+		t.Fatalf("expect duplicate and ref errors, got %v %v", report.Tables[0].Errors, report.Tables[2].Errors)
+	}
+}
+
+func TestLintMain(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "item.csv", "int|index\nid\n1\n1\n")
+	schemas, err := csvgen.LoadSchemas(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := json.Marshal(schemas)
+	schemaFile := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(schemaFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "report.xml")
+	if code := lint(dir, schemaFile, "", "1,2", "junit", out); code != 1 {
+		t.Fatalf("expect exit code 1, got %v", code)
+	}
+	if report, err := os.ReadFile(out); err != nil || !strings.Contains(string(report), "failures=\"1\"") {
+		t.Fatalf("junit report %v %s", err, report)
+	}
+	writeTestFile(t, dir, "item.csv", "int|index\nid\n1\n")
+	if code := lint(dir, "", "", "", "text", filepath.Join(t.TempDir(), "report.txt")); code != 0 {
+		t.Fatalf("expect exit code 0, got %v", code)
+	}
+	if code := lint(dir, "", "", "x", "text", ""); code != 2 {
+		t.Fatalf("expect exit code 2, got %v", code)
+	}
+}
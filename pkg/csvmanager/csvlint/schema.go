@@ -0,0 +1,75 @@
+package csvlint
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"reflect"
+	"strings"
+
+	"joynova.com/library/supernova/pkg/csvmanager"
+	"joynova.com/library/supernova/pkg/csvmanager/csvgen"
+)
+
+var basicKinds = map[string]reflect.Type{
+	"int8": reflect.TypeOf(int8(0)), "int16": reflect.TypeOf(int16(0)),
+	"int32": reflect.TypeOf(int32(0)), "int64": reflect.TypeOf(int64(0)),
+	"uint8": reflect.TypeOf(uint8(0)), "uint16": reflect.TypeOf(uint16(0)),
+	"uint32": reflect.TypeOf(uint32(0)), "uint64": reflect.TypeOf(uint64(0)),
+	"float32": reflect.TypeOf(float32(0)), "float64": reflect.TypeOf(float64(0)),
+	"bool": reflect.TypeOf(false), "string": reflect.TypeOf(""),
+}
+
+// LoadSchemaFile 读取表结构文件，内容为csvgen.LoadSchemas结果的json
+func LoadSchemaFile(file string) ([]*csvgen.TableSchema, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("读取表结构文件[%v]错误:%v", file, err)
+	}
+	schemas := make([]*csvgen.TableSchema, 0)
+	if err := json.Unmarshal(content, &schemas); err != nil {
+		return nil, fmt.Errorf("解析表结构文件[%v]错误:%v", file, err)
+	}
+	return schemas, nil
+}
+
+// SchemaTables 按表结构动态生成和csvgen生成代码相同的结构体，表序号按顺序从1开始，
+// 自定义类型没有Parse实现，按字符串读取
+func SchemaTables(schemas []*csvgen.TableSchema) (map[int]*csvmanager.TableMetaData, error) {
+	tables := make(map[int]*csvmanager.TableMetaData, len(schemas))
+	for i, schema := range schemas {
+		fields := make([]reflect.StructField, 0, len(schema.Columns))
+		for _, col := range schema.Columns {
+			if !token.IsIdentifier(col.Field) || !token.IsExported(col.Field) {
+				return nil, fmt.Errorf("文件[%v]列[%v]的字段名[%v]不能导出", schema.File, col.Name, col.Field)
+			}
+			t, err := schemaType(col.GoType)
+			if err != nil {
+				return nil, fmt.Errorf("文件[%v]列[%v]:%v", schema.File, col.Name, err)
+			}
+			fields = append(fields, reflect.StructField{Name: col.Field, Type: t, Tag: reflect.StructTag(col.Tag())})
+		}
+		st := reflect.New(reflect.StructOf(fields)).Elem().Interface()
+		tables[i+1] = &csvmanager.TableMetaData{No: i + 1, St: st, File: schema.File, Name: schema.Name}
+	}
+	return tables, nil
+}
+
+func schemaType(goType string) (reflect.Type, error) {
+	if strings.HasPrefix(goType, "[]") {
+		elem, err := schemaType(goType[2:])
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(elem), nil
+	}
+	if strings.HasPrefix(goType, "*") {
+		return reflect.TypeOf(""), nil
+	}
+	t, find := basicKinds[goType]
+	if !find {
+		return nil, fmt.Errorf("不支持的类型[%v]", goType)
+	}
+	return t, nil
+}
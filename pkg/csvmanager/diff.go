@@ -0,0 +1,209 @@
+package csvmanager
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"joynova.com/library/supernova/pkg/csvmanager/csv"
+	"joynova.com/library/supernova/pkg/jlog"
+)
+
+// VersionDiff 一次版本切换所有改变的表的行级差异
+type VersionDiff struct {
+	Version int          `json:"version"` // 切换后的版本号
+	Tables  []*TableDiff `json:"tables"`
+}
+
+// TableDiff 一张表的差异，行以index:"true"列为主键对比，有region、zone_id列时主键带上这两列，
+// 没有主键列的表以整行内容为主键，修改表现为删除加新增
+type TableDiff struct {
+	No      int        `json:"no"`
+	File    string     `json:"file"`
+	Added   []*RowDiff `json:"added,omitempty"`
+	Removed []*RowDiff `json:"removed,omitempty"`
+	Changed []*RowDiff `json:"changed,omitempty"`
+	Error   string     `json:"error,omitempty"` // 无法对比的原因，例如没有旧版本数据
+}
+
+// RowDiff 一行的差异
+type RowDiff struct {
+	Key    string            `json:"key"`              // 主键，例如"1001"、"1001|region=cn|zone_id=1"
+	Line   int               `json:"line"`             // 新文件的行号，删除的行为旧文件的行号
+	Row    map[string]string `json:"row,omitempty"`    // 新增、删除行的所有列
+	Fields []*FieldDiff      `json:"fields,omitempty"` // 修改行改变的列
+}
+
+// FieldDiff 一列的新旧值
+type FieldDiff struct {
+	Column string `json:"column"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// SubscribeDiff 订阅版本切换的行级差异，第一次订阅时读取当前所有表文件作为对比基准，
+// 之后每次切换只重新读取改变的表的原始单元格，不解析到结构体
+func (m *CsvManager) SubscribeDiff(f func(diff *VersionDiff)) {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+
+	if m.diffSources == nil {
+		m.diffSources = make(map[int]*csv.SourceData)
+		path := m.dataPath()
+		for _, table := range sortedTables(m.tablesMetaData()) {
+			m.updateDiffSource(path, table)
+		}
+	}
+	m.lock.Lock()
+	m.diffSubscribers = append(m.diffSubscribers, f)
+	m.lock.Unlock()
+}
+
+// diffTables 对比改变的表并更新对比基准，调用时持有reloadLock
+func (m *CsvManager) diffTables(path string, version int, changed []int) *VersionDiff {
+	if m.diffSources == nil {
+		return nil
+	}
+	diff := &VersionDiff{Version: version, Tables: make([]*TableDiff, 0, len(changed))}
+	for _, no := range changed {
+		table, _ := m.tableMetaData(no)
+		old := m.diffSources[no]
+		cur := m.updateDiffSource(path, table)
+		tableDiff := &TableDiff{No: no, File: table.File}
+		if old == nil || cur == nil {
+			tableDiff.Error = "没有旧版本或新版本的原始数据"
+		} else {
+			diffSource(tableDiff, old, cur, diffKeyColumn(table.St))
+		}
+		diff.Tables = append(diff.Tables, tableDiff)
+	}
+	return diff
+}
+
+func (m *CsvManager) updateDiffSource(path string, table *TableMetaData) *csv.SourceData {
+	data, err := csv.ReadSourceData(path+table.File, table.Loader)
+	if err != nil {
+		jlog.Warnf("读取表[%v]原始数据用于对比错误:%v", table.File, err)
+		delete(m.diffSources, table.No)
+		return nil
+	}
+	m.diffSources[table.No] = data
+	return data
+}
+
+func notifyDiff(f func(diff *VersionDiff), diff *VersionDiff) {
+	defer jlog.CatchWithInfo(fmt.Sprintf("配置表版本[%v]差异回调", diff.Version))
+	f(diff)
+}
+
+// diffKeyColumn 结构体index:"true"字段对应的列名
+func diffKeyColumn(st interface{}) string {
+	t := reflect.TypeOf(st)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return ""
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("index") == "true" {
+			return t.Field(i).Tag.Get("csv")
+		}
+	}
+	return ""
+}
+
+type diffRow struct {
+	key    string
+	line   int
+	values map[string]string
+}
+
+func diffSource(tableDiff *TableDiff, old *csv.SourceData, cur *csv.SourceData, keyColumn string) {
+	oldRows := diffRows(old, keyColumn)
+	curRows := diffRows(cur, keyColumn)
+	columns := append([]string{}, cur.FieldNames...)
+	for _, name := range old.FieldNames {
+		if indexOf(cur.FieldNames, name) < 0 {
+			columns = append(columns, name)
+		}
+	}
+
+	oldByKey := make(map[string]*diffRow, len(oldRows))
+	for _, r := range oldRows {
+		oldByKey[r.key] = r
+	}
+	for _, r := range curRows {
+		o, find := oldByKey[r.key]
+		if !find {
+			tableDiff.Added = append(tableDiff.Added, &RowDiff{Key: r.key, Line: r.line, Row: r.values})
+			continue
+		}
+		delete(oldByKey, r.key)
+		var fields []*FieldDiff
+		for _, col := range columns {
+			if o.values[col] != r.values[col] {
+				fields = append(fields, &FieldDiff{Column: col, Old: o.values[col], New: r.values[col]})
+			}
+		}
+		if len(fields) > 0 {
+			tableDiff.Changed = append(tableDiff.Changed, &RowDiff{Key: r.key, Line: r.line, Fields: fields})
+		}
+	}
+	for _, r := range oldRows {
+		if _, find := oldByKey[r.key]; find {
+			tableDiff.Removed = append(tableDiff.Removed, &RowDiff{Key: r.key, Line: r.line, Row: r.values})
+		}
+	}
+}
+
+// diffRows 按文件顺序生成每行的主键，主键重复时加上序号
+func diffRows(data *csv.SourceData, keyColumn string) []*diffRow {
+	keyIndex := indexOf(data.FieldNames, keyColumn)
+	regionIndex := indexOf(data.FieldNames, "region")
+	zoneIndex := indexOf(data.FieldNames, "zone_id")
+
+	rows := make([]*diffRow, 0, len(data.Rows))
+	seen := make(map[string]int, len(data.Rows))
+	for i, row := range data.Rows {
+		r := &diffRow{values: make(map[string]string, len(data.FieldNames))}
+		for j, name := range data.FieldNames {
+			if j < len(row) {
+				r.values[name] = row[j]
+			}
+		}
+		if i < len(data.Lines) {
+			r.line = data.Lines[i]
+		}
+
+		if keyIndex < 0 || keyIndex >= len(row) {
+			r.key = strings.Join(row, "\t")
+		} else {
+			r.key = row[keyIndex]
+			if regionIndex >= 0 && regionIndex < len(row) && row[regionIndex] != "" {
+				r.key += "|region=" + row[regionIndex]
+			}
+			if zoneIndex >= 0 && zoneIndex < len(row) && row[zoneIndex] != "" {
+				r.key += "|zone_id=" + row[zoneIndex]
+			}
+		}
+		seen[r.key]++
+		if n := seen[r.key]; n > 1 {
+			r.key = fmt.Sprintf("%v#%v", r.key, n)
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+func indexOf(list []string, s string) int {
+	if s == "" {
+		return -1
+	}
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
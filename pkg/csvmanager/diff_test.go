@@ -0,0 +1,77 @@
+package csvmanager
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type diffTestData struct {
+	ID   int32  `csv:"id" index:"true"`
+	Name string `csv:"name"`
+	Cost int32  `csv:"cost"`
+}
+
+func TestReloadDiff(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "item.csv")
+	writeDiff := func(rows string) {
+		content := "int\tstring\tint\tstring\nid\tname\tcost\tregion\n" + rows
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeDiff("1\ta\t10\t\n2\tb\t20\t\n3\tc\t30\tcn\n3\tc\t31\tus\n")
+	meta := &TableMetaData{No: 1, St: diffTestData{}, File: "item.csv"}
+	m, err := NewSpecMeta("cn", []int{1}, dir, map[int]*TableMetaData{1: meta})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diffs []*VersionDiff
+	m.SubscribeDiff(func(diff *VersionDiff) {
+		diffs = append(diffs, diff)
+	})
+
+	writeDiff("1\ta\t15\t\n3\tc\t30\tcn\n3\tc\t32\tus\n4\td\t40\t\n")
+	if err := m.ReloadRefresh(); err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Version != 2 || len(diffs[0].Tables) != 1 {
+		t.Fatalf("unexpected diffs %+v", diffs)
+	}
+	diff := diffs[0].Tables[0]
+	if len(diff.Added) != 1 || diff.Added[0].Key != "4" || diff.Added[0].Line != 6 || diff.Added[0].Row["name"] != "d" {
+		t.Fatalf("unexpected added %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Key != "2" || diff.Removed[0].Line != 4 {
+		t.Fatalf("unexpected removed %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 2 ||
+		!reflect.DeepEqual(diff.Changed[0], &RowDiff{Key: "1", Line: 3, Fields: []*FieldDiff{{Column: "cost", Old: "10", New: "15"}}}) ||
+		!reflect.DeepEqual(diff.Changed[1], &RowDiff{Key: "3|region=us", Line: 5, Fields: []*FieldDiff{{Column: "cost", Old: "31", New: "32"}}}) {
+		t.Fatalf("unexpected changed %+v", diff.Changed)
+	}
+
+	payload, err := json.Marshal(diffs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded VersionDiff
+	if err := json.Unmarshal(payload, &decoded); err != nil || !reflect.DeepEqual(&decoded, diffs[0]) {
+		t.Fatalf("json round trip %s %v", payload, err)
+	}
+
+	// 校验重读同样产生差异，没有改变不产生
+	writeDiff("1\ta\t15\t\n")
+	if _, err := m.ReloadValidated(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ReloadValidated(); err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || len(diffs[1].Tables[0].Removed) != 3 {
+		t.Fatalf("unexpected diffs %+v", diffs)
+	}
+}
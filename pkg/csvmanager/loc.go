@@ -0,0 +1,270 @@
+package csvmanager
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"joynova.com/library/supernova/pkg/csvmanager/csv"
+)
+
+// 多语言：每种语言一张字符串表，用LocTable创建，文件需要id、text、region、zone_id四列，例如：
+//
+//	id         text                   region  zone_id
+//	item_1     铁剑
+//	item_1     鐵劍                   tw
+//	welcome    欢迎{name}来到{zone}服
+//
+// region、zone_id和其他表一样按区服过滤，同一id指定了zone_id的行覆盖指定了region的行，再覆盖通用行。
+// 其他表的字符串字段加上loc:"true"标签表示值是文本id，CheckAllCsvCanLoad校验每种语言都有这个id，
+// 空字符串表示没有文本，不做校验
+const locTag = "loc"
+
+// LocString 多语言字符串表的一行
+type LocString struct {
+	ID     string `csv:"id"`
+	Text   string `csv:"text"`
+	Region string `csv:"region"`
+	ZoneID string `csv:"zone_id"`
+}
+
+// LocConfig 多语言配置
+type LocConfig struct {
+	Languages map[string]int      // 语言对应的字符串表序号
+	Fallbacks map[string][]string // 语言中找不到时依次查找的语言，例如"zh-TW": {"zh-CN"}
+	Default   string              // 最后查找的语言，为空时不查找
+}
+
+// LocTable 多语言字符串表的元数据，额外数据为区服过滤并覆盖之后的id到文本的映射
+func LocTable(no int, file string) *TableMetaData {
+	return &TableMetaData{No: no, St: LocString{}, File: file, ExtraDataGenFun: buildLocTexts}
+}
+
+// locPriority 指定了区服的行优先于指定了地区的行，再优先于通用行
+func locPriority(s *LocString) int {
+	if s.ZoneID != "" {
+		return 2
+	}
+	if s.Region != "" {
+		return 1
+	}
+	return 0
+}
+
+func buildLocTexts(rows []interface{}) (interface{}, error) {
+	texts := make(map[string]string, len(rows))
+	priorities := make(map[string]int, len(rows))
+	for _, row := range rows {
+		s := row.(*LocString)
+		priority := locPriority(s)
+		old, find := priorities[s.ID]
+		if find && old == priority {
+			return nil, fmt.Errorf("文本id[%v]重复", s.ID)
+		}
+		if find && old > priority {
+			continue
+		}
+		priorities[s.ID] = priority
+		texts[s.ID] = s.Text
+	}
+	return texts, nil
+}
+
+// SetLocalization 设置多语言配置，语言的字符串表需要已经注册
+func (m *CsvManager) SetLocalization(config *LocConfig) error {
+	for lang, no := range config.Languages {
+		table, find := m.tableMetaData(no)
+		if !find {
+			return fmt.Errorf("语言[%v]的字符串表[%v]没有注册", lang, no)
+		}
+		if reflect.TypeOf(table.St) != reflect.TypeOf(LocString{}) {
+			return fmt.Errorf("语言[%v]的字符串表[%v]结构体不是LocString", lang, filepath.Base(table.File))
+		}
+	}
+	if _, find := config.Languages[config.Default]; config.Default != "" && !find {
+		return fmt.Errorf("默认语言[%v]没有字符串表", config.Default)
+	}
+	for lang, fallbacks := range config.Fallbacks {
+		for _, fallback := range fallbacks {
+			if _, find := config.Languages[fallback]; !find {
+				return fmt.Errorf("语言[%v]的回退语言[%v]没有字符串表", lang, fallback)
+			}
+		}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.loc = config
+	return nil
+}
+
+func (m *CsvManager) locConfig() *LocConfig {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.loc
+}
+
+// chain 查找lang的语言顺序：lang、回退语言、默认语言
+func (c *LocConfig) chain(lang string) []string {
+	list := append([]string{lang}, c.Fallbacks[lang]...)
+	if c.Default != "" {
+		list = append(list, c.Default)
+	}
+	ret := make([]string, 0, len(list))
+	for _, l := range list {
+		if indexOf(ret, l) < 0 {
+			ret = append(ret, l)
+		}
+	}
+	return ret
+}
+
+// locTexts 区服某种语言的文本
+func (m *CsvZoneManager) locTexts(config *LocConfig, lang string) (map[string]string, bool) {
+	no, find := config.Languages[lang]
+	if !find {
+		return nil, false
+	}
+	meta, find := m.csvManager.tableMetaData(no)
+	if !find {
+		return nil, false
+	}
+	table, _, find := m.GetTable(meta)
+	if !find {
+		return nil, false
+	}
+	texts, ok := table.GetExtraData().(map[string]string)
+	return texts, ok
+}
+
+// LocText 查找区服的多语言文本，依次查找lang、lang的回退语言、默认语言，都找不到返回false
+func (m *CsvZoneManager) LocText(lang string, id string) (string, bool) {
+	config := m.csvManager.locConfig()
+	if config == nil {
+		return "", false
+	}
+	for _, l := range config.chain(lang) {
+		texts, find := m.locTexts(config, l)
+		if !find {
+			continue
+		}
+		if text, find := texts[id]; find {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// LocFormat 查找多语言文本并替换占位符，找不到文本时返回id
+func (m *CsvZoneManager) LocFormat(lang string, id string, args map[string]interface{}) string {
+	text, find := m.LocText(lang, id)
+	if !find {
+		return id
+	}
+	return FormatLoc(text, args)
+}
+
+// FormatLoc 替换文本中的{name}占位符，args中没有的占位符保留原样，{{和}}分别输出{和}
+func FormatLoc(text string, args map[string]interface{}) string {
+	if !strings.ContainsAny(text, "{}") {
+		return text
+	}
+	b := new(strings.Builder)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if (c == '{' || c == '}') && i+1 < len(text) && text[i+1] == c {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		if c != '{' {
+			b.WriteByte(c)
+			continue
+		}
+		end := strings.IndexByte(text[i+1:], '}')
+		if end < 0 {
+			b.WriteString(text[i:])
+			break
+		}
+		name := text[i+1 : i+1+end]
+		if v, find := args[name]; find {
+			fmt.Fprint(b, v)
+		} else {
+			b.WriteString(text[i : i+2+end])
+		}
+		i += end + 1
+	}
+	return b.String()
+}
+
+// checkLocKeys 按区服校验所有loc标签的文本id在每种语言中都存在，一次返回所有错误
+func (m *CsvManager) checkLocKeys() error {
+	config := m.locConfig()
+	if config == nil || len(config.Languages) <= 0 {
+		return nil
+	}
+	langs := make([]string, 0, len(config.Languages))
+	for lang := range config.Languages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	locTables := make([]*TableMetaData, 0)
+	for _, v := range sortedTables(m.tablesMetaData()) {
+		if len(collectTags(reflect.TypeOf(v.St), locTag, nil)) > 0 {
+			locTables = append(locTables, v)
+		}
+	}
+
+	errs := make(csv.RowErrors, 0)
+	reported := make(map[csv.RowError]bool)
+	for _, zone := range m.zones() {
+		zm, find := m.GetZoneCsvManager(zone)
+		if !find {
+			return fmt.Errorf("校验多语言文本没有找到区服[%v]", zone)
+		}
+		texts := make(map[string]map[string]string, len(langs))
+		for _, lang := range langs {
+			t, find := zm.locTexts(config, lang)
+			if !find {
+				return fmt.Errorf("校验多语言文本读取语言[%v]失败", lang)
+			}
+			texts[lang] = t
+		}
+
+		for _, v := range locTables {
+			table, _, find := zm.GetTable(v)
+			if !find {
+				return fmt.Errorf("校验多语言文本读取表[%v]失败", filepath.Base(v.File))
+			}
+			for i, row := range table.Records() {
+				walkRowTag(reflect.ValueOf(row), locTag, func(column, _ string, value reflect.Value) {
+					if value.Kind() != reflect.String || value.String() == "" {
+						return
+					}
+					for _, lang := range langs {
+						if _, find := texts[lang][value.String()]; find {
+							continue
+						}
+						// 多个区服的同一行只报告一次
+						key := csv.RowError{File: filepath.Base(v.File), Line: table.Line(i), Column: column,
+							Value: value.String(), Reason: lang}
+						if reported[key] {
+							continue
+						}
+						reported[key] = true
+						e := key
+						e.Reason = fmt.Sprintf("区服[%v]语言[%v]中没有文本", zone, lang)
+						errs = append(errs, &e)
+					}
+				})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
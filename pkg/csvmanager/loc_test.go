@@ -0,0 +1,92 @@
+package csvmanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"joynova.com/library/supernova/pkg/csvmanager/csv"
+)
+
+type locItem struct {
+	ID   int32    `csv:"id" index:"true"`
+	Name string   `csv:"name" loc:"true"`
+	Tips []string `csv:"tips" loc:"true"`
+}
+
+func TestLocalization(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"zh.csv": "string\tstring\tstring\tstring\nid\ttext\tregion\tzone_id\n" +
+			"item_1\t铁剑\t\t\n" +
+			"item_1\t鐵劍\ttw\t\n" +
+			"item_1\t二区铁剑\t\t2\n" +
+			"welcome\t欢迎{name}来到{zone}服{{{x}}}\t\t\n",
+		"en.csv": "string\tstring\tstring\tstring\nid\ttext\tregion\tzone_id\n" +
+			"item_1\tSword\t\t\n" +
+			"tip\tHint\t\t\n",
+		"item.csv": "int\tstring\t[]string\nid\tname\ttips\n" +
+			"1\titem_1\ttip\n2\t\t\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tables := map[int]*TableMetaData{
+		1: LocTable(1, "zh.csv"),
+		2: LocTable(2, "en.csv"),
+		3: {No: 3, St: locItem{}, File: "item.csv"},
+	}
+	m, err := NewSpecMeta("tw", []int{1, 2}, dir, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &LocConfig{
+		Languages: map[string]int{"zh": 1, "en": 2},
+		Fallbacks: map[string][]string{"zh": {"en"}},
+		Default:   "en",
+	}
+	if err := m.SetLocalization(&LocConfig{Languages: map[string]int{"zh": 3}}); err == nil {
+		t.Fatal("expect non LocString table error")
+	}
+	if err := m.SetLocalization(config); err != nil {
+		t.Fatal(err)
+	}
+
+	zm1, _ := m.GetZoneCsvManager(1)
+	zm2, _ := m.GetZoneCsvManager(2)
+	if text, find := zm1.LocText("zh", "item_1"); !find || text != "鐵劍" {
+		t.Fatalf("region override %v", text)
+	}
+	if text, find := zm2.LocText("zh", "item_1"); !find || text != "二区铁剑" {
+		t.Fatalf("zone override %v", text)
+	}
+	if text, find := zm1.LocText("zh", "tip"); !find || text != "Hint" {
+		t.Fatalf("fallback %v", text)
+	}
+	if text, find := zm1.LocText("fr", "item_1"); !find || text != "Sword" {
+		t.Fatalf("default language %v", text)
+	}
+	if _, find := zm1.LocText("zh", "none"); find {
+		t.Fatal("missing text should not be found")
+	}
+	if got := zm1.LocFormat("zh", "welcome", map[string]interface{}{"name": "A", "zone": 1}); got != "欢迎A来到1服{{x}}" {
+		t.Fatalf("format %v", got)
+	}
+	if got := zm1.LocFormat("zh", "none", nil); got != "none" {
+		t.Fatalf("format missing %v", got)
+	}
+	if got := FormatLoc("{a}{b}{", map[string]interface{}{"a": 1}); got != "1{b}{" {
+		t.Fatalf("format %v", got)
+	}
+
+	err = m.CheckAllCsvCanLoad(true)
+	errs, ok := err.(csv.RowErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("expect 1 missing text error, got %v", err)
+	}
+	if errs[0].File != "item.csv" || errs[0].Line != 3 || errs[0].Column != "tips" || errs[0].Value != "tip" {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"io/fs"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	"joynova.com/library/supernova/pkg/csvmanager/csv"
 	"joynova.com/library/supernova/pkg/csvmanager/utils"
+	"joynova.com/library/supernova/pkg/jlog"
 )
 
 var defaultAllTablesMetaData = map[int]*TableMetaData{}
@@ -18,6 +21,9 @@ type TableMetaData struct {
 	St              interface{}                              // 表结构体
 	File            string                                   // 文件全路径
 	ExtraDataGenFun func([]interface{}) (interface{}, error) // 额外生成表数据的函数
+	Name            string                                   // 表名，用于ref标签引用，为空时取文件名去掉扩展名
+	TableCheckFun   func([]interface{}) error                // 表级校验函数，所有行解析完成后按区服调用
+	Loader          csv.SourceLoader                         // 文件格式，为nil时按扩展名选择，xlsx、json、yaml之外都按csv读取
 }
 
 func (d *TableMetaData) Register() *TableMetaData {
@@ -25,6 +31,24 @@ func (d *TableMetaData) Register() *TableMetaData {
 	return d
 }
 
+// RegisteredTables Register注册的所有表元数据，例如导入csvgen生成的包之后的所有表
+func RegisteredTables() map[int]*TableMetaData {
+	tables := make(map[int]*TableMetaData, len(defaultAllTablesMetaData))
+	for k, v := range defaultAllTablesMetaData {
+		tables[k] = v
+	}
+	return tables
+}
+
+// TableName 表名，ref标签使用表名引用其他表
+func (d *TableMetaData) TableName() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	base := filepath.Base(d.File)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
 func GetTableMetaDataByFileName(file string) *TableMetaData {
 	for _, v := range defaultAllTablesMetaData {
 		if v.File == file {
@@ -50,13 +74,28 @@ type CsvManager struct {
 	tablesMD5    map[int]string
 	zonesManager *sync.Map
 	lock         *sync.Mutex
+	reloadLock   *sync.Mutex
+	subscribers  []func(event *ReloadEvent)
+	snapshotRefs map[*CsvZoneManager]int // 被快照引用的区服管理器和引用计数
+
+	diffSubscribers []func(diff *VersionDiff)
+	diffSources     map[int]*csv.SourceData // 行级对比的基准，SubscribeDiff之后才记录，由reloadLock保护
+	compiled        map[int]*compiledTable  // 预编译快照中可以使用的表
+	zoneSubscribers []func(event *ZoneEvent)
+	loc             *LocConfig // 多语言配置
+}
+
+// ReloadEvent 配置表版本切换事件
+type ReloadEvent struct {
+	Version int   // 切换后的版本号
+	Changed []int // 内容改变的表序号
 }
 
 func SetOpenFileFunc(f func(string) (fs.File, error)) {
 	utils.OpenFileFunc = f
 }
 
-// New 创建一个配置表管理器，指定region、zones、tables，不支持zones、tables动态改变
+// New 创建一个配置表管理器，指定region、zones、tables，运行时增删区服、注册新表见AddZone、RemoveZone、RegisterTable
 func New(region string, zones []int, path string) (*CsvManager, error) {
 	return NewSpecMeta(region, zones, path, defaultAllTablesMetaData)
 }
@@ -81,6 +120,8 @@ func NewSpecMeta(region string, zones []int, path string, tables map[int]*TableM
 	m.tablesMD5 = make(map[int]string)
 	m.zonesManager = new(sync.Map)
 	m.lock = new(sync.Mutex)
+	m.reloadLock = new(sync.Mutex)
+	m.snapshotRefs = make(map[*CsvZoneManager]int)
 	err := m.ReloadRefresh()
 	return m, err
 }
@@ -92,15 +133,115 @@ func (m *CsvManager) RegisterAfterLoadLogic(id int, f func(manager *CsvZoneManag
 
 // ReloadRefresh 重读设置状态，清空md5改变的配置表数据，等待下次使用时加载最新的数据
 func (m *CsvManager) ReloadRefresh() error {
+	// 防止多个重读操作并发
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+
 	// 计算当前所有文件的md5
-	allFilesNewMD5, err := m.md5AllFiles()
+	allFilesNewMD5, err := m.md5AllFiles(m.dataPath())
 	if err != nil {
 		return err
 	}
 
+	m.switchVersion(m.dataPath(), allFilesNewMD5, nil)
+	return nil
+}
+
+// ReloadValidated 校验式重读，先在旁路完整读取md5改变的表，全部读取成功之后才切换到新版本，
+// 任意一张表读取失败则保留当前版本并返回错误，没有表改变时不切换版本
+func (m *CsvManager) ReloadValidated() (changed []int, err error) {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+	return m.reloadValidated(m.dataPath())
+}
+
+// reloadFrom 从dir目录校验式重读，成功后切换配置表目录，用于按版本目录发布的场景
+func (m *CsvManager) reloadFrom(dir string) (changed []int, err error) {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+	return m.reloadValidated(parseGamedataPath(dir))
+}
+
+// reloadValidated 从path目录校验式重读，成功后配置表目录切换为path
+func (m *CsvManager) reloadValidated(path string) (changed []int, err error) {
+	allFilesNewMD5, err := m.md5AllFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	changed = m.changedTables(allFilesNewMD5)
+	if len(changed) <= 0 {
+		m.lock.Lock()
+		m.MetaData.Path = path
+		m.lock.Unlock()
+		return nil, nil
+	}
+
+	loaded := make(map[int][]*csv.CsvTable, len(changed))
+	var errs csv.RowErrors
+	for _, no := range changed {
+		table, _ := m.tableMetaData(no)
+		csvZonesData, err := m.readCsv(path, m.MetaData.Zones, table)
+		if err != nil {
+			errs = csv.AppendRowErrors(errs, filepath.Base(table.File), err)
+			continue
+		}
+		loaded[no] = csvZonesData
+	}
+	if len(errs) > 0 {
+		jlog.Errorf("校验重读失败，保留版本[%v]", m.Version())
+		return changed, errs
+	}
+
+	// 读取过程中文件可能再次被改写，读到的数据和md5对应不上，放弃这次切换等待下次重读
+	checkMD5, err := m.md5AllFiles(path)
+	if err != nil {
+		return changed, err
+	}
+	for _, no := range changed {
+		if checkMD5[no] != allFilesNewMD5[no] {
+			table, _ := m.tableMetaData(no)
+			return changed, fmt.Errorf("表[%v]在校验重读过程中被修改", filepath.Base(table.File))
+		}
+	}
+
+	m.switchVersion(path, allFilesNewMD5, loaded)
+	return changed, nil
+}
+
+// Version 当前配置表版本号，每次重读切换加1
+func (m *CsvManager) Version() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.version
+}
+
+// zones 当前所有区服，区服列表只在持有reloadLock和lock时整体替换
+func (m *CsvManager) zones() []int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.MetaData.Zones
+}
+
+// dataPath 当前版本的配置表目录
+func (m *CsvManager) dataPath() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.MetaData.Path
+}
+
+// Subscribe 订阅配置表版本切换事件，切换完成后回调，可用于重建依赖配置表的缓存数据
+func (m *CsvManager) Subscribe(f func(event *ReloadEvent)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.subscribers = append(m.subscribers, f)
+}
+
+// switchVersion 以新的md5生成新版本的区服管理器，md5没改变的表沿用旧数据，loaded为已经预先读取好的表数据，
+// path为新版本的配置表目录
+func (m *CsvManager) switchVersion(path string, allFilesNewMD5 map[int]string, loaded map[int][]*csv.CsvTable) {
 	newZonesManager := make([]*CsvZoneManager, 0, len(m.MetaData.Zones))
 
-	for _, z := range m.MetaData.Zones {
+	for i, z := range m.MetaData.Zones {
 		zm := newCsvZoneManager(z, m)
 
 		// 将md5没改变的表旧数据放入
@@ -117,24 +258,65 @@ func (m *CsvManager) ReloadRefresh() error {
 				}
 			}
 		}
+		for k, zonesData := range loaded {
+			zm.tables.Store(k, zonesData[i])
+		}
 		newZonesManager = append(newZonesManager, zm)
 	}
 
-	// 防止多个重读操作并发，将以下操作原子化
-	m.lock.Lock()
-	defer m.lock.Unlock()
+	changed := m.changedTables(allFilesNewMD5)
+	// 版本号只在持有reloadLock时改变
+	diff := m.diffTables(path, m.Version()+1, changed)
 
+	// 将以下操作原子化
+	m.lock.Lock()
 	if allFilesNewMD5 != nil {
 		m.tablesMD5 = allFilesNewMD5
 	}
 	m.version += 1
+	m.MetaData.Path = path
 
 	for _, zm := range newZonesManager {
 		// 重新插入空的区服表数据数据
 		zm.version = m.version
+		zm.tablesMD5 = m.tablesMD5
+		oldZm, find := m.zonesManager.Load(zm.Zone)
 		m.zonesManager.Store(zm.Zone, zm)
+		if find && m.snapshotRefs[oldZm.(*CsvZoneManager)] <= 0 {
+			// 旧版本没有快照引用，直接释放
+			oldZm.(*CsvZoneManager).release()
+		}
+	}
+	event := &ReloadEvent{Version: m.version, Changed: changed}
+	subscribers := append([]func(event *ReloadEvent){}, m.subscribers...)
+	diffSubscribers := append([]func(diff *VersionDiff){}, m.diffSubscribers...)
+	m.lock.Unlock()
+
+	for _, f := range subscribers {
+		notifyReloadEvent(f, event)
+	}
+	if diff != nil {
+		for _, f := range diffSubscribers {
+			notifyDiff(f, diff)
+		}
 	}
-	return nil
+}
+
+// changedTables md5和当前版本不一致的表序号，从小到大排序
+func (m *CsvManager) changedTables(allFilesNewMD5 map[int]string) []int {
+	changed := make([]int, 0)
+	for k, newMD5 := range allFilesNewMD5 {
+		if m.tablesMD5[k] != newMD5 {
+			changed = append(changed, k)
+		}
+	}
+	sort.Ints(changed)
+	return changed
+}
+
+func notifyReloadEvent(f func(event *ReloadEvent), event *ReloadEvent) {
+	defer jlog.CatchWithInfo(fmt.Sprintf("配置表版本[%v]切换回调", event.Version))
+	f(event)
 }
 
 func (m *CsvManager) GetZoneCsvManager(zone int) (*CsvZoneManager, bool) {
@@ -145,72 +327,116 @@ func (m *CsvManager) GetZoneCsvManager(zone int) (*CsvZoneManager, bool) {
 	return nil, false
 }
 
-// LoadAllCsv 加载所有配置表，只用于校验
+// CheckAllCsvCanLoad 加载所有配置表，并校验ref标签的跨表引用和loc标签的多语言文本，只用于校验
 func (m *CsvManager) CheckAllCsvCanLoad(clone bool) error {
 	var newM = m
 	if clone {
 		var err error
-		newM, err = New(m.MetaData.Region, m.MetaData.Zones, m.MetaData.Path)
+		newM, err = NewSpecMeta(m.MetaData.Region, m.zones(), m.dataPath(), m.tablesMetaData())
 		if err != nil {
 			return err
 		}
+		newM.loc = m.locConfig()
 	}
-	for _, v := range newM.MetaData.TablesMetaData {
-		err := newM.loadCsv(v.Data)
+	// 读取所有表，一次报告所有表的错误
+	var errs csv.RowErrors
+	for _, v := range sortedTables(newM.tablesMetaData()) {
+		err := newM.loadCsv(v)
 		if err != nil {
-			return err
+			errs = csv.AppendRowErrors(errs, filepath.Base(v.File), err)
 		}
 	}
-	return nil
+	if len(errs) > 0 {
+		return errs
+	}
+	if err := newM.checkRefs(); err != nil {
+		return err
+	}
+	return newM.checkLocKeys()
 }
 
-// loadCsv 读取某个csv文件
+// tablesMetaData 管理器的所有表元数据
+func (m *CsvManager) tablesMetaData() map[int]*TableMetaData {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	tables := make(map[int]*TableMetaData, len(m.MetaData.TablesMetaData))
+	for k, v := range m.MetaData.TablesMetaData {
+		tables[k] = v.Data
+	}
+	return tables
+}
+
+// tableMetaData 一张表的元数据
+func (m *CsvManager) tableMetaData(no int) (*TableMetaData, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	meta, find := m.MetaData.TablesMetaData[no]
+	return meta.Data, find
+}
+
+// loadCsv 读取某个csv文件，只读取还没有这张表数据的区服
 func (m *CsvManager) loadCsv(table *TableMetaData) error {
-	_, find := m.MetaData.TablesMetaData[table.No]
+	m.lock.Lock()
+	meta, find := m.MetaData.TablesMetaData[table.No]
+	m.lock.Unlock()
 	if !find {
-		return fmt.Errorf("初始化csv列表中没有table[%v]，不支持动态新增配置表", filepath.Base(table.File))
+		return fmt.Errorf("csv列表中没有table[%v]，运行时新增配置表使用RegisterTable", filepath.Base(table.File))
 	}
 
 	// 锁住这个表的读取事件
-	l := m.MetaData.TablesMetaData[table.No].Lock
+	l := meta.Lock
 	l.Lock()
 	defer l.Unlock()
 
-	// double check
-	tmpZm, find := m.GetZoneCsvManager(m.MetaData.Zones[0])
-	if !find {
-		return fmt.Errorf("读取表[%v]之前尝试再次检查zone是否已经读取过数据没有找到zone[%v]",
-			filepath.Base(table.File), m.MetaData.Zones[0])
+	// double check，运行时新增的区服也在这里补读
+	zones := m.zones()
+	missing := make([]int, 0, len(zones))
+	for _, z := range zones {
+		zm, find := m.GetZoneCsvManager(z)
+		if !find {
+			return fmt.Errorf("读取表[%v]之前尝试再次检查zone是否已经读取过数据没有找到zone[%v]",
+				filepath.Base(table.File), z)
+		}
+		if _, find := zm.getTable(table.No); !find {
+			missing = append(missing, z)
+		}
 	}
-	_, find = tmpZm.getTable(table.No)
-	if find {
+	if len(missing) <= 0 {
 		// 找到配置表数据，不需要重新读取
 		return nil
 	}
 
-	csvZonesData, err :=
-		csv.ReadCsv(m.MetaData.Region, m.MetaData.Zones, m.MetaData.Path+table.File, table.St, table.ExtraDataGenFun)
-	if err != nil {
-		panic(fmt.Errorf("读取csv表[%v]错误:%v", filepath.Base(table.File), err))
+	csvZonesData, ok := m.readCompiled(table, missing)
+	if !ok {
+		var err error
+		csvZonesData, err = m.readCsv(m.dataPath(), missing, table)
+		if err != nil {
+			return err
+		}
 	}
 	for i, v := range csvZonesData {
-		zm, find := m.GetZoneCsvManager(m.MetaData.Zones[i])
+		zm, find := m.GetZoneCsvManager(missing[i])
 		if !find {
-			panic(fmt.Errorf("读取csv表[%v]数据，查找当前manager区服[%v]时没找到", filepath.Base(table.File), m.MetaData.Zones[i]))
+			return fmt.Errorf("读取csv表[%v]数据，查找当前manager区服[%v]时没找到", filepath.Base(table.File), missing[i])
 		}
 		zm.tables.Store(table.No, v)
-		m.zonesManager.Store(m.MetaData.Zones[i], zm)
 	}
 	return nil
 }
 
-// md5AllFiles 计算所有csv文件的md5
-func (m *CsvManager) md5AllFiles() (map[int]string, error) {
+// readCsv 读取path目录下表文件指定区服的数据
+func (m *CsvManager) readCsv(path string, zones []int, table *TableMetaData) ([]*csv.CsvTable, error) {
+	return csv.ReadSource(m.MetaData.Region, zones, path+table.File, table.Loader, table.St,
+		table.ExtraDataGenFun, table.TableCheckFun)
+}
+
+// md5AllFiles 计算path目录下所有csv文件的md5
+func (m *CsvManager) md5AllFiles(path string) (map[int]string, error) {
 	newMD5Map := make(map[int]string)
-	for k, v := range m.MetaData.TablesMetaData {
-		newMD5, _, err := utils.CheckMD5(m.MetaData.Path+v.Data.File, "")
+	for k, v := range m.tablesMetaData() {
+		newMD5, _, err := utils.CheckMD5(path+v.File, "")
 		if err != nil {
-			return nil, fmt.Errorf("校验文件[%v]md5错误:%v", filepath.Base(v.Data.File), err)
+			return nil, fmt.Errorf("校验文件[%v]md5错误:%v", filepath.Base(v.File), err)
 		}
 		newMD5Map[k] = newMD5
 	}
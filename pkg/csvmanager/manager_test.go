@@ -2,10 +2,15 @@ package csvmanager
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"joynova.com/library/supernova/pkg/csvmanager/csv"
 )
 
 type ChargeConfigData struct {
@@ -191,3 +196,361 @@ func TestManager(t *testing.T) {
 		fmt.Printf("%v\n", data.ChargeID)
 	})
 }
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	writeWatchTestFile(t, dir+"/a.csv", "1\ta\n")
+	writeWatchTestFile(t, dir+"/b.csv", "1\tb\n")
+	writeWatchTestFile(t, dir+"/c.csv", "1\tc\n")
+	metaA := &TableMetaData{No: 1, St: watchTestData{}, File: "a.csv"}
+	metaB := &TableMetaData{No: 2, St: watchTestData{}, File: "b.csv"}
+	metaC := &TableMetaData{No: 3, St: watchTestData{}, File: "c.csv"}
+	m, err := NewSpecMeta("1", []int{1}, dir, map[int]*TableMetaData{1: metaA, 2: metaB, 3: metaC})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zm, _ := m.GetZoneCsvManager(1)
+	snapshot := zm.Snapshot()
+	a, err := snapshot.GetTable(metaA)
+	if err != nil || a.Index(1).(*watchTestData).Name != "a" {
+		t.Fatalf("read a %v", err)
+	}
+
+	writeWatchTestFile(t, dir+"/a.csv", "1\ta2\n")
+	writeWatchTestFile(t, dir+"/b.csv", "1\tb2\n")
+	if _, err := m.ReloadValidated(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 快照内读到的还是旧版本
+	a, err = snapshot.GetTable(metaA)
+	if err != nil || a.Index(1).(*watchTestData).Name != "a" {
+		t.Fatalf("snapshot read a %v", err)
+	}
+	// b在旧版本没读取过，文件已经改变
+	if _, err := snapshot.GetTable(metaB); err != ErrSnapshotStale {
+		t.Fatalf("expect stale, got %v", err)
+	}
+	// c没有改变，可以读取
+	c, err := snapshot.GetTable(metaC)
+	if err != nil || c.Index(1).(*watchTestData).Name != "c" {
+		t.Fatalf("snapshot read c %v", err)
+	}
+	if refs := m.RetainedVersions(); refs[1] != 1 || len(refs) != 1 {
+		t.Fatalf("retained versions %v", refs)
+	}
+
+	snapshot.Release()
+	snapshot.Release()
+	if refs := m.RetainedVersions(); len(refs) != 0 {
+		t.Fatalf("retained versions after release %v", refs)
+	}
+	if _, find := zm.getTable(metaA.No); find {
+		t.Fatal("old version not released")
+	}
+	if _, err := snapshot.GetTable(metaA); err != ErrSnapshotReleased {
+		t.Fatalf("expect released, got %v", err)
+	}
+
+	cur, _ := m.GetZoneCsvManager(1)
+	newSnapshot := cur.Snapshot()
+	defer newSnapshot.Release()
+	a, err = newSnapshot.GetTable(metaA)
+	if err != nil || newSnapshot.Version() != 2 || a.Index(1).(*watchTestData).Name != "a2" {
+		t.Fatalf("new snapshot read a %v", err)
+	}
+}
+
+type refItemData struct {
+	ID   int32  `csv:"id" index:"true"`
+	Name string `csv:"name"`
+}
+
+type refRewardItem struct {
+	ItemID int64 `ref:"item.id"`
+	Amount int32
+}
+
+func (r *refRewardItem) Parse(text string) error {
+	_, err := fmt.Sscanf(text, "%d:%d", &r.ItemID, &r.Amount)
+	return err
+}
+
+type refShopData struct {
+	ID      int32            `csv:"id" index:"true"`
+	ItemID  int32            `csv:"item_id" ref:"item.id"`
+	Gifts   []int32          `csv:"gifts" ref:"item.id"`
+	Rewards []*refRewardItem `csv:"rewards"`
+}
+
+func TestCheckRefs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"item.csv": "int\tstring\tstring\nid\tname\tzone_id\n1\ta\t\n2\tb\t\n3\tc\t1\n",
+		"shop.csv": "int\tint\tstring\tstring\nid\titem_id\tgifts\trewards\n" +
+			"1\t1\t1,2\t1:10,2:1\n" +
+			"2\t9\t\t\n" +
+			"3\t0\t2,8\t7:1\n" +
+			"4\t3\t\t\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tables := map[int]*TableMetaData{
+		1: {No: 1, St: refItemData{}, File: "item.csv"},
+		2: {No: 2, St: refShopData{}, File: "shop.csv"},
+	}
+	m, err := NewSpecMeta("1", []int{1, 2}, dir, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.CheckAllCsvCanLoad(true)
+	errs, ok := err.(csv.RowErrors)
+	if !ok {
+		t.Fatalf("expect row errors, got %v", err)
+	}
+	got := make([]string, 0, len(errs))
+	for _, e := range errs {
+		got = append(got, fmt.Sprintf("%v:%v:%v:%v", e.File, e.Line, e.Column, e.Value))
+	}
+	// 3号道具只在1区存在，2区的第4条数据引用错误
+	want := []string{"shop.csv:4:item_id:9", "shop.csv:5:gifts:8", "shop.csv:5:rewards:7", "shop.csv:6:item_id:3"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v\n%v", got, err)
+	}
+
+	tables[2].St = struct {
+		ID int32 `csv:"id" ref:"goods.id"`
+	}{}
+	m, err = NewSpecMeta("1", []int{1}, dir, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CheckAllCsvCanLoad(false); err == nil || !strings.Contains(err.Error(), "goods") {
+		t.Fatalf("expect unknown table error, got %v", err)
+	}
+}
+
+func TestLoadErrorsReport(t *testing.T) {
+	dir := t.TempDir()
+	writeWatchTestFile(t, dir+"/a.csv", "1\ta\nx\tb\n")
+	writeWatchTestFile(t, dir+"/b.csv", "1\tb\n2\tb\n")
+	metaA := &TableMetaData{No: 1, St: watchTestData{}, File: "a.csv"}
+	metaB := &TableMetaData{No: 2, St: watchTestData{}, File: "b.csv", TableCheckFun: func(rows []interface{}) error {
+		if len(rows) > 1 {
+			return fmt.Errorf("最多一行")
+		}
+		return nil
+	}}
+	m, err := NewSpecMeta("1", []int{1}, dir, map[int]*TableMetaData{1: metaA, 2: metaB})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.CheckAllCsvCanLoad(false)
+	errs, ok := err.(csv.RowErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expect 2 errors, got %v", err)
+	}
+	if errs[0].File != "a.csv" || errs[0].Line != 4 || errs[0].Column != "id" || errs[0].Value != "x" {
+		t.Fatalf("unexpected row error %+v", errs[0])
+	}
+	if errs[1].File != "b.csv" || !strings.Contains(errs[1].Reason, "最多一行") {
+		t.Fatalf("unexpected table error %+v", errs[1])
+	}
+
+	// 读取失败不再panic
+	zm, _ := m.GetZoneCsvManager(1)
+	if _, _, find := zm.GetTable(metaA); find {
+		t.Fatal("bad table should not be found")
+	}
+}
+
+type typedTestData struct {
+	ID    uint32 `csv:"id" index:"true"`
+	Kind  int16  `csv:"kind" group:"true"`
+	Shop  string `csv:"shop" union:"shop" unionu:"slot"`
+	Slot  uint8  `csv:"slot" union:"shop" unionu:"slot"`
+	Valid bool   `csv:"valid" group:"true"`
+}
+
+func TestTypedTable(t *testing.T) {
+	dir := t.TempDir()
+	content := "int\tint\tstring\tint\tbool\nid\tkind\tshop\tslot\tvalid\n" +
+		"1\t1\ta\t1\ttrue\n2\t1\ta\t2\tfalse\n3\t2\tb\t1\ttrue\n"
+	if err := os.WriteFile(filepath.Join(dir, "typed.csv"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta := Typed[typedTestData](&TableMetaData{No: 1, File: "typed.csv"})
+	m, err := NewSpecMeta("1", []int{1}, dir, map[int]*TableMetaData{1: meta.TableMetaData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zm, _ := m.GetZoneCsvManager(1)
+	table, find := meta.From(zm)
+	if !find {
+		t.Fatal("table not found")
+	}
+
+	for _, key := range []interface{}{uint32(2), 2, int64(2), uint8(2)} {
+		row, find := table.Get(key)
+		if !find || row.ID != 2 {
+			t.Fatalf("get %T key failed", key)
+		}
+	}
+	if _, find := table.Get(struct{}{}); find {
+		t.Fatal("unsupported key should not be found")
+	}
+	if rows := table.Group(0, 1); len(rows) != 2 || rows[1].ID != 2 {
+		t.Fatalf("group kind %v", rows)
+	}
+	if rows := table.Group(1, true); len(rows) != 2 || rows[1].ID != 3 {
+		t.Fatalf("group valid %v", rows)
+	}
+	if rows := table.Group(5, 1); rows != nil {
+		t.Fatalf("group out of range %v", rows)
+	}
+	if rows := table.Union("shop", "a", 2); len(rows) != 1 || rows[0].ID != 2 {
+		t.Fatalf("union %v", rows)
+	}
+	if row, find := table.UnionUnique("slot", "b", uint8(1)); !find || row.ID != 3 {
+		t.Fatalf("union unique %v", row)
+	}
+	if all := table.All(); len(all) != 3 || all[2].ID != 3 {
+		t.Fatalf("all %v", all)
+	}
+
+	snapshot := zm.Snapshot()
+	defer snapshot.Release()
+	snapshotTable, err := meta.FromSnapshot(snapshot)
+	if err != nil || snapshotTable.NumRecord() != 3 {
+		t.Fatalf("snapshot table %v", err)
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	dir := t.TempDir()
+	content := "int\tint\tstring\tint\tbool\tstring\nid\tkind\tshop\tslot\tvalid\tzone_id\n" +
+		"1\t1\ta\t1\ttrue\t\n2\t1\ta\t2\tfalse\t\n3\t2\tb\t1\ttrue\t3\n"
+	if err := os.WriteFile(filepath.Join(dir, "typed.csv"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta := Typed[typedTestData](&TableMetaData{No: 1, File: "typed.csv"})
+	m, err := NewSpecMeta("1", []int{1, 2, 3}, dir, map[int]*TableMetaData{1: meta.TableMetaData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zm, _ := m.GetZoneCsvManager(3)
+	table, find := meta.From(zm)
+	if !find || table.NumRecord() != 3 {
+		t.Fatal("table not found")
+	}
+
+	stats := m.MemoryStats()
+	if len(stats) != 1 {
+		t.Fatalf("unexpected stats %v", stats)
+	}
+	s := stats[0]
+	if s.No != 1 || s.Zones != 3 || s.SharedZones != 1 || s.OverlayZones != 1 || s.EstimatedBytes <= 0 {
+		t.Fatalf("unexpected table stats %+v", s)
+	}
+}
+
+func TestDynamicZones(t *testing.T) {
+	dir := t.TempDir()
+	content := "int\tint\tstring\tint\tbool\tstring\nid\tkind\tshop\tslot\tvalid\tzone_id\n" +
+		"1\t1\ta\t1\ttrue\t\n2\t1\ta\t2\tfalse\t2\n"
+	if err := os.WriteFile(filepath.Join(dir, "typed.csv"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "other.csv"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta := Typed[typedTestData](&TableMetaData{No: 1, File: "typed.csv"})
+	m, err := NewSpecMeta("1", []int{1}, dir, map[int]*TableMetaData{1: meta.TableMetaData})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []ZoneEvent
+	m.SubscribeZone(func(event *ZoneEvent) {
+		events = append(events, *event)
+	})
+	zm, _ := m.GetZoneCsvManager(1)
+	if table, find := meta.From(zm); !find || table.NumRecord() != 1 {
+		t.Fatal("zone 1 table not found")
+	}
+
+	if err := m.AddZone(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddZone(2); err == nil {
+		t.Fatal("expect duplicate zone error")
+	}
+	zm2, find := m.GetZoneCsvManager(2)
+	if !find || zm2.version != m.Version() {
+		t.Fatal("zone 2 not added")
+	}
+	if table, find := zm2.getTable(1); !find || table.NumRecord() != 2 {
+		t.Fatal("loaded table should be read for new zone")
+	}
+
+	other := Typed[typedTestData](&TableMetaData{No: 2, File: "other.csv"})
+	if err := m.RegisterTable(other.TableMetaData); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RegisterTable(other.TableMetaData); err == nil {
+		t.Fatal("expect duplicate table error")
+	}
+	if table, find := other.From(zm2); !find || table.NumRecord() != 2 {
+		t.Fatal("registered table not found")
+	}
+
+	snapshot := zm.Snapshot()
+	if err := m.RemoveZone(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, find := m.GetZoneCsvManager(1); find || len(m.zones()) != 1 {
+		t.Fatal("zone 1 not removed")
+	}
+	if table, err := snapshot.GetTable(meta.TableMetaData); err != nil || table.NumRecord() != 1 {
+		t.Fatalf("snapshot of removed zone %v", err)
+	}
+	snapshot.Release()
+	if _, find := zm.getTable(1); find {
+		t.Fatal("removed zone should be released")
+	}
+	if err := m.RemoveZone(1); err == nil {
+		t.Fatal("expect missing zone error")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "typed.csv"), []byte(content+"3\t1\ta\t3\ttrue\t\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddZone(3); err == nil {
+		t.Fatal("expect changed file error")
+	}
+	if _, err := m.ReloadValidated(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddZone(3); err != nil {
+		t.Fatal(err)
+	}
+	zm3, _ := m.GetZoneCsvManager(3)
+	if table, find := meta.From(zm3); !find || table.NumRecord() != 2 {
+		t.Fatal("zone 3 table not found")
+	}
+
+	want := []ZoneEvent{
+		{Type: ZoneAdded, Version: 1, Zone: 2},
+		{Type: TableRegistered, Version: 1, Table: 2},
+		{Type: ZoneRemoved, Version: 1, Zone: 1},
+		{Type: ZoneAdded, Version: 2, Zone: 3},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
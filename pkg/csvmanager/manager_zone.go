@@ -1,13 +1,16 @@
 package csvmanager
 
 import (
+	"path/filepath"
 	"sync"
 
 	"joynova.com/library/supernova/pkg/csvmanager/csv"
+	"joynova.com/library/supernova/pkg/jlog"
 )
 
 func newCsvZoneManager(zone int, csvM *CsvManager) *CsvZoneManager {
 	m := new(CsvZoneManager)
+	m.Region = csvM.MetaData.Region
 	m.Zone = zone
 	m.tables = new(sync.Map)
 	m.extraMultiTablesJoinData = new(sync.Map)
@@ -17,12 +20,14 @@ func newCsvZoneManager(zone int, csvM *CsvManager) *CsvZoneManager {
 
 type CsvZoneManager struct {
 	version                  int
+	tablesMD5                map[int]string // 这个版本所有表的md5，只读
 	Region                   string
 	Zone                     int
 	tables                   *sync.Map
 	extraMultiTablesJoinData *sync.Map
 	// 存储父类，读取配置表时可能触发重读，去调用父类重读
 	csvManager *CsvManager
+	removed    bool // 区服已经从管理器删除，由csvManager.lock保护
 }
 
 // GetTable 获取一个配置表数据，如果找不到，会进行csv文件读取，然后刷新所有区服当前表数据
@@ -41,14 +46,14 @@ func (m *CsvZoneManager) GetTable(table *TableMetaData) (tableData *csv.CsvTable
 		// 说明当前区服配置表管理器是旧版，且旧版还没有读取过当前表，使用最新版本的数据
 		// NOTE:
 		// 如果一个逻辑中使用到配置表a、b，用完a触发重读，逻辑再读取b，则a、b版本不一致，
-		// 可能出现数据不一致，但这种一个逻辑中的执行很快，可以不考虑数据不一致的情况，
-		// 且如果要做强一致必须读a、b都作为原子操作，实操比较复杂
+		// 需要a、b版本一致的逻辑使用Snapshot读取
 		data, find := curM.getTable(table.No)
 		return data, false, find
 	}
 
 	err := m.csvManager.loadCsv(table)
 	if err != nil {
+		jlog.Errorf("读取csv表[%v]错误:%v", filepath.Base(table.File), err)
 		return nil, true, false
 	}
 
@@ -77,3 +82,15 @@ func (m *CsvZoneManager) getTable(no int) (*csv.CsvTable, bool) {
 	}
 	return nil, find
 }
+
+// release 释放旧版本持有的表数据，之后再读取会使用最新版本的数据
+func (m *CsvZoneManager) release() {
+	m.tables.Range(func(key, value interface{}) bool {
+		m.tables.Delete(key)
+		return true
+	})
+	m.extraMultiTablesJoinData.Range(func(key, value interface{}) bool {
+		m.extraMultiTablesJoinData.Delete(key)
+		return true
+	})
+}
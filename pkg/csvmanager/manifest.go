@@ -0,0 +1,343 @@
+package csvmanager
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"joynova.com/library/supernova/pkg/client/dfs"
+	"joynova.com/library/supernova/pkg/jlog"
+)
+
+// Manifest 配置表发布清单，一次发布的版本号和所有文件的md5
+type Manifest struct {
+	Version string          `json:"version"`
+	Files   []*ManifestFile `json:"files"`
+}
+
+// ManifestFile 清单中的一个文件
+type ManifestFile struct {
+	Name   string `json:"name"`             // 相对配置表目录的文件路径，和TableMetaData.File一致
+	MD5    string `json:"md5"`              // 文件内容md5的十六进制
+	Object string `json:"object,omitempty"` // 存储上相对RemotePath的对象名，为空时为"版本号/文件路径"
+}
+
+// ManifestConfig 清单加载配置
+type ManifestConfig struct {
+	Handler      dfs.DFSHandler
+	RemotePath   string // 存储上清单和文件所在的目录
+	ManifestName string // 清单对象名，默认manifest.json
+	CacheDir     string // 本地缓存目录，每个版本下载到CacheDir/版本号/
+	KeepReleases int    // 本地保留的版本数，默认3，最少2个用于回滚
+}
+
+// Release 已经下载并校验过的版本
+type Release struct {
+	*Manifest
+	Dir string // 本地目录
+}
+
+// ManifestLoader 按发布清单从分布式存储加载配置表，只下载改变的文件，
+// 所有文件校验通过并且配置表完整读取成功才切换版本
+type ManifestLoader struct {
+	config   ManifestConfig
+	lock     sync.Mutex
+	releases []*Release // 应用过的版本，最后一个为当前版本
+	// 回滚掉的版本号，Sync不再应用，直到应用了其它版本
+	rolledBack map[string]bool
+}
+
+func NewManifestLoader(config ManifestConfig) (*ManifestLoader, error) {
+	if config.Handler == nil {
+		return nil, fmt.Errorf("清单加载没有设置存储")
+	}
+	if config.RemotePath == "" || config.CacheDir == "" {
+		return nil, fmt.Errorf("清单加载需要设置RemotePath和CacheDir")
+	}
+	if config.ManifestName == "" {
+		config.ManifestName = "manifest.json"
+	}
+	if config.KeepReleases < 2 {
+		config.KeepReleases = 3
+	}
+	if err := os.MkdirAll(config.CacheDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建缓存目录[%v]错误:%v", config.CacheDir, err)
+	}
+	return &ManifestLoader{config: config, rolledBack: make(map[string]bool)}, nil
+}
+
+// Current 当前应用的版本，没有应用过返回nil
+func (l *ManifestLoader) Current() *Release {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if len(l.releases) <= 0 {
+		return nil
+	}
+	return l.releases[len(l.releases)-1]
+}
+
+// Fetch 读取最新清单，下载改变的文件到本地缓存并校验md5，只下载不应用，
+// 启动时可以先Fetch，再用Release.Dir创建管理器，然后Apply记录当前版本
+func (l *ManifestLoader) Fetch() (*Release, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.fetch()
+}
+
+// Apply 把下载好的版本应用到管理器，读取失败保留管理器当前版本
+func (l *ManifestLoader) Apply(m *CsvManager, release *Release) (changed []int, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.apply(m, release)
+}
+
+// Sync 读取最新清单，版本号和当前版本不同时下载并应用，回滚掉的版本不会再次应用，
+// 发布新的版本号后恢复同步
+func (l *ManifestLoader) Sync(m *CsvManager) (changed []int, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	manifest, err := l.getManifest()
+	if err != nil {
+		return nil, err
+	}
+	if len(l.releases) > 0 && l.releases[len(l.releases)-1].Version == manifest.Version {
+		return nil, nil
+	}
+	if l.rolledBack[manifest.Version] {
+		return nil, nil
+	}
+	release, err := l.download(manifest)
+	if err != nil {
+		return nil, err
+	}
+	changed, err = l.apply(m, release)
+	if err != nil && !l.applied(release.Dir) {
+		// 读取失败的版本不保留，重新发布同一版本号时重新下载
+		os.RemoveAll(release.Dir)
+	}
+	return changed, err
+}
+
+// Rollback 回滚到上一个应用过的版本，回滚掉的版本号不会被Sync再次应用，本地目录会被删除
+func (l *ManifestLoader) Rollback(m *CsvManager) (changed []int, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.releases) < 2 {
+		return nil, fmt.Errorf("没有可以回滚的版本")
+	}
+	prev := l.releases[len(l.releases)-2]
+	// 本地文件可能被改动，重新校验
+	if err := verifyRelease(prev); err != nil {
+		return nil, fmt.Errorf("回滚版本[%v]校验失败:%v", prev.Version, err)
+	}
+	changed, err = m.reloadFrom(prev.Dir)
+	if err != nil {
+		return changed, err
+	}
+	cur := l.releases[len(l.releases)-1]
+	l.releases = l.releases[:len(l.releases)-1]
+	l.rolledBack[cur.Version] = true
+	// 回滚掉的版本不会再用，删除目录，重新发布时重新下载
+	if !l.applied(cur.Dir) {
+		if err := os.RemoveAll(cur.Dir); err != nil {
+			jlog.Warnf("删除回滚掉的配置表版本目录[%v]错误:%v", cur.Dir, err)
+		}
+	}
+	jlog.Infof("配置表从版本[%v]回滚到[%v]", cur.Version, prev.Version)
+	return changed, nil
+}
+
+func (l *ManifestLoader) fetch() (*Release, error) {
+	manifest, err := l.getManifest()
+	if err != nil {
+		return nil, err
+	}
+	return l.download(manifest)
+}
+
+func (l *ManifestLoader) apply(m *CsvManager, release *Release) (changed []int, err error) {
+	for _, table := range m.tablesMetaData() {
+		if release.file(table.File) == nil {
+			return nil, fmt.Errorf("版本[%v]清单中没有表文件[%v]", release.Version, table.File)
+		}
+	}
+	changed, err = m.reloadFrom(release.Dir)
+	if err != nil {
+		return changed, err
+	}
+	l.releases = append(l.releases, release)
+	l.rolledBack = make(map[string]bool)
+	l.prune()
+	return changed, nil
+}
+
+func (l *ManifestLoader) getManifest() (*Manifest, error) {
+	payload, err := l.config.Handler.GetObject(l.config.RemotePath, l.config.ManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("读取清单[%v]错误:%v", l.config.ManifestName, err)
+	}
+	manifest := new(Manifest)
+	if err := json.Unmarshal(payload, manifest); err != nil {
+		return nil, fmt.Errorf("解析清单[%v]错误:%v", l.config.ManifestName, err)
+	}
+	if err := manifest.check(); err != nil {
+		return nil, fmt.Errorf("清单[%v]错误:%v", l.config.ManifestName, err)
+	}
+	return manifest, nil
+}
+
+// download 下载到临时目录，全部校验通过后改名为版本目录，md5没变的文件从本地已有版本复制
+func (l *ManifestLoader) download(manifest *Manifest) (*Release, error) {
+	release := &Release{Manifest: manifest, Dir: filepath.Join(l.config.CacheDir, manifest.Version)}
+	if err := verifyRelease(release); err == nil {
+		// 之前下载过，例如回滚之后再次发布
+		return release, nil
+	}
+
+	tmpDir := release.Dir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return nil, err
+	}
+	for _, f := range manifest.Files {
+		file := filepath.Join(tmpDir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return nil, err
+		}
+		if l.copyLocal(f, file) {
+			continue
+		}
+		object := f.Object
+		if object == "" {
+			object = path.Join(manifest.Version, f.Name)
+		}
+		payload, err := l.config.Handler.GetObject(l.config.RemotePath, object)
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			return nil, fmt.Errorf("下载版本[%v]文件[%v]错误:%v", manifest.Version, f.Name, err)
+		}
+		if sum := md5Hex(payload); sum != f.MD5 {
+			os.RemoveAll(tmpDir)
+			return nil, fmt.Errorf("版本[%v]文件[%v]md5不一致，清单[%v]，下载[%v]", manifest.Version, f.Name, f.MD5, sum)
+		}
+		if err := os.WriteFile(file, payload, 0644); err != nil {
+			os.RemoveAll(tmpDir)
+			return nil, err
+		}
+	}
+
+	if err := os.RemoveAll(release.Dir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpDir, release.Dir); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// copyLocal 从当前和之前的版本查找md5相同的文件复制过来
+func (l *ManifestLoader) copyLocal(f *ManifestFile, target string) bool {
+	for i := len(l.releases) - 1; i >= 0; i-- {
+		old := l.releases[i].file(f.Name)
+		if old == nil || old.MD5 != f.MD5 {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(l.releases[i].Dir, filepath.FromSlash(f.Name)))
+		if err != nil || md5Hex(content) != f.MD5 {
+			continue
+		}
+		return os.WriteFile(target, content, 0644) == nil
+	}
+	return false
+}
+
+// prune 删除超出保留数量的旧版本目录
+func (l *ManifestLoader) prune() {
+	if len(l.releases) <= l.config.KeepReleases {
+		return
+	}
+	removed := l.releases[:len(l.releases)-l.config.KeepReleases]
+	l.releases = append([]*Release{}, l.releases[len(removed):]...)
+	for _, r := range removed {
+		if !l.applied(r.Dir) {
+			if err := os.RemoveAll(r.Dir); err != nil {
+				jlog.Warnf("删除配置表旧版本目录[%v]错误:%v", r.Dir, err)
+			}
+		}
+	}
+}
+
+// applied 目录是否被保留的版本使用
+func (l *ManifestLoader) applied(dir string) bool {
+	for _, r := range l.releases {
+		if r.Dir == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (manifest *Manifest) check() error {
+	if manifest.Version == "" || manifest.Version == "." || manifest.Version == ".." ||
+		strings.ContainsAny(manifest.Version, `/\`) || strings.HasSuffix(manifest.Version, ".tmp") {
+		return fmt.Errorf("版本号[%v]不合法", manifest.Version)
+	}
+	names := make(map[string]bool, len(manifest.Files))
+	for _, f := range manifest.Files {
+		clean := path.Clean(f.Name)
+		if f.Name == "" || clean != f.Name || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("文件路径[%v]不合法", f.Name)
+		}
+		if names[f.Name] {
+			return fmt.Errorf("文件[%v]重复", f.Name)
+		}
+		names[f.Name] = true
+		if _, err := hex.DecodeString(f.MD5); err != nil || len(f.MD5) != md5.Size*2 {
+			return fmt.Errorf("文件[%v]md5[%v]不合法", f.Name, f.MD5)
+		}
+		f.MD5 = strings.ToLower(f.MD5)
+	}
+	return nil
+}
+
+func (manifest *Manifest) file(name string) *ManifestFile {
+	for _, f := range manifest.Files {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// verifyRelease 校验本地版本目录的所有文件
+func verifyRelease(release *Release) error {
+	for _, f := range release.Files {
+		fd, err := os.Open(filepath.Join(release.Dir, filepath.FromSlash(f.Name)))
+		if err != nil {
+			return err
+		}
+		hasher := md5.New()
+		_, err = io.Copy(hasher, fd)
+		fd.Close()
+		if err != nil {
+			return err
+		}
+		if sum := hex.EncodeToString(hasher.Sum(nil)); sum != f.MD5 {
+			return fmt.Errorf("文件[%v]md5不一致，清单[%v]，本地[%v]", f.Name, f.MD5, sum)
+		}
+	}
+	return nil
+}
+
+func md5Hex(content []byte) string {
+	sum := md5.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
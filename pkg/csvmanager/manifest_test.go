@@ -0,0 +1,181 @@
+package csvmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type memDFS struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+	gets    map[string]int
+}
+
+func (d *memDFS) TryMakeBucket() error { return nil }
+
+func (d *memDFS) PutObject(path, fileName string, payload []byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.objects[path+"/"+fileName] = payload
+	return nil
+}
+
+func (d *memDFS) GetObject(path, fileName string) ([]byte, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.gets[fileName]++
+	payload, find := d.objects[path+"/"+fileName]
+	if !find {
+		return nil, fmt.Errorf("object %v/%v not found", path, fileName)
+	}
+	return payload, nil
+}
+
+// publish 上传一个版本的文件和清单，badMD5中的文件清单md5写错
+func (d *memDFS) publish(t *testing.T, version string, files map[string]string, badMD5 ...string) {
+	manifest := &Manifest{Version: version}
+	for name, rows := range files {
+		content := []byte("int\tstring\nid\tname\n" + rows)
+		sum := md5Hex(content)
+		for _, bad := range badMD5 {
+			if bad == name {
+				sum = md5Hex([]byte("bad"))
+			}
+		}
+		manifest.Files = append(manifest.Files, &ManifestFile{Name: name, MD5: sum})
+		d.PutObject("tables", version+"/"+name, content)
+	}
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.PutObject("tables", "manifest.json", payload)
+}
+
+func TestManifestLoader(t *testing.T) {
+	store := &memDFS{objects: map[string][]byte{}, gets: map[string]int{}}
+	store.publish(t, "v1", map[string]string{"a.csv": "1\ta\n", "b.csv": "1\tb\n"})
+
+	l, err := NewManifestLoader(ManifestConfig{Handler: store, RemotePath: "tables", CacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := l.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaA := &TableMetaData{No: 1, St: watchTestData{}, File: "a.csv"}
+	metaB := &TableMetaData{No: 2, St: watchTestData{}, File: "b.csv"}
+	m, err := NewSpecMeta("1", []int{1}, release.Dir, map[int]*TableMetaData{1: metaA, 2: metaB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := l.Apply(m, release); err != nil || len(changed) != 0 {
+		t.Fatalf("apply startup release %v %v", changed, err)
+	}
+	zm, _ := m.GetZoneCsvManager(1)
+	if _, _, find := zm.GetTable(metaA); !find {
+		t.Fatal("table a not loaded")
+	}
+
+	// 只下载改变的文件
+	store.publish(t, "v2", map[string]string{"a.csv": "1\ta\n", "b.csv": "1\tb\n2\tb2\n"})
+	changed, err := l.Sync(m)
+	if err != nil || len(changed) != 1 || changed[0] != 2 {
+		t.Fatalf("sync v2 %v %v", changed, err)
+	}
+	if store.gets["v2/a.csv"] != 0 || store.gets["v2/b.csv"] != 1 {
+		t.Fatalf("unexpected downloads %v", store.gets)
+	}
+	if l.Current().Version != "v2" || m.dataPath() != parseGamedataPath(filepath.Join(l.config.CacheDir, "v2")) {
+		t.Fatalf("current release %v path %v", l.Current().Version, m.dataPath())
+	}
+	zm, _ = m.GetZoneCsvManager(1)
+	table, _, _ := zm.GetTable(metaB)
+	if table.NumRecord() != 2 {
+		t.Fatalf("expect 2 rows, got %v", table.NumRecord())
+	}
+
+	// 版本号不变不重复应用
+	if changed, err := l.Sync(m); err != nil || changed != nil {
+		t.Fatalf("sync same version %v %v", changed, err)
+	}
+
+	// md5校验失败不应用
+	store.publish(t, "v3", map[string]string{"a.csv": "1\ta3\n", "b.csv": "1\tb\n"}, "a.csv")
+	if _, err := l.Sync(m); err == nil {
+		t.Fatal("expect md5 error")
+	}
+	// 内容解析失败不应用
+	store.publish(t, "v4", map[string]string{"a.csv": "x\ta4\n", "b.csv": "1\tb\n"})
+	if _, err := l.Sync(m); err == nil {
+		t.Fatal("expect load error")
+	}
+	if l.Current().Version != "v2" || m.Version() != 2 {
+		t.Fatalf("failed release applied %v %v", l.Current().Version, m.Version())
+	}
+
+	changed, err = l.Rollback(m)
+	if err != nil || len(changed) != 1 || changed[0] != 2 {
+		t.Fatalf("rollback %v %v", changed, err)
+	}
+	zm, _ = m.GetZoneCsvManager(1)
+	table, _, _ = zm.GetTable(metaB)
+	if l.Current().Version != "v1" || table.NumRecord() != 1 {
+		t.Fatalf("rollback to %v rows %v", l.Current().Version, table.NumRecord())
+	}
+	if _, err := l.Rollback(m); err == nil {
+		t.Fatal("expect no release to rollback")
+	}
+}
+
+func TestManifestRollbackSync(t *testing.T) {
+	store := &memDFS{objects: map[string][]byte{}, gets: map[string]int{}}
+	store.publish(t, "v1", map[string]string{"a.csv": "1\ta\n"})
+	l, err := NewManifestLoader(ManifestConfig{Handler: store, RemotePath: "tables", CacheDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, err := l.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaA := &TableMetaData{No: 1, St: watchTestData{}, File: "a.csv"}
+	m, err := NewSpecMeta("1", []int{1}, release.Dir, map[int]*TableMetaData{1: metaA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Apply(m, release); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"v2", "v3"} {
+		store.publish(t, version, map[string]string{"a.csv": "1\t" + version + "\n"})
+		if _, err := l.Sync(m); err != nil || l.Current().Version != version {
+			t.Fatalf("sync %v: %v", version, err)
+		}
+	}
+
+	// 连续回滚两次，远端清单还是v3，Sync不撤销回滚
+	for _, want := range []string{"v2", "v1"} {
+		rolledBack := l.Current()
+		if _, err := l.Rollback(m); err != nil || l.Current().Version != want {
+			t.Fatalf("rollback to %v: %v", want, err)
+		}
+		if _, err := os.Stat(rolledBack.Dir); !os.IsNotExist(err) {
+			t.Fatalf("rolled back dir %v not removed: %v", rolledBack.Dir, err)
+		}
+		if changed, err := l.Sync(m); err != nil || changed != nil || l.Current().Version != want {
+			t.Fatalf("sync after rollback %v %v current %v", changed, err, l.Current().Version)
+		}
+	}
+
+	// 发布新版本后恢复同步
+	store.publish(t, "v4", map[string]string{"a.csv": "1\tv4\n"})
+	if changed, err := l.Sync(m); err != nil || len(changed) != 1 || l.Current().Version != "v4" {
+		t.Fatalf("sync v4 %v %v", changed, err)
+	}
+}
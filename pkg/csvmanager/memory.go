@@ -0,0 +1,68 @@
+package csvmanager
+
+import (
+	"sort"
+)
+
+// 估算内存使用的单位大小，64位平台上每行的interface{}加行号、每个索引条目的大致开销
+const (
+	rowPointerBytes = 24
+	indexEntryBytes = 48
+)
+
+// TableMemoryStats 一张表当前版本所有区服的内存统计，只统计行引用和索引，不含行数据本身
+type TableMemoryStats struct {
+	No             int    `json:"no"`
+	File           string `json:"file"`
+	Zones          int    `json:"zones"`         // 已读取这张表的区服数
+	SharedZones    int    `json:"shared_zones"`  // 和其他区服共用数据的区服数
+	OverlayZones   int    `json:"overlay_zones"` // 只保存差异行的区服数
+	RowPointers    int    `json:"row_pointers"`  // 持有的行数，差异层只计差异行
+	IndexEntries   int    `json:"index_entries"`
+	EstimatedBytes int    `json:"estimated_bytes"` // 按行引用和索引条目估算的字节数
+}
+
+// MemoryStats 当前版本每张已读取的表的内存统计，按表序号排列
+func (m *CsvManager) MemoryStats() []*TableMemoryStats {
+	tables := m.tablesMetaData()
+	zones := m.zones()
+
+	stats := make(map[int]*TableMemoryStats)
+	for _, zone := range zones {
+		zm, find := m.GetZoneCsvManager(zone)
+		if !find {
+			continue
+		}
+		for no, table := range tables {
+			data, find := zm.getTable(no)
+			if !find || data.CsvOriginRowsData == nil {
+				continue
+			}
+			s, find := stats[no]
+			if !find {
+				s = &TableMemoryStats{No: no, File: table.File}
+				stats[no] = s
+			}
+			rowsStats := data.MemoryStats()
+			s.Zones++
+			if rowsStats.Shared {
+				s.SharedZones++
+			}
+			if rowsStats.Overlay {
+				s.OverlayZones++
+			}
+			s.RowPointers += rowsStats.RowPointers
+			s.IndexEntries += rowsStats.IndexEntries
+		}
+	}
+
+	list := make([]*TableMemoryStats, 0, len(stats))
+	for _, s := range stats {
+		s.EstimatedBytes = s.RowPointers*rowPointerBytes + s.IndexEntries*indexEntryBytes
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].No < list[j].No
+	})
+	return list
+}
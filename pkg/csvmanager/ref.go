@@ -0,0 +1,250 @@
+package csvmanager
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"joynova.com/library/supernova/pkg/csvmanager/csv"
+)
+
+// ref标签声明字段引用其他表某列的值，格式为"表名.列名"，例如：
+//
+//	type ShopData struct {
+//	    ItemID int32         `csv:"item_id" ref:"item.id"`
+//	    Reward []*RewardItem `csv:"reward"`
+//	}
+//
+//	type RewardItem struct {
+//	    ItemID int32 `ref:"item.id"`
+//	    Amount int32
+//	}
+//
+// ref标签可以写在切片字段和实现Parser的结构体字段上，零值表示没有引用，不做校验
+const refTag = "ref"
+
+type refTarget struct {
+	table  *TableMetaData
+	column string
+	col    int // 列在表结构体中的字段序号
+}
+
+// checkRefs 按区服校验所有表ref标签引用的值在目标表中存在，一次返回所有错误
+func (m *CsvManager) checkRefs() error {
+	tables := m.tablesMetaData()
+	byName := make(map[string]*TableMetaData, len(tables))
+	for _, v := range tables {
+		byName[v.TableName()] = v
+	}
+
+	errs := make(csv.RowErrors, 0)
+	// 解析所有ref标签的目标
+	targets := make(map[string]*refTarget)
+	refTables := make([]*TableMetaData, 0)
+	for _, v := range sortedTables(tables) {
+		refs := collectTags(reflect.TypeOf(v.St), refTag, nil)
+		for _, ref := range refs {
+			if _, find := targets[ref]; find {
+				continue
+			}
+			target, err := resolveRef(ref, byName)
+			if err != nil {
+				errs = append(errs, &csv.RowError{File: filepath.Base(v.File), Value: ref, Reason: err.Error()})
+				continue
+			}
+			targets[ref] = target
+		}
+		if len(refs) > 0 {
+			refTables = append(refTables, v)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	reported := make(map[csv.RowError]bool)
+	for _, zone := range m.zones() {
+		zm, find := m.GetZoneCsvManager(zone)
+		if !find {
+			return fmt.Errorf("校验引用没有找到区服[%v]", zone)
+		}
+
+		// 目标表某列所有值，按需构建
+		values := make(map[string]map[string]bool)
+		targetValues := func(ref string) (map[string]bool, error) {
+			set, find := values[ref]
+			if find {
+				return set, nil
+			}
+			target := targets[ref]
+			table, _, find := zm.GetTable(target.table)
+			if !find {
+				return nil, fmt.Errorf("读取引用表[%v]失败", filepath.Base(target.table.File))
+			}
+			set = make(map[string]bool, table.NumRecord())
+			for _, row := range table.Records() {
+				set[refValueString(reflect.ValueOf(row).Elem().Field(target.col))] = true
+			}
+			values[ref] = set
+			return set, nil
+		}
+
+		for _, v := range refTables {
+			table, _, find := zm.GetTable(v)
+			if !find {
+				return fmt.Errorf("校验引用读取表[%v]失败", filepath.Base(v.File))
+			}
+			for i, row := range table.Records() {
+				var walkErr error
+				walkRowTag(reflect.ValueOf(row), refTag, func(column, ref string, value reflect.Value) {
+					if walkErr != nil || value.IsZero() {
+						return
+					}
+					set, err := targetValues(ref)
+					if err != nil {
+						walkErr = err
+						return
+					}
+					valueString := refValueString(value)
+					if set[valueString] {
+						return
+					}
+					e := csv.RowError{
+						File:   filepath.Base(v.File),
+						Line:   table.Line(i),
+						Column: column,
+						Value:  valueString,
+						Reason: fmt.Sprintf("区服[%v]引用的[%v]不存在", zone, ref),
+					}
+					// 多个区服的同一行只报告一次
+					key := e
+					key.Reason = ""
+					if reported[key] {
+						return
+					}
+					reported[key] = true
+					errs = append(errs, &e)
+				})
+				if walkErr != nil {
+					return walkErr
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// resolveRef 解析"表名.列名"，找到目标表和列在结构体中的位置
+func resolveRef(ref string, byName map[string]*TableMetaData) (*refTarget, error) {
+	i := strings.LastIndex(ref, ".")
+	if i <= 0 || i == len(ref)-1 {
+		return nil, fmt.Errorf("ref标签[%v]格式错误，应为表名.列名", ref)
+	}
+	tableName, column := ref[:i], ref[i+1:]
+	table, find := byName[tableName]
+	if !find {
+		return nil, fmt.Errorf("ref标签[%v]引用的表[%v]没有注册", ref, tableName)
+	}
+	t := reflect.TypeOf(table.St)
+	for j := 0; j < t.NumField(); j++ {
+		if t.Field(j).Tag.Get("csv") == column {
+			return &refTarget{table: table, column: column, col: j}, nil
+		}
+	}
+	return nil, fmt.Errorf("ref标签[%v]引用的列[%v]在表[%v]中不存在", ref, column, tableName)
+}
+
+// collectTags 收集类型中所有tag标签的值，包括切片元素和嵌套结构体
+func collectTags(t reflect.Type, tag string, visited map[reflect.Type]bool) []string {
+	if visited == nil {
+		visited = make(map[reflect.Type]bool)
+	}
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || visited[t] {
+		return nil
+	}
+	visited[t] = true
+
+	refs := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if ref := f.Tag.Get(tag); ref != "" {
+			refs = append(refs, ref)
+		}
+		refs = append(refs, collectTags(f.Type, tag, visited)...)
+	}
+	return refs
+}
+
+// walkRowTag 遍历一行数据中所有带tag标签的值，column为值所在的csv列名
+func walkRowTag(row reflect.Value, tag string, visit func(column, ref string, value reflect.Value)) {
+	row = reflect.Indirect(row)
+	t := row.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		column := f.Tag.Get("csv")
+		if column == "" || column == "_" {
+			continue
+		}
+		walkTagValue(row.Field(i), tag, f.Tag.Get(tag), column, visit)
+	}
+}
+
+func walkTagValue(v reflect.Value, tag string, ref string, column string,
+	visit func(column, ref string, value reflect.Value)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		walkTagValue(v.Elem(), tag, ref, column, visit)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkTagValue(v.Index(i), tag, ref, column, visit)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			walkTagValue(v.Field(i), tag, f.Tag.Get(tag), column, visit)
+		}
+	default:
+		if ref != "" {
+			visit(column, ref, v)
+		}
+	}
+}
+
+// refValueString 引用值统一转为字符串比较，不同宽度的整数可以互相引用
+func refValueString(v reflect.Value) string {
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func sortedTables(tables map[int]*TableMetaData) []*TableMetaData {
+	list := make([]*TableMetaData, 0, len(tables))
+	for _, v := range tables {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].No < list[j].No
+	})
+	return list
+}
@@ -0,0 +1,105 @@
+package csvmanager
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+
+	"joynova.com/library/supernova/pkg/csvmanager/csv"
+)
+
+var (
+	ErrSnapshotReleased = errors.New("配置表快照已经释放")
+	// ErrSnapshotStale 快照版本的表在快照创建之后没有读取过，文件又已经改变，无法再读到这个版本的数据，
+	// 调用方应释放快照，重新创建后重试整个逻辑
+	ErrSnapshotStale = errors.New("配置表快照版本的数据已经不可用")
+)
+
+// Snapshot 固定在一个配置表版本的只读视图，一个逻辑中读取的多张表保证来自同一版本，
+// 用完必须调用Release，没有快照引用的旧版本数据才会被释放
+type Snapshot struct {
+	zm       *CsvZoneManager
+	released int32
+}
+
+// Snapshot 创建当前区服管理器版本的快照
+func (m *CsvZoneManager) Snapshot() *Snapshot {
+	csvM := m.csvManager
+	csvM.lock.Lock()
+	csvM.snapshotRefs[m]++
+	csvM.lock.Unlock()
+	return &Snapshot{zm: m}
+}
+
+// Version 快照的配置表版本
+func (s *Snapshot) Version() int {
+	return s.zm.version
+}
+
+// Zone 快照的区服
+func (s *Snapshot) Zone() int {
+	return s.zm.Zone
+}
+
+// GetTable 读取快照版本的配置表数据，表在这个版本没有读取过时，
+// 只有文件内容和快照版本一致才会读取，否则返回ErrSnapshotStale，不会混入其他版本的数据
+func (s *Snapshot) GetTable(table *TableMetaData) (*csv.CsvTable, error) {
+	if atomic.LoadInt32(&s.released) != 0 {
+		return nil, ErrSnapshotReleased
+	}
+
+	data, find := s.zm.getTable(table.No)
+	if find {
+		return data, nil
+	}
+
+	curM, find := s.zm.csvManager.GetZoneCsvManager(s.zm.Zone)
+	if !find {
+		return nil, fmt.Errorf("快照读取表[%v]没有找到区服[%v]", filepath.Base(table.File), s.zm.Zone)
+	}
+	if curM != s.zm && curM.tablesMD5[table.No] != s.zm.tablesMD5[table.No] {
+		return nil, ErrSnapshotStale
+	}
+
+	// 当前版本的数据和快照版本一致，读取后固定到快照版本
+	data, _, find = curM.GetTable(table)
+	if !find {
+		return nil, fmt.Errorf("快照读取表[%v]失败", filepath.Base(table.File))
+	}
+	if curM != s.zm {
+		s.zm.tables.Store(table.No, data)
+	}
+	return data, nil
+}
+
+// Release 释放快照，重复调用无影响
+func (s *Snapshot) Release() {
+	if !atomic.CompareAndSwapInt32(&s.released, 0, 1) {
+		return
+	}
+
+	csvM := s.zm.csvManager
+	csvM.lock.Lock()
+	defer csvM.lock.Unlock()
+	csvM.snapshotRefs[s.zm]--
+	if csvM.snapshotRefs[s.zm] > 0 {
+		return
+	}
+	delete(csvM.snapshotRefs, s.zm)
+	if s.zm.version < csvM.version || s.zm.removed {
+		// 旧版本或者已删除区服的最后一个快照释放
+		s.zm.release()
+	}
+}
+
+// RetainedVersions 被快照引用的版本和引用次数，用于观察旧版本数据是否及时释放
+func (m *CsvManager) RetainedVersions() map[int]int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	versions := make(map[int]int)
+	for zm, refs := range m.snapshotRefs {
+		versions[zm.version] += refs
+	}
+	return versions
+}
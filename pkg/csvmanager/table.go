@@ -0,0 +1,112 @@
+package csvmanager
+
+import (
+	"joynova.com/library/supernova/pkg/csvmanager/csv"
+)
+
+// TableDef 类型化的表元数据，T为表结构体，通过它读取的表数据不需要类型断言
+//
+//	var ItemMeta = csvmanager.Typed[ItemData](&csvmanager.TableMetaData{No: 1, File: "item.csv"}).Register()
+//
+//	table, find := ItemMeta.From(zm)
+//	item, find := table.Get(1001)
+type TableDef[T any] struct {
+	*TableMetaData
+}
+
+// Typed 把表元数据的表结构体设置为T，返回类型化的表元数据
+func Typed[T any](meta *TableMetaData) *TableDef[T] {
+	var st T
+	meta.St = st
+	return &TableDef[T]{TableMetaData: meta}
+}
+
+// Register 注册到默认表元数据
+func (d *TableDef[T]) Register() *TableDef[T] {
+	d.TableMetaData.Register()
+	return d
+}
+
+// From 读取区服管理器中的表
+func (d *TableDef[T]) From(zm *CsvZoneManager) (*Table[T], bool) {
+	table, _, find := zm.GetTable(d.TableMetaData)
+	if !find {
+		return nil, false
+	}
+	return &Table[T]{CsvTable: table}, true
+}
+
+// FromSnapshot 读取快照中的表
+func (d *TableDef[T]) FromSnapshot(s *Snapshot) (*Table[T], error) {
+	table, err := s.GetTable(d.TableMetaData)
+	if err != nil {
+		return nil, err
+	}
+	return &Table[T]{CsvTable: table}, nil
+}
+
+// Table 类型化的表数据，索引键支持所有整数、浮点数、字符串、布尔类型，不同宽度的整数可以互相查询，
+// 不支持的键类型查不到数据，不会panic
+type Table[T any] struct {
+	*csv.CsvTable
+}
+
+// Get 按主键读取
+func (t *Table[T]) Get(key interface{}) (*T, bool) {
+	row, ok := t.Index(key).(*T)
+	return row, ok
+}
+
+// Group 按第n个组索引读取，n为group标签在结构体字段里出现的顺序，从0开始
+func (t *Table[T]) Group(n int, key interface{}) []*T {
+	return toTyped[T](t.IndexGroup(n, key))
+}
+
+// Union 按联合索引读取，keys按union标签在结构体字段里出现的顺序
+func (t *Table[T]) Union(name string, keys ...interface{}) []*T {
+	return toTyped[T](t.IndexUnionGroup(name, keys...))
+}
+
+// UnionUnique 按联合唯一索引读取
+func (t *Table[T]) UnionUnique(name string, keys ...interface{}) (*T, bool) {
+	row, ok := t.IndexUnionUnique(name, keys...).(*T)
+	return row, ok
+}
+
+// Floor 按有序索引读取键小于等于key的最大一行
+func (t *Table[T]) Floor(name string, key interface{}) (*T, bool) {
+	row, ok := t.CsvOriginRowsData.Floor(name, key).(*T)
+	return row, ok
+}
+
+// Ceil 按有序索引读取键大于等于key的最小一行
+func (t *Table[T]) Ceil(name string, key interface{}) (*T, bool) {
+	row, ok := t.CsvOriginRowsData.Ceil(name, key).(*T)
+	return row, ok
+}
+
+// RangeBetween 按有序索引读取键在[lo, hi]之间的所有行
+func (t *Table[T]) RangeBetween(name string, lo interface{}, hi interface{}) []*T {
+	return toTyped[T](t.CsvOriginRowsData.RangeBetween(name, lo, hi))
+}
+
+// Containing 按区间索引读取开始<=key<结束的所有行
+func (t *Table[T]) Containing(name string, key interface{}) []*T {
+	return toTyped[T](t.CsvOriginRowsData.Containing(name, key))
+}
+
+// All 所有数据，按文件中的顺序
+func (t *Table[T]) All() []*T {
+	return toTyped[T](t.Records())
+}
+
+func toTyped[T any](rows []interface{}) []*T {
+	if rows == nil {
+		return nil
+	}
+	list := make([]*T, 0, len(rows))
+	for _, v := range rows {
+		list = append(list, v.(*T))
+	}
+	return list
+}
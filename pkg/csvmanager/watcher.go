@@ -0,0 +1,235 @@
+package csvmanager
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"joynova.com/library/supernova/pkg/jlog"
+)
+
+// WatchConfig 配置表文件监听配置
+type WatchConfig struct {
+	Debounce     time.Duration   // 防抖时间，最后一次文件改动之后等待这么久才重读，默认500ms
+	PollInterval time.Duration   // 轮询md5的间隔，fsnotify不可用或ForcePoll时使用，默认5s
+	ForcePoll    bool            // 强制轮询，用于SetOpenFileFunc自定义了文件系统、网络挂载目录等收不到文件事件的场景
+	OnError      func(err error) // 校验重读失败回调，不设置只打日志，失败时保留当前版本
+}
+
+// Watcher 配置表文件监听器，文件改动后自动校验重读
+type Watcher struct {
+	m        *CsvManager
+	config   WatchConfig
+	files    map[string]bool // 监听的表文件全路径
+	notifier *fsnotify.Watcher
+	trigger  chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Watch 开启配置表文件监听，文件改动会合并一段时间内的多次写入，
+// 然后调用ReloadValidated在旁路校验，全部通过才切换版本，再通知Subscribe的订阅者
+func (m *CsvManager) Watch(config WatchConfig) (*Watcher, error) {
+	if config.Debounce <= 0 {
+		config.Debounce = 500 * time.Millisecond
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 5 * time.Second
+	}
+
+	w := &Watcher{
+		m:       m,
+		config:  config,
+		files:   make(map[string]bool),
+		trigger: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+	}
+
+	dirs := make(map[string]bool)
+	for _, v := range m.tablesMetaData() {
+		file, err := filepath.Abs(m.dataPath() + v.File)
+		if err != nil {
+			return nil, fmt.Errorf("解析表文件[%v]路径错误:%v", v.File, err)
+		}
+		w.files[file] = true
+		dirs[filepath.Dir(file)] = true
+	}
+
+	if !config.ForcePoll {
+		notifier, err := newNotifier(dirs)
+		if err != nil {
+			jlog.Warnf("配置表文件监听不可用，改为每[%v]轮询md5:%v", config.PollInterval, err)
+		} else {
+			w.notifier = notifier
+		}
+	}
+
+	w.wg.Add(2)
+	if w.notifier != nil {
+		go w.watchEvents()
+	} else {
+		go w.poll()
+	}
+	go w.debounceReload()
+	return w, nil
+}
+
+// Stop 停止监听，等待正在进行的重读结束
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		if w.notifier != nil {
+			w.notifier.Close()
+		}
+		w.wg.Wait()
+	})
+}
+
+func newNotifier(dirs map[string]bool) (*fsnotify.Watcher, error) {
+	notifier, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// 监听目录而不是文件，编辑器和发布脚本常用改名覆盖的方式写文件，直接监听文件会丢失事件
+	for dir := range dirs {
+		if err := notifier.Add(dir); err != nil {
+			notifier.Close()
+			return nil, fmt.Errorf("监听目录[%v]错误:%v", dir, err)
+		}
+	}
+	return notifier, nil
+}
+
+func (w *Watcher) watchEvents() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case event, ok := <-w.notifier.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+				continue
+			}
+			if w.files[filepath.Clean(event.Name)] {
+				w.notify()
+			}
+		case err, ok := <-w.notifier.Errors:
+			if !ok {
+				return
+			}
+			jlog.Warnf("配置表文件监听错误:%v", err)
+		}
+	}
+}
+
+// poll 轮询文件md5，和上一次轮询结果不一致就触发重读
+func (w *Watcher) poll() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+
+	// 以当前版本的md5为基准，监听开启之后的改动都能被发现
+	w.m.lock.Lock()
+	last := w.m.tablesMD5
+	w.m.lock.Unlock()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			cur, err := w.m.md5AllFiles(w.m.dataPath())
+			if err != nil {
+				// 发布过程中文件可能短暂缺失，等待下次轮询
+				continue
+			}
+			if len(cur) != len(last) {
+				last = w.registeredBaseline(last, cur)
+			}
+			if !sameMD5(last, cur) {
+				last = cur
+				w.notify()
+			}
+		}
+	}
+}
+
+// registeredBaseline 运行时注册的新表以注册时的md5为基准，注册本身不触发重读
+func (w *Watcher) registeredBaseline(last map[int]string, cur map[int]string) map[int]string {
+	w.m.lock.Lock()
+	defer w.m.lock.Unlock()
+	baseline := make(map[int]string, len(cur))
+	for k := range cur {
+		if v, find := last[k]; find {
+			baseline[k] = v
+		} else {
+			baseline[k] = w.m.tablesMD5[k]
+		}
+	}
+	return baseline
+}
+
+func (w *Watcher) notify() {
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// debounceReload 每次文件改动重置计时，计时结束才重读，避免批量发布时每个文件都重读一次
+func (w *Watcher) debounceReload() {
+	defer w.wg.Done()
+	timer := time.NewTimer(w.config.Debounce)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	for {
+		select {
+		case <-w.stop:
+			timer.Stop()
+			return
+		case <-w.trigger:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(w.config.Debounce)
+		case <-timer.C:
+			w.reload()
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	changed, err := w.m.ReloadValidated()
+	if err != nil {
+		jlog.Errorf("配置表自动重读失败:%v", err)
+		if w.config.OnError != nil {
+			w.config.OnError(err)
+		}
+		return
+	}
+	if len(changed) <= 0 {
+		return
+	}
+	jlog.Infof("配置表自动重读成功，版本[%v]，改变的表%v", w.m.Version(), changed)
+}
+
+func sameMD5(a, b map[int]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package csvmanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type watchTestData struct {
+	ID   int32  `csv:"id" index:"true"`
+	Name string `csv:"name"`
+}
+
+func writeWatchTestFile(t *testing.T, file string, rows string) {
+	content := "int\tstring\nid\tname\n" + rows
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testWatch(t *testing.T, forcePoll bool) {
+	dir := t.TempDir()
+	writeWatchTestFile(t, filepath.Join(dir, "a.csv"), "1\ta\n")
+	writeWatchTestFile(t, filepath.Join(dir, "b.csv"), "1\tb\n")
+	metaA := &TableMetaData{No: 1, St: watchTestData{}, File: "a.csv"}
+	metaB := &TableMetaData{No: 2, St: watchTestData{}, File: "b.csv"}
+	m, err := NewSpecMeta("1", []int{1, 2}, dir, map[int]*TableMetaData{1: metaA, 2: metaB})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan *ReloadEvent, 10)
+	m.Subscribe(func(event *ReloadEvent) {
+		events <- event
+	})
+	errs := make(chan error, 10)
+	w, err := m.Watch(WatchConfig{
+		Debounce:     100 * time.Millisecond,
+		PollInterval: 50 * time.Millisecond,
+		ForcePoll:    forcePoll,
+		OnError: func(err error) {
+			errs <- err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// 连续多次写入只重读一次
+	for i := 0; i < 3; i++ {
+		writeWatchTestFile(t, filepath.Join(dir, "b.csv"), "1\tb\n2\tb2\n")
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case event := <-events:
+		if event.Version != 2 || len(event.Changed) != 1 || event.Changed[0] != 2 {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no reload event")
+	}
+
+	zm, _ := m.GetZoneCsvManager(2)
+	table, triggerLoad, find := zm.GetTable(metaB)
+	if !find || triggerLoad || table.NumRecord() != 2 {
+		t.Fatalf("new version table not preloaded %v %v", find, triggerLoad)
+	}
+
+	// 写入错误数据，保留当前版本
+	writeWatchTestFile(t, filepath.Join(dir, "a.csv"), "x\ta\n")
+	select {
+	case <-errs:
+	case <-time.After(3 * time.Second):
+		t.Fatal("no reload error")
+	}
+	if m.Version() != 2 {
+		t.Fatalf("version changed after bad reload %v", m.Version())
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %+v", event)
+	default:
+	}
+}
+
+func TestWatchNotify(t *testing.T) {
+	testWatch(t, false)
+}
+
+func TestWatchPoll(t *testing.T) {
+	testWatch(t, true)
+}
+
+func TestWatchRegisterTable(t *testing.T) {
+	dir := t.TempDir()
+	writeWatchTestFile(t, filepath.Join(dir, "a.csv"), "1\ta\n")
+	metaA := &TableMetaData{No: 1, St: watchTestData{}, File: "a.csv"}
+	m, err := NewSpecMeta("1", []int{1}, dir, map[int]*TableMetaData{1: metaA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan *ReloadEvent, 10)
+	m.Subscribe(func(event *ReloadEvent) {
+		events <- event
+	})
+	w, err := m.Watch(WatchConfig{Debounce: 20 * time.Millisecond, PollInterval: time.Millisecond, ForcePoll: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// 轮询的同时注册新表，注册本身不触发重读
+	for no := 2; no <= 10; no++ {
+		file := fmt.Sprintf("t%v.csv", no)
+		writeWatchTestFile(t, filepath.Join(dir, file), "1\tx\n")
+		if err := m.RegisterTable(&TableMetaData{No: no, St: watchTestData{}, File: file}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// 新表的改动可以被轮询发现
+	writeWatchTestFile(t, filepath.Join(dir, "t10.csv"), "1\tx\n2\ty\n")
+	select {
+	case event := <-events:
+		if len(event.Changed) != 1 || event.Changed[0] != 10 {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no reload event")
+	}
+}
@@ -0,0 +1,222 @@
+package csvmanager
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"joynova.com/library/supernova/pkg/csvmanager/csv"
+	"joynova.com/library/supernova/pkg/csvmanager/utils"
+	"joynova.com/library/supernova/pkg/jlog"
+)
+
+// 运行时增删区服、注册新表，用于合服、开新服。和重读共用reloadLock，
+// 不切换配置表版本，新区服读取的数据和当前版本的文件md5一致
+
+// ZoneEventType 运行时区服、表变化的类型
+type ZoneEventType int
+
+const (
+	ZoneAdded       ZoneEventType = iota + 1 // 新增区服
+	ZoneRemoved                              // 删除区服
+	TableRegistered                          // 注册新表
+)
+
+// ZoneEvent 运行时新增、删除区服或者注册新表的事件
+type ZoneEvent struct {
+	Type    ZoneEventType
+	Version int // 发生时的配置表版本号
+	Zone    int // 新增、删除的区服
+	Table   int // 新注册的表序号
+}
+
+// SubscribeZone 订阅运行时区服、表变化事件
+func (m *CsvManager) SubscribeZone(f func(event *ZoneEvent)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.zoneSubscribers = append(m.zoneSubscribers, f)
+}
+
+// AddZone 新增区服，当前版本已经读取过的表立即为新区服读取，其他表使用时再读取，
+// 文件在重读之后又被修改的表无法读到当前版本的数据，返回错误，需要先重读
+func (m *CsvManager) AddZone(zone int) error {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+
+	if _, find := m.GetZoneCsvManager(zone); find {
+		return fmt.Errorf("区服[%v]已经存在", zone)
+	}
+	m.lock.Lock()
+	version := m.version
+	tablesMD5 := m.tablesMD5
+	zones := m.MetaData.Zones
+	m.lock.Unlock()
+
+	zm := newCsvZoneManager(zone, m)
+	zm.version = version
+	zm.tablesMD5 = tablesMD5
+	var loadedZm *CsvZoneManager
+	if len(zones) > 0 {
+		loadedZm, _ = m.GetZoneCsvManager(zones[0])
+	}
+	if loadedZm != nil {
+		path := m.dataPath()
+		var errs csv.RowErrors
+		for _, table := range sortedTables(m.tablesMetaData()) {
+			if _, find := loadedZm.getTable(table.No); !find {
+				continue
+			}
+			data, err := m.readCurrent(path, []int{zone}, table, tablesMD5[table.No])
+			if err != nil {
+				errs = csv.AppendRowErrors(errs, filepath.Base(table.File), err)
+				continue
+			}
+			zm.tables.Store(table.No, data[0])
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+	}
+
+	m.lock.Lock()
+	m.MetaData.Zones = append(append(make([]int, 0, len(zones)+1), zones...), zone)
+	m.zonesManager.Store(zone, zm)
+	event := &ZoneEvent{Type: ZoneAdded, Version: m.version, Zone: zone}
+	subscribers := append([]func(event *ZoneEvent){}, m.zoneSubscribers...)
+	m.lock.Unlock()
+
+	jlog.Infof("配置表管理器新增区服[%v]", zone)
+	for _, f := range subscribers {
+		notifyZoneEvent(f, event)
+	}
+	return nil
+}
+
+// RemoveZone 删除区服，被快照引用的数据在最后一个快照释放时释放
+func (m *CsvManager) RemoveZone(zone int) error {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+
+	m.lock.Lock()
+	zones := make([]int, 0, len(m.MetaData.Zones))
+	for _, z := range m.MetaData.Zones {
+		if z != zone {
+			zones = append(zones, z)
+		}
+	}
+	if len(zones) == len(m.MetaData.Zones) {
+		m.lock.Unlock()
+		return fmt.Errorf("区服[%v]不存在", zone)
+	}
+	m.MetaData.Zones = zones
+	if zm, find := m.zonesManager.Load(zone); find {
+		m.zonesManager.Delete(zone)
+		zm.(*CsvZoneManager).removed = true
+		if m.snapshotRefs[zm.(*CsvZoneManager)] <= 0 {
+			zm.(*CsvZoneManager).release()
+		}
+	}
+	event := &ZoneEvent{Type: ZoneRemoved, Version: m.version, Zone: zone}
+	subscribers := append([]func(event *ZoneEvent){}, m.zoneSubscribers...)
+	m.lock.Unlock()
+
+	jlog.Infof("配置表管理器删除区服[%v]", zone)
+	for _, f := range subscribers {
+		notifyZoneEvent(f, event)
+	}
+	return nil
+}
+
+// RegisterTable 运行时注册新表，立即为所有区服读取，读取失败不注册，
+// 已经启动的Watcher不会收到新表文件的事件，轮询模式以注册时的md5为基准检查新表
+func (m *CsvManager) RegisterTable(table *TableMetaData) error {
+	m.reloadLock.Lock()
+	defer m.reloadLock.Unlock()
+
+	m.lock.Lock()
+	_, find := m.MetaData.TablesMetaData[table.No]
+	zones := m.MetaData.Zones
+	path := m.MetaData.Path
+	m.lock.Unlock()
+	if find {
+		return fmt.Errorf("表序号[%v]已经存在", table.No)
+	}
+
+	newMD5, _, err := utils.CheckMD5(path+table.File, "")
+	if err != nil {
+		return fmt.Errorf("校验文件[%v]md5错误:%v", filepath.Base(table.File), err)
+	}
+	list, err := m.readCurrent(path, zones, table, newMD5)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	tablesMetaData := make(map[int]struct {
+		Data *TableMetaData
+		Lock *sync.Mutex
+	}, len(m.MetaData.TablesMetaData)+1)
+	for k, v := range m.MetaData.TablesMetaData {
+		tablesMetaData[k] = v
+	}
+	value := tablesMetaData[table.No]
+	value.Data = table
+	value.Lock = new(sync.Mutex)
+	tablesMetaData[table.No] = value
+	m.MetaData.TablesMetaData = tablesMetaData
+
+	// 区服管理器共用md5表且只读，复制后加入新表
+	tablesMD5 := make(map[int]string, len(m.tablesMD5)+1)
+	for k, v := range m.tablesMD5 {
+		tablesMD5[k] = v
+	}
+	tablesMD5[table.No] = newMD5
+	m.tablesMD5 = tablesMD5
+	for i, zone := range zones {
+		if zm, find := m.GetZoneCsvManager(zone); find {
+			zm.tables.Store(table.No, list[i])
+		}
+	}
+	event := &ZoneEvent{Type: TableRegistered, Version: m.version, Table: table.No}
+	subscribers := append([]func(event *ZoneEvent){}, m.zoneSubscribers...)
+	m.lock.Unlock()
+
+	if m.diffSources != nil {
+		m.updateDiffSource(path, table)
+	}
+	jlog.Infof("配置表管理器注册表[%v]", table.File)
+	for _, f := range subscribers {
+		notifyZoneEvent(f, event)
+	}
+	return nil
+}
+
+// readCurrent 读取指定区服的表数据，读取前后文件md5都要和md5一致
+func (m *CsvManager) readCurrent(path string, zones []int, table *TableMetaData, md5 string) ([]*csv.CsvTable, error) {
+	checkMD5 := func() error {
+		fileMD5, _, err := utils.CheckMD5(path+table.File, "")
+		if err != nil {
+			return fmt.Errorf("校验文件[%v]md5错误:%v", filepath.Base(table.File), err)
+		}
+		if fileMD5 != md5 {
+			return fmt.Errorf("表[%v]文件和当前版本不一致，需要先重读", filepath.Base(table.File))
+		}
+		return nil
+	}
+	if err := checkMD5(); err != nil {
+		return nil, err
+	}
+	list, err := m.readCsv(path, zones, table)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMD5(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func notifyZoneEvent(f func(event *ZoneEvent), event *ZoneEvent) {
+	defer jlog.CatchWithInfo(fmt.Sprintf("配置表区服[%v]表[%v]变化回调", event.Zone, event.Table))
+	f(event)
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+// HeaderAPIKey api key默认所在的头
+const HeaderAPIKey = "X-Api-Key"
+
+type APIKey struct {
+	Name   string   // key的名字，作为调用方标识写入日志，不要用key本身
+	Key    string   // key的值
+	Scopes []string // 权限
+}
+
+type apiKeyAuthenticator struct {
+	header string
+	keys   []*apiKeyEntry
+}
+
+type apiKeyEntry struct {
+	hash [sha256.Size]byte
+	key  *APIKey
+}
+
+// NewAPIKey 静态api key认证，header为空默认X-Api-Key，也支持Authorization: ApiKey xxx
+func NewAPIKey(header string, keys ...*APIKey) Authenticator {
+	if header == "" {
+		header = HeaderAPIKey
+	}
+	a := &apiKeyAuthenticator{header: header}
+	for _, k := range keys {
+		a.keys = append(a.keys, &apiKeyEntry{hash: sha256.Sum256([]byte(k.Key)), key: k})
+	}
+	return a
+}
+
+func (a *apiKeyAuthenticator) Authenticate(c *gin.Context) (*jweb.Principal, error) {
+	key := c.GetHeader(a.header)
+	if key == "" {
+		if authz := c.GetHeader("Authorization"); strings.HasPrefix(authz, "ApiKey ") {
+			key = strings.TrimPrefix(authz, "ApiKey ")
+		}
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	// 比较hash，避免逐字节比较泄露key长度和前缀
+	hash := sha256.Sum256([]byte(key))
+	var matched *APIKey
+	for _, entry := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], entry.hash[:]) == 1 {
+			matched = entry.key
+		}
+	}
+	if matched == nil {
+		return nil, ErrUnknownKey
+	}
+	return &jweb.Principal{
+		Subject: matched.Name,
+		Method:  "apikey",
+		Scopes:  matched.Scopes,
+	}, nil
+}
@@ -0,0 +1,76 @@
+// Package auth jweb认证中间件，支持jwt、hmac请求签名、静态api key，
+// 认证通过的调用方通过jweb.GetPrincipal获取，路由权限通过jweb.RequireScopes声明
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jlog"
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+var (
+	// ErrNoCredentials 请求没有携带这种认证方式的凭证，交给下一个认证器处理
+	ErrNoCredentials = errors.New("no credentials")
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrTokenExpired  = errors.New("token expired")
+	ErrUnknownKey    = errors.New("unknown key")
+	ErrSignature     = errors.New("signature mismatch")
+	ErrReplay        = errors.New("replayed request")
+)
+
+// Authenticator 一种认证方式
+type Authenticator interface {
+	// Authenticate 认证请求，请求没有携带这种认证方式的凭证时返回ErrNoCredentials
+	Authenticate(c *gin.Context) (*jweb.Principal, error)
+}
+
+type AuthenticatorFunc func(c *gin.Context) (*jweb.Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(c *gin.Context) (*jweb.Principal, error) {
+	return f(c)
+}
+
+type Config struct {
+	// Optional 为true时没有携带凭证的请求也放行，由jweb.RequireScopes决定路由是否需要认证
+	Optional bool
+	// OnFail 认证失败的响应，默认返回401
+	OnFail func(c *gin.Context, err error)
+}
+
+// Middleware 按顺序尝试认证器，第一个认证成功的写入调用方，凭证错误直接拒绝，例如：
+// admin := e.Group("/admin", auth.Middleware(auth.Config{}, auth.NewJWT(jwtConfig), auth.NewAPIKey(keys)))
+func Middleware(config Config, authenticators ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, a := range authenticators {
+			p, err := a.Authenticate(c)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				jlog.Warnf("[jweb] auth %v %v from %v fail:%v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+				fail(c, config, err)
+				return
+			}
+			jweb.SetPrincipal(c, p)
+			c.Next()
+			return
+		}
+		if config.Optional {
+			c.Next()
+			return
+		}
+		fail(c, config, ErrNoCredentials)
+	}
+}
+
+func fail(c *gin.Context, config Config, err error) {
+	if config.OnFail != nil {
+		config.OnFail(c, err)
+		c.Abort()
+		return
+	}
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+type testContext struct {
+	c *gin.Context
+}
+
+func (c *testContext) SetGinContext(ctx *gin.Context) {
+	c.c = ctx
+}
+
+func (c *testContext) GetGinContext() *gin.Context {
+	return c.c
+}
+
+func (c *testContext) ResponseParseParamsFieldFail(path string, field string, value string, err error) {
+	c.c.String(http.StatusBadRequest, err.Error())
+}
+
+type MailParams struct {
+	RoleID int    `json:"role_id"`
+	Title  string `json:"title"`
+}
+
+func newTestEngine(authenticators ...Authenticator) *jweb.Engine {
+	e := jweb.NewEngine(":0", func() jweb.Context {
+		return new(testContext)
+	}, jweb.WithoutGinDefault())
+	admin := e.Group("/admin", Middleware(Config{}, authenticators...))
+	admin.Get("/whoami", "当前账号", func(c *testContext) {
+		p, _ := jweb.GetPrincipal(c)
+		c.GetGinContext().String(http.StatusOK, p.Method+":"+p.Subject)
+	})
+	mail := admin.Group("/mail", jweb.RequireScopes("gm.mail"))
+	mail.PostWithStructParams("/add", "发邮件", MailParams{}, jweb.RequireScopes("gm.mail.write"),
+		func(c *testContext, params *MailParams) {
+			c.GetGinContext().String(http.StatusOK, params.Title)
+		})
+	return e
+}
+
+func serve(e *jweb.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.GetGinEngine().ServeHTTP(w, req)
+	return w
+}
+
+func bearer(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	keys := NewKeySet()
+	keys.AddHMACKey("v1", []byte("old-secret"))
+	keys.AddHMACKey("v2", []byte("new-secret"))
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.AddRSAPublicKey("rs", &rsaKey.PublicKey)
+	e := newTestEngine(NewJWT(JWTConfig{Keys: keys, Issuer: "gm"}))
+
+	claims := map[string]interface{}{"sub": "alice", "iss": "gm", "exp": time.Now().Add(time.Hour).Unix(), "scope": "gm.mail"}
+	oldToken, _ := SignHS("HS256", "v1", []byte("old-secret"), claims)
+	newToken, _ := SignHS("HS512", "v2", []byte("new-secret"), claims)
+	rsToken, _ := SignRS("RS256", "rs", rsaKey, claims)
+	for _, token := range []string{oldToken, newToken, rsToken} {
+		w := serve(e, bearer(httptest.NewRequest(http.MethodGet, "/admin/whoami", nil), token))
+		if w.Code != http.StatusOK || w.Body.String() != "jwt:alice" {
+			t.Fatalf("token verify fail:%v,%v", w.Code, w.Body.String())
+		}
+	}
+
+	// 轮换掉旧密钥
+	keys.Remove("v1")
+	if w := serve(e, bearer(httptest.NewRequest(http.MethodGet, "/admin/whoami", nil), oldToken)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("removed key status:%v", w.Code)
+	}
+
+	claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	expired, _ := SignHS("HS256", "v2", []byte("new-secret"), claims)
+	if w := serve(e, bearer(httptest.NewRequest(http.MethodGet, "/admin/whoami", nil), expired)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expired status:%v", w.Code)
+	}
+
+	// 有gm.mail但没有gm.mail.write
+	req := bearer(httptest.NewRequest(http.MethodPost, "/admin/mail/add", strings.NewReader(`{"title":"hi"}`)), newToken)
+	if w := serve(e, req); w.Code != http.StatusForbidden {
+		t.Fatalf("scope status:%v", w.Code)
+	}
+}
+
+func TestHMACReplay(t *testing.T) {
+	apps := map[string]*HMACApp{"sdk": {Secret: []byte("s3cret"), Scopes: []string{"gm.mail", "gm.mail.write"}}}
+	e := newTestEngine(NewHMAC(HMACConfig{Apps: func(appID string) (*HMACApp, bool) {
+		app, find := apps[appID]
+		return app, find
+	}}))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/mail/add?zone=1", strings.NewReader(`{"role_id":1,"title":"hi"}`))
+	if err := SignRequest(req, "sdk", []byte("s3cret")); err != nil {
+		t.Fatal(err)
+	}
+	w := serve(e, req)
+	if w.Code != http.StatusOK || w.Body.String() != "hi" {
+		t.Fatalf("hmac fail:%v,%v", w.Code, w.Body.String())
+	}
+
+	replay := httptest.NewRequest(http.MethodPost, "/admin/mail/add?zone=1", strings.NewReader(`{"role_id":1,"title":"hi"}`))
+	replay.Header = req.Header.Clone()
+	if w := serve(e, replay); w.Code != http.StatusUnauthorized {
+		t.Fatalf("replay status:%v", w.Code)
+	}
+
+	signed := httptest.NewRequest(http.MethodPost, "/admin/mail/add?zone=1", strings.NewReader(`{"role_id":1,"title":"hi"}`))
+	SignRequest(signed, "sdk", []byte("s3cret"))
+	tampered := httptest.NewRequest(http.MethodPost, "/admin/mail/add?zone=1", strings.NewReader(`{"role_id":2,"title":"hi"}`))
+	tampered.Header = signed.Header.Clone()
+	if w := serve(e, tampered); w.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered status:%v", w.Code)
+	}
+}
+
+func TestAPIKeyAndRouteScopes(t *testing.T) {
+	e := newTestEngine(NewAPIKey("", &APIKey{Name: "ops", Key: "k1", Scopes: []string{"*"}}))
+	req := httptest.NewRequest(http.MethodPost, "/admin/mail/add", strings.NewReader(`{"title":"hi"}`))
+	req.Header.Set(HeaderAPIKey, "k1")
+	if w := serve(e, req); w.Code != http.StatusOK {
+		t.Fatalf("api key status:%v", w.Code)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/admin/whoami", nil)
+	req.Header.Set("Authorization", "ApiKey k2")
+	if w := serve(e, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("invalid api key status:%v", w.Code)
+	}
+
+	route := e.TravelGroupTree()["/admin/mail/add"]
+	if route == nil || strings.Join(route.Scopes, ",") != "gm.mail,gm.mail.write" {
+		t.Fatalf("route scopes:%+v", route)
+	}
+}
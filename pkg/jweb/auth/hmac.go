@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+// hmac请求签名使用的头
+const (
+	HeaderAppID     = "X-App-Id"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// HMACApp 一个接入方的签名密钥和权限
+type HMACApp struct {
+	Secret []byte
+	Scopes []string
+}
+
+// NonceStore 记录用过的nonce防重放，多进程部署时可以实现为redis的SETNX
+type NonceStore interface {
+	// Use 第一次使用返回true，ttl内重复使用返回false
+	Use(key string, ttl time.Duration) bool
+}
+
+type memoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time), lastSweep: time.Now()}
+}
+
+func (s *memoryNonceStore) Use(key string, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= ttl {
+		s.lastSweep = now
+		for k, expire := range s.nonces {
+			if now.After(expire) {
+				delete(s.nonces, k)
+			}
+		}
+	}
+	if expire, find := s.nonces[key]; find && now.Before(expire) {
+		return false
+	}
+	s.nonces[key] = now.Add(ttl)
+	return true
+}
+
+type HMACConfig struct {
+	// Apps 按appid查找接入方，返回false表示appid不存在，可以对接配置中心实现动态增删
+	Apps func(appID string) (*HMACApp, bool)
+	// Window 时间戳允许的误差，默认5分钟，nonce保存两倍的窗口时间
+	Window time.Duration
+	// Nonces 防重放存储，默认内存实现
+	Nonces NonceStore
+	// MaxBodyBytes 参与签名的最大请求体，默认1MB
+	MaxBodyBytes int64
+}
+
+type hmacAuthenticator struct {
+	config HMACConfig
+	now    func() time.Time
+}
+
+// NewHMAC hmac-sha256请求签名认证，签名内容见CanonicalRequest，调用方使用SignRequest签名
+func NewHMAC(config HMACConfig) Authenticator {
+	if config.Window <= 0 {
+		config.Window = time.Minute * 5
+	}
+	if config.Nonces == nil {
+		config.Nonces = NewMemoryNonceStore()
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = 1 << 20
+	}
+	return &hmacAuthenticator{config: config, now: time.Now}
+}
+
+func (a *hmacAuthenticator) Authenticate(c *gin.Context) (*jweb.Principal, error) {
+	appID := c.GetHeader(HeaderAppID)
+	signature := c.GetHeader(HeaderSignature)
+	if appID == "" || signature == "" {
+		return nil, ErrNoCredentials
+	}
+	app, find := a.config.Apps(appID)
+	if !find {
+		return nil, fmt.Errorf("%w: app %v", ErrUnknownKey, appID)
+	}
+
+	timestamp := c.GetHeader(HeaderTimestamp)
+	nonce := c.GetHeader(HeaderNonce)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" {
+		return nil, fmt.Errorf("%w: invalid timestamp or nonce", ErrInvalidToken)
+	}
+	diff := a.now().Sub(time.Unix(ts, 0))
+	if diff > a.config.Window || diff < -a.config.Window {
+		return nil, fmt.Errorf("%w: timestamp out of window", ErrTokenExpired)
+	}
+
+	body, err := readAndRestoreBody(c.Request, a.config.MaxBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	expected := signCanonical(app.Secret, CanonicalRequest(c.Request.Method, c.Request.URL.Path,
+		c.Request.URL.Query(), timestamp, nonce, body))
+	got, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, got) {
+		return nil, ErrSignature
+	}
+
+	// 签名通过后再记录nonce，防止伪造请求消耗合法nonce
+	if !a.config.Nonces.Use(appID+":"+nonce, a.config.Window*2) {
+		return nil, ErrReplay
+	}
+
+	return &jweb.Principal{
+		Subject: appID,
+		Method:  "hmac",
+		Scopes:  app.Scopes,
+	}, nil
+}
+
+// CanonicalRequest 签名原文：方法、路径、按key排序的query、时间戳、nonce、body的sha256，以换行连接
+func CanonicalRequest(method, path string, query map[string][]string, timestamp, nonce string, body []byte) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, k+"="+v)
+		}
+	}
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		strings.Join(pairs, "&"),
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+func signCanonical(secret []byte, canonical string) []byte {
+	return hmacSum(crypto.SHA256, secret, []byte(canonical))
+}
+
+// SignRequest 调用方给请求签名，会读取并还原请求体
+func SignRequest(req *http.Request, appID string, secret []byte) error {
+	body, err := readAndRestoreBody(req, -1)
+	if err != nil {
+		return err
+	}
+	nonceBuf := make([]byte, 16)
+	if _, err := rand.Read(nonceBuf); err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := hex.EncodeToString(nonceBuf)
+	sig := signCanonical(secret, CanonicalRequest(req.Method, req.URL.Path, req.URL.Query(), timestamp, nonce, body))
+	req.Header.Set(HeaderAppID, appID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, hex.EncodeToString(sig))
+	return nil
+}
+
+// readAndRestoreBody 读取请求体后还原，后续的参数解析还能读到，maxBytes小于0不限制
+func readAndRestoreBody(req *http.Request, maxBytes int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	reader := io.Reader(req.Body)
+	if maxBytes >= 0 {
+		reader = io.LimitReader(req.Body, maxBytes+1)
+	}
+	body, err := io.ReadAll(reader)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("read body error:%v", err)
+	}
+	if maxBytes >= 0 && int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("body exceeds %v bytes", maxBytes)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+type jwtKey struct {
+	hmacSecret []byte
+	rsaPublic  *rsa.PublicKey
+}
+
+// KeySet jwt验证密钥集合，按kid区分，轮换密钥时先加入新密钥，旧token全部过期后再删除旧密钥，
+// 线程安全，可以在运行时从配置中心更新
+type KeySet struct {
+	mu   sync.RWMutex
+	keys map[string]*jwtKey
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]*jwtKey)}
+}
+
+// AddHMACKey 添加HS256/HS384/HS512密钥
+func (ks *KeySet) AddHMACKey(kid string, secret []byte) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys[kid] = &jwtKey{hmacSecret: secret}
+}
+
+// AddRSAPublicKey 添加RS256/RS384/RS512公钥
+func (ks *KeySet) AddRSAPublicKey(kid string, key *rsa.PublicKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys[kid] = &jwtKey{rsaPublic: key}
+}
+
+// AddRSAPublicKeyPEM 添加PEM格式的RSA公钥，支持PKIX和PKCS1
+func (ks *KeySet) AddRSAPublicKeyPEM(kid string, pemData []byte) error {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return fmt.Errorf("invalid pem data for key %v", kid)
+	}
+	if pub, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key %v is not rsa public key", kid)
+		}
+		ks.AddRSAPublicKey(kid, rsaPub)
+		return nil
+	}
+	rsaPub, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parse key %v error:%v", kid, err)
+	}
+	ks.AddRSAPublicKey(kid, rsaPub)
+	return nil
+}
+
+func (ks *KeySet) Remove(kid string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	delete(ks.keys, kid)
+}
+
+// candidates token指定了kid只用这个密钥，否则尝试所有密钥
+func (ks *KeySet) candidates(kid string) []*jwtKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if kid != "" {
+		k, find := ks.keys[kid]
+		if !find {
+			return nil
+		}
+		return []*jwtKey{k}
+	}
+	list := make([]*jwtKey, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		list = append(list, k)
+	}
+	return list
+}
+
+type JWTConfig struct {
+	Keys       *KeySet
+	Issuer     string        // 不为空时校验iss
+	Audience   string        // 不为空时校验aud
+	Leeway     time.Duration // 校验exp、nbf时允许的时钟误差
+	ScopeClaim string        // 权限所在的claim，默认"scope"，支持空格分隔的字符串或字符串数组
+	Header     string        // token所在的头，默认Authorization: Bearer xxx
+}
+
+type jwtAuthenticator struct {
+	config JWTConfig
+	now    func() time.Time
+}
+
+// NewJWT jwt认证，支持HS256/384/512、RS256/384/512
+func NewJWT(config JWTConfig) Authenticator {
+	if config.ScopeClaim == "" {
+		config.ScopeClaim = "scope"
+	}
+	if config.Header == "" {
+		config.Header = "Authorization"
+	}
+	return &jwtAuthenticator{config: config, now: time.Now}
+}
+
+func (a *jwtAuthenticator) Authenticate(c *gin.Context) (*jweb.Principal, error) {
+	token := c.GetHeader(a.config.Header)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	if a.config.Header == "Authorization" {
+		if !strings.HasPrefix(token, "Bearer ") {
+			return nil, ErrNoCredentials
+		}
+		token = strings.TrimPrefix(token, "Bearer ")
+	}
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	return &jweb.Principal{
+		Subject: sub,
+		Method:  "jwt",
+		Scopes:  parseScopes(claims[a.config.ScopeClaim]),
+		Claims:  claims,
+	}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+func (a *jwtAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	headerBuf, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	header := new(jwtHeader)
+	if err := json.Unmarshal(headerBuf, header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+
+	verified := false
+	for _, key := range a.config.Keys.candidates(header.Kid) {
+		if verifyJWTSignature(header.Alg, key, signingInput, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		if header.Kid != "" && len(a.config.Keys.candidates(header.Kid)) == 0 {
+			return nil, ErrUnknownKey
+		}
+		return nil, ErrSignature
+	}
+
+	claimsBuf, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(claimsBuf, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := a.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (a *jwtAuthenticator) validateClaims(claims map[string]interface{}) error {
+	now := a.now()
+	if exp, ok := claims["exp"].(float64); ok {
+		if now.After(time.Unix(int64(exp), 0).Add(a.config.Leeway)) {
+			return ErrTokenExpired
+		}
+	}
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Add(a.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+			return ErrInvalidToken
+		}
+	}
+	if a.config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.config.Issuer {
+			return fmt.Errorf("%w: issuer %v", ErrInvalidToken, iss)
+		}
+	}
+	if a.config.Audience != "" {
+		found := false
+		for _, aud := range parseScopes(claims["aud"]) {
+			if aud == a.config.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: audience mismatch", ErrInvalidToken)
+		}
+	}
+	return nil
+}
+
+func jwtHash(alg string) (crypto.Hash, bool) {
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, true
+	case "384":
+		return crypto.SHA384, true
+	case "512":
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+func verifyJWTSignature(alg string, key *jwtKey, signingInput, sig []byte) bool {
+	if len(alg) != 5 {
+		return false
+	}
+	hash, ok := jwtHash(alg)
+	if !ok {
+		return false
+	}
+	switch alg[:2] {
+	case "HS":
+		if key.hmacSecret == nil {
+			return false
+		}
+		return hmac.Equal(hmacSum(hash, key.hmacSecret, signingInput), sig)
+	case "RS":
+		if key.rsaPublic == nil {
+			return false
+		}
+		h := hash.New()
+		h.Write(signingInput)
+		return rsa.VerifyPKCS1v15(key.rsaPublic, hash, h.Sum(nil), sig) == nil
+	}
+	return false
+}
+
+func hmacSum(hash crypto.Hash, secret, data []byte) []byte {
+	var mac = hmac.New(sha256.New, secret)
+	switch hash {
+	case crypto.SHA384:
+		mac = hmac.New(sha512.New384, secret)
+	case crypto.SHA512:
+		mac = hmac.New(sha512.New, secret)
+	}
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// SignHS 签发HS256/384/512的token，用于内部服务签发后台登录态
+func SignHS(alg, kid string, secret []byte, claims map[string]interface{}) (string, error) {
+	if len(alg) != 5 || alg[:2] != "HS" {
+		return "", fmt.Errorf("unsupport alg:%v", alg)
+	}
+	hash, ok := jwtHash(alg)
+	if !ok {
+		return "", fmt.Errorf("unsupport alg:%v", alg)
+	}
+	signingInput, err := jwtSigningInput(alg, kid, claims)
+	if err != nil {
+		return "", err
+	}
+	sig := hmacSum(hash, secret, []byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// SignRS 签发RS256/384/512的token
+func SignRS(alg, kid string, key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	if len(alg) != 5 || alg[:2] != "RS" {
+		return "", fmt.Errorf("unsupport alg:%v", alg)
+	}
+	hash, ok := jwtHash(alg)
+	if !ok {
+		return "", fmt.Errorf("unsupport alg:%v", alg)
+	}
+	signingInput, err := jwtSigningInput(alg, kid, claims)
+	if err != nil {
+		return "", err
+	}
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, hash, h.Sum(nil))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func jwtSigningInput(alg, kid string, claims map[string]interface{}) (string, error) {
+	headerBuf, err := json.Marshal(&jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claimsBuf, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(headerBuf) + "." + base64.RawURLEncoding.EncodeToString(claimsBuf), nil
+}
+
+// parseScopes 支持空格分隔的字符串和字符串数组
+func parseScopes(v interface{}) []string {
+	switch s := v.(type) {
+	case string:
+		return strings.Fields(s)
+	case []interface{}:
+		list := make([]string, 0, len(s))
+		for _, item := range s {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+	return nil
+}
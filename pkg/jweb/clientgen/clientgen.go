@@ -0,0 +1,319 @@
+// Package clientgen 根据jweb引擎的路由表生成类型化的调用客户端，用法：
+// 在服务里写一个只注册路由不启动的生成程序，
+//
+//	//go:generate go run ./gen -o ../gmclient/client_gen.go -pkg gmclient
+//	func main() {
+//		e := gm.NewEngine(":0")
+//		clientgen.Main(e)
+//	}
+//
+// 生成的客户端基于jclient，带超时、重试、请求id透传
+package clientgen
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+// RouteTable Engine和RouterGroup都实现了
+type RouteTable interface {
+	TravelGroupTree() map[string]*jweb.RouteInfo
+}
+
+type Options struct {
+	Package    string // 生成代码的包名
+	ClientName string // 客户端类型名，默认Client
+	PathPrefix string // 只生成这个前缀下的路由
+}
+
+type generator struct {
+	opts    Options
+	imports map[string]string // path -> name
+}
+
+type routeData struct {
+	Name        string
+	Method      string
+	Path        string
+	Desc        string
+	Scopes      string
+	PathParams  []string
+	PathExpr    string
+	HasParams   bool
+	RequestType string
+	RequestDef  string
+}
+
+// Generate 生成客户端源码
+func Generate(table RouteTable, opts Options) ([]byte, error) {
+	if opts.Package == "" {
+		return nil, fmt.Errorf("package name is empty")
+	}
+	if opts.ClientName == "" {
+		opts.ClientName = "Client"
+	}
+	g := &generator{opts: opts, imports: map[string]string{
+		"context": "context",
+		"joynova.com/library/supernova/pkg/jweb/jclient": "jclient",
+	}}
+
+	routes := table.TravelGroupTree()
+	paths := make([]string, 0, len(routes))
+	for p := range routes {
+		if strings.HasPrefix(normalizePath(p), opts.PathPrefix) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	usedNames := make(map[string]int)
+	list := make([]*routeData, 0, len(paths))
+	for _, p := range paths {
+		ri := routes[p]
+		path := normalizePath(p)
+		name := methodName(path)
+		usedNames[name]++
+		if usedNames[name] > 1 {
+			name = fmt.Sprintf("%v%v", name, usedNames[name])
+		}
+		rd := &routeData{
+			Name:   name,
+			Method: ri.Method,
+			Path:   path,
+			Desc:   ri.Desc,
+			Scopes: strings.Join(ri.Scopes, ","),
+		}
+		rd.PathParams, rd.PathExpr = pathParams(path)
+		if ri.StructTemplate != nil {
+			to := reflect.TypeOf(ri.StructTemplate)
+			if to.Kind() != reflect.Struct {
+				return nil, fmt.Errorf("route %v struct template must be struct, got %v", path, to.Kind())
+			}
+			rd.HasParams = true
+			rd.RequestType = name + "Request"
+			rd.RequestDef = g.structBody(to, 0)
+		}
+		list = append(list, rd)
+	}
+
+	if hasPathParams(list) {
+		g.imports["net/url"] = "url"
+	}
+
+	buf := new(bytes.Buffer)
+	err := fileTemplate.Execute(buf, map[string]interface{}{
+		"Package": opts.Package,
+		"Client":  opts.ClientName,
+		"Imports": g.sortedImports(),
+		"Routes":  list,
+	})
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code error:%v\n%s", err, buf.String())
+	}
+	return src, nil
+}
+
+// Main 供go:generate调用的入口，解析-o、-pkg、-client、-prefix参数写入文件
+func Main(table RouteTable) {
+	output := flag.String("o", "client_gen.go", "output file")
+	pkg := flag.String("pkg", "", "package name, default output dir name")
+	client := flag.String("client", "Client", "client type name")
+	prefix := flag.String("prefix", "", "only generate routes with path prefix")
+	flag.Parse()
+
+	if *pkg == "" {
+		abs, err := filepath.Abs(*output)
+		if err == nil {
+			*pkg = filepath.Base(filepath.Dir(abs))
+		}
+	}
+	src, err := Generate(table, Options{Package: *pkg, ClientName: *client, PathPrefix: *prefix})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "generate client error:%v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "write %v error:%v\n", *output, err)
+		os.Exit(1)
+	}
+}
+
+func normalizePath(p string) string {
+	for strings.Contains(p, "//") {
+		p = strings.ReplaceAll(p, "//", "/")
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+// methodName /group1/mail/add -> Group1MailAdd
+func methodName(path string) string {
+	parts := strings.FieldsFunc(path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	name := ""
+	for _, p := range parts {
+		runes := []rune(p)
+		runes[0] = unicode.ToUpper(runes[0])
+		name += string(runes)
+	}
+	if name == "" {
+		return "Root"
+	}
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "R" + name
+	}
+	return name
+}
+
+// pathParams 处理gin的:id、*file路径参数，生成拼接路径的表达式
+func pathParams(path string) ([]string, string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	exprs := make([]string, 0, len(segments))
+	literal := ""
+	for i, seg := range segments {
+		if i > 0 {
+			literal += "/"
+		}
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			name := seg[1:]
+			params = append(params, name)
+			exprs = append(exprs, fmt.Sprintf("%q", literal), "url.PathEscape("+name+")")
+			literal = ""
+			continue
+		}
+		literal += seg
+	}
+	if literal != "" || len(exprs) == 0 {
+		exprs = append(exprs, fmt.Sprintf("%q", literal))
+	}
+	return params, strings.Join(exprs, " + ")
+}
+
+func hasPathParams(list []*routeData) bool {
+	for _, rd := range list {
+		if len(rd.PathParams) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// structBody 以结构体模板的字段生成同样json tag的结构体，客户端不需要依赖服务端的包
+func (g *generator) structBody(to reflect.Type, depth int) string {
+	buf := new(strings.Builder)
+	buf.WriteString("struct {\n")
+	for i := 0; i < to.NumField(); i++ {
+		f := to.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if f.Anonymous {
+			fmt.Fprintf(buf, "%v", g.typeString(f.Type, depth+1))
+		} else {
+			fmt.Fprintf(buf, "%v %v", f.Name, g.typeString(f.Type, depth+1))
+		}
+		if f.Tag != "" {
+			fmt.Fprintf(buf, " `%v`", f.Tag)
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+func (g *generator) typeString(t reflect.Type, depth int) string {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name()
+		}
+		str := t.String()
+		g.imports[t.PkgPath()] = str[:strings.Index(str, ".")]
+		return str
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + g.typeString(t.Elem(), depth)
+	case reflect.Slice:
+		return "[]" + g.typeString(t.Elem(), depth)
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%v", t.Len(), g.typeString(t.Elem(), depth))
+	case reflect.Map:
+		return fmt.Sprintf("map[%v]%v", g.typeString(t.Key(), depth), g.typeString(t.Elem(), depth))
+	case reflect.Struct:
+		return g.structBody(t, depth)
+	}
+	return t.String()
+}
+
+// sortedImports 标准库和其它库分两组
+func (g *generator) sortedImports() [][][2]string {
+	std := make([][2]string, 0, len(g.imports))
+	others := make([][2]string, 0, len(g.imports))
+	for path, name := range g.imports {
+		alias := ""
+		if filepath.Base(path) != name {
+			alias = name
+		}
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			others = append(others, [2]string{alias, path})
+		} else {
+			std = append(std, [2]string{alias, path})
+		}
+	}
+	for _, list := range [][][2]string{std, others} {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i][1] < list[j][1]
+		})
+	}
+	return [][][2]string{std, others}
+}
+
+var fileTemplate = template.Must(template.New("client").Parse(`// Code generated by jweb clientgen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+{{- range $i, $group := .Imports }}
+{{ range $group }}
+	{{- index . 0 }} "{{ index . 1 }}"
+{{ end }}
+{{- end }}
+)
+
+type {{ .Client }} struct {
+	*jclient.Client
+}
+
+func New{{ .Client }}(baseURL string, options ...jclient.Option) *{{ .Client }} {
+	return &{{ .Client }}{Client: jclient.New(baseURL, options...)}
+}
+{{ range .Routes }}
+{{- if .HasParams }}
+// {{ .RequestType }} {{ .Desc }}的参数
+type {{ .RequestType }} {{ .RequestDef }}
+{{ end }}
+// {{ .Name }} {{ .Desc }}
+// {{ .Method }} {{ .Path }}{{ if .Scopes }}, scopes: {{ .Scopes }}{{ end }}
+func (c *{{ $.Client }}) {{ .Name }}(ctx context.Context{{ range .PathParams }}, {{ . }} string{{ end }}{{ if .HasParams }}, req *{{ .RequestType }}{{ end }}, out interface{}) error {
+	return c.Do(ctx, "{{ .Method }}", {{ .PathExpr }}, {{ if .HasParams }}req{{ else }}nil{{ end }}, out)
+}
+{{ end }}`))
@@ -0,0 +1,80 @@
+package clientgen
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+type testContext struct {
+	c *gin.Context
+}
+
+func (c *testContext) SetGinContext(ctx *gin.Context) {
+	c.c = ctx
+}
+
+func (c *testContext) GetGinContext() *gin.Context {
+	return c.c
+}
+
+func (c *testContext) ResponseParseParamsFieldFail(path string, field string, value string, err error) {
+}
+
+type MailParams struct {
+	RoleID   int       `json:"role_id" desc:"角色id"`
+	Items    []int32   `json:"items"`
+	SendTime time.Time `json:"send_time"`
+	Extra    struct {
+		Source string `json:"source"`
+	} `json:"extra"`
+}
+
+func TestGenerate(t *testing.T) {
+	e := jweb.NewEngine(":0", func() jweb.Context {
+		return new(testContext)
+	})
+	e.Get("/index", "首页", func(c *testContext) {})
+	grp := e.Group("/gm", jweb.RequireScopes("gm"))
+	grp.PostWithStructParams("mail/add", "发邮件", MailParams{}, func(c *testContext, p *MailParams) {})
+	grp.Get("/role/:id", "角色信息", func(c *testContext) {})
+
+	src, err := Generate(e, Options{Package: "gmclient"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "client_gen.go", src, 0); err != nil {
+		t.Fatalf("generated code invalid:%v\n%s", err, src)
+	}
+
+	code := string(src)
+	for _, expect := range []string{
+		"package gmclient",
+		`"time"`,
+		"func (c *Client) Index(ctx context.Context, out interface{}) error",
+		"type GmMailAddRequest struct",
+		"SendTime time.Time `json:\"send_time\"`",
+		"func (c *Client) GmMailAdd(ctx context.Context, req *GmMailAddRequest, out interface{}) error",
+		`return c.Do(ctx, "POST", "/gm/mail/add", req, out)`,
+		"// POST /gm/mail/add, scopes: gm",
+		"func (c *Client) GmRoleId(ctx context.Context, id string, out interface{}) error",
+		`"/gm/role/"+url.PathEscape(id)`,
+	} {
+		if !strings.Contains(code, expect) {
+			t.Fatalf("generated code not contains %v:\n%s", expect, code)
+		}
+	}
+
+	src, err = Generate(e, Options{Package: "gmclient", PathPrefix: "/index"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(src), "GmMailAdd") {
+		t.Fatalf("prefix filter not work:\n%s", src)
+	}
+}
@@ -1,6 +1,9 @@
 package jweb
 
 import (
+	"io"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -9,3 +12,30 @@ type Context interface {
 	GetGinContext() *gin.Context
 	ResponseParseParamsFieldFail(path string, field string, value string, err error)
 }
+
+// BaseContext 实现了Context的gin上下文读写，业务Context内嵌它即可使用SSE、Stream：
+//
+//	type MyContext struct {
+//		jweb.BaseContext
+//	}
+type BaseContext struct {
+	c *gin.Context
+}
+
+func (b *BaseContext) SetGinContext(ctx *gin.Context) {
+	b.c = ctx
+}
+
+func (b *BaseContext) GetGinContext() *gin.Context {
+	return b.c
+}
+
+// SSE 将当前请求转换为sse响应，见NewSSEStream
+func (b *BaseContext) SSE(heartbeat time.Duration) (*SSEStream, error) {
+	return NewSSEStream(b.c, heartbeat)
+}
+
+// Stream 分块下载，见Stream
+func (b *BaseContext) Stream(contentType string, fileName string, size int64, reader io.Reader) error {
+	return Stream(b.c, contentType, fileName, size, reader)
+}
@@ -4,6 +4,7 @@ import (
 	"reflect"
 
 	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jlog"
 )
 
 func init() {
@@ -18,6 +19,7 @@ type RouterGroup struct {
 	group         *gin.RouterGroup
 	GroupRoutes   map[string]*RouterGroup
 	Routes        map[string]*RouteInfo
+	Scopes        []string // 组内所有路由需要的权限
 	newContextFun func() Context
 }
 
@@ -31,13 +33,16 @@ func newRouterGroup(group *gin.RouterGroup, newContextFun func() Context) *Route
 	}
 }
 
+// Use 挂载组中间件，其中RequireScopes声明的权限记录到组的Scopes，应在注册路由之前调用
 func (g *RouterGroup) Use(middleware ...HandlerFunc) {
-	g.group.Use(getGinHandlerFun(g.newContextFun, nil, middleware...))
+	g.Scopes = append(g.Scopes, collectScopes(middleware)...)
+	g.group.Use(toGinHandlers(g.newContextFun, nil, middleware...)...)
 }
 
 func (g *RouterGroup) Group(path string, handlers ...HandlerFunc) *RouterGroup {
-	grp := g.group.Group(path, getGinHandlerFun(g.newContextFun, nil, handlers...))
+	grp := g.group.Group(path, toGinHandlers(g.newContextFun, nil, handlers...)...)
 	grp1 := newRouterGroup(grp, g.newContextFun)
+	grp1.Scopes = collectScopes(handlers)
 	g.GroupRoutes[path] = grp1
 	return grp1
 }
@@ -47,16 +52,16 @@ func (g *RouterGroup) Get(path string, desc string, handlers ...HandlerFunc) gin
 }
 
 func (g *RouterGroup) GetWithStructParams(path string, desc string, structTemplate interface{}, handlers ...HandlerFunc) gin.IRoutes {
-	g.Routes[path] = &RouteInfo{Desc: desc, Method: "GET", StructTemplate: structTemplate}
-	return g.group.GET(path, getGinHandlerFun(g.newContextFun, structTemplate, handlers...))
+	g.Routes[path] = &RouteInfo{Desc: desc, Method: "GET", StructTemplate: structTemplate, Scopes: collectScopes(handlers)}
+	return g.group.GET(path, toGinHandlers(g.newContextFun, structTemplate, handlers...)...)
 }
 
 func (g *RouterGroup) Post(path string, desc string, handlers ...HandlerFunc) gin.IRoutes {
-	return g.PostWithStructParams(path, desc, nil, handlers)
+	return g.PostWithStructParams(path, desc, nil, handlers...)
 }
 func (g *RouterGroup) PostWithStructParams(path string, desc string, structTemplate interface{}, handlers ...HandlerFunc) gin.IRoutes {
-	g.Routes[path] = &RouteInfo{Desc: desc, Method: "POST", StructTemplate: structTemplate}
-	return g.group.POST(path, getGinHandlerFun(g.newContextFun, structTemplate, handlers...))
+	g.Routes[path] = &RouteInfo{Desc: desc, Method: "POST", StructTemplate: structTemplate, Scopes: collectScopes(handlers)}
+	return g.group.POST(path, toGinHandlers(g.newContextFun, structTemplate, handlers...)...)
 }
 
 func (g *RouterGroup) TravelGroupTree() map[string]*RouteInfo {
@@ -73,44 +78,78 @@ func (g *RouterGroup) TravelGroupTree() map[string]*RouteInfo {
 			if k1[0] != '/' {
 				k1 = "/" + k1
 			}
-			m[k+k1] = v1
+			m[k+k1] = v1.withGroupScopes(subG.Scopes)
 		}
 	}
 	return m
 }
 
 type Engine struct {
-	addr          string
-	basePath      string
-	ginEngine     *gin.Engine
-	GroupRoutes   map[string]*RouterGroup // 组路由
-	Routes        map[string]*RouteInfo   // 直接路由
-	newContextFun func() Context
+	addr              string
+	basePath          string
+	ginEngine         *gin.Engine
+	GroupRoutes       map[string]*RouterGroup // 组路由
+	Routes            map[string]*RouteInfo   // 直接路由
+	Scopes            []string                // Use挂载的所有路由需要的权限
+	newContextFun     func() Context
+	withoutGinDefault bool          // 不使用gin默认的日志、恢复中间件
+	initMiddleware    []HandlerFunc // 创建时挂载的中间件
+	trustedProxies    []string      // 信任的反向代理
+	remoteIPHeaders   []string      // 从代理解析客户端ip的头
 }
 
-func NewEngine(addr string, newContextFun func() Context) *Engine {
+func NewEngine(addr string, newContextFun func() Context, options ...Option) *Engine {
 	engine := &Engine{
 		addr:          addr,
-		ginEngine:     gin.Default(),
 		newContextFun: newContextFun,
 		GroupRoutes:   make(map[string]*RouterGroup),
 		Routes:        make(map[string]*RouteInfo),
 	}
-	engine.ginEngine.SetTrustedProxies([]string{addr})
+	for _, op := range options {
+		op.Apply(engine)
+	}
+	if engine.withoutGinDefault {
+		engine.ginEngine = gin.New()
+	} else {
+		engine.ginEngine = gin.Default()
+	}
+	engine.setTrustedProxies()
+	if len(engine.initMiddleware) > 0 {
+		engine.Use(engine.initMiddleware...)
+	}
 	return engine
 }
 
+// setTrustedProxies 设置信任的代理，配置错误时不信任任何代理，防止伪造X-Forwarded-For绕过ip限制
+func (e *Engine) setTrustedProxies() {
+	if len(e.remoteIPHeaders) > 0 {
+		e.ginEngine.RemoteIPHeaders = e.remoteIPHeaders
+	}
+	if len(e.trustedProxies) == 0 {
+		e.ginEngine.SetTrustedProxies(nil)
+		return
+	}
+	err := e.ginEngine.SetTrustedProxies(e.trustedProxies)
+	if err != nil {
+		jlog.Errorf("jweb engine(%v) set trusted proxies(%v) error:%v, trust none", e.addr, e.trustedProxies, err)
+		e.ginEngine.SetTrustedProxies(nil)
+	}
+}
+
 func (e *Engine) EnableDebugMode() {
 	gin.SetMode(gin.DebugMode)
 }
 
+// Use 挂载全局中间件，其中RequireScopes声明的权限记录到Scopes，应在注册路由之前调用
 func (e *Engine) Use(middleware ...HandlerFunc) {
-	e.ginEngine.Use(getGinHandlerFun(e.newContextFun, nil, middleware...))
+	e.Scopes = append(e.Scopes, collectScopes(middleware)...)
+	e.ginEngine.Use(toGinHandlers(e.newContextFun, nil, middleware...)...)
 }
 
 func (e *Engine) Group(path string, handlers ...HandlerFunc) *RouterGroup {
-	grp := e.ginEngine.Group(path, getGinHandlerFun(e.newContextFun, nil, handlers...))
+	grp := e.ginEngine.Group(path, toGinHandlers(e.newContextFun, nil, handlers...)...)
 	grp1 := newRouterGroup(grp, e.newContextFun)
+	grp1.Scopes = collectScopes(handlers)
 	e.GroupRoutes[path] = grp1
 	return grp1
 }
@@ -120,8 +159,8 @@ func (e *Engine) Get(path string, desc string, handlers ...HandlerFunc) gin.IRou
 }
 
 func (e *Engine) GetWithStructParams(path string, desc string, structTemplate interface{}, handlers ...HandlerFunc) gin.IRoutes {
-	e.Routes[path] = &RouteInfo{Desc: desc, Method: "GET", StructTemplate: structTemplate}
-	return e.ginEngine.GET(path, getGinHandlerFun(e.newContextFun, structTemplate, handlers...))
+	e.Routes[path] = &RouteInfo{Desc: desc, Method: "GET", StructTemplate: structTemplate, Scopes: collectScopes(handlers)}
+	return e.ginEngine.GET(path, toGinHandlers(e.newContextFun, structTemplate, handlers...)...)
 }
 
 func (e *Engine) Post(path string, desc string, handlers ...HandlerFunc) gin.IRoutes {
@@ -129,8 +168,8 @@ func (e *Engine) Post(path string, desc string, handlers ...HandlerFunc) gin.IRo
 }
 
 func (e *Engine) PostWithStructParams(path string, desc string, structTemplate interface{}, handlers ...HandlerFunc) gin.IRoutes {
-	e.Routes[path] = &RouteInfo{Desc: desc, Method: "POST", StructTemplate: structTemplate}
-	return e.ginEngine.POST(path, getGinHandlerFun(e.newContextFun, structTemplate, handlers...))
+	e.Routes[path] = &RouteInfo{Desc: desc, Method: "POST", StructTemplate: structTemplate, Scopes: collectScopes(handlers)}
+	return e.ginEngine.POST(path, toGinHandlers(e.newContextFun, structTemplate, handlers...)...)
 }
 
 func (e *Engine) TravelGroupTree() map[string]*RouteInfo {
@@ -139,7 +178,7 @@ func (e *Engine) TravelGroupTree() map[string]*RouteInfo {
 		if k[0] != '/' {
 			k = "/" + k
 		}
-		m[k] = route
+		m[k] = route.withGroupScopes(e.Scopes)
 	}
 	for k, subG := range e.GroupRoutes {
 		gm := subG.TravelGroupTree()
@@ -147,7 +186,7 @@ func (e *Engine) TravelGroupTree() map[string]*RouteInfo {
 			if k1[0] != '/' {
 				k1 = "/" + k1
 			}
-			m[k+k1] = v1
+			m[k+k1] = v1.withGroupScopes(subG.Scopes).withGroupScopes(e.Scopes)
 		}
 	}
 	return m
@@ -165,6 +204,36 @@ func (e *Engine) GetGinEngine() *gin.Engine {
 	return e.ginEngine
 }
 
+// toGinHandlers 将处理函数转换为gin的处理函数，gin原生的处理函数（例如middleware包里的中间件）单独挂载，
+// 这样中间件内部可以调用c.Next()包裹后续处理流程，其余连续的处理函数合并为一个gin处理函数
+func toGinHandlers(newContextFun func() Context, structTemplate interface{}, handlers ...HandlerFunc) []gin.HandlerFunc {
+	list := make([]gin.HandlerFunc, 0, len(handlers))
+	batch := make([]HandlerFunc, 0, len(handlers))
+	flush := func() {
+		if len(batch) > 0 {
+			list = append(list, getGinHandlerFun(newContextFun, structTemplate, batch...))
+			batch = make([]HandlerFunc, 0, len(handlers))
+		}
+	}
+	for _, h := range handlers {
+		switch f := h.(type) {
+		case gin.HandlerFunc:
+			flush()
+			list = append(list, f)
+		case func(*gin.Context):
+			flush()
+			list = append(list, f)
+		case scopeRequirement:
+			flush()
+			list = append(list, f.ginHandler())
+		default:
+			batch = append(batch, h)
+		}
+	}
+	flush()
+	return list
+}
+
 func getGinHandlerFun(newContextFun func() Context, structTemplate interface{}, handlers ...HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := newContextFun()
@@ -215,3 +215,25 @@ func (t *Tree) Paths() []*Path {
 	})
 	return list
 }
+
+func TestUseScopes(t *testing.T) {
+	e := NewEngine(":0", func() Context {
+		return new(streamContext)
+	}, WithoutGinDefault())
+	e.Use(RequireScopes("gm"))
+	e.Get("/ping", "ping", func(c *streamContext) {})
+	grp := e.Group("/gm")
+	grp.Use(RequireScopes("gm.mail"))
+	grp.Post("/mail/add", "发邮件", RequireScopes("gm.mail.add"), func(c *streamContext) {})
+
+	routes := e.TravelGroupTree()
+	if got := fmt.Sprint(routes["/ping"].Scopes); got != "[gm]" {
+		t.Fatalf("/ping scopes %v", got)
+	}
+	if got := fmt.Sprint(routes["/gm/mail/add"].Scopes); got != "[gm gm.mail gm.mail.add]" {
+		t.Fatalf("/gm/mail/add scopes %v", got)
+	}
+	if got := fmt.Sprint(grp.Scopes); got != "[gm.mail]" {
+		t.Fatalf("group scopes %v", got)
+	}
+}
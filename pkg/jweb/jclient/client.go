@@ -0,0 +1,263 @@
+// Package jclient 调用jweb接口的http客户端，clientgen生成的类型化客户端基于它实现
+package jclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"joynova.com/library/supernova/pkg/jlog"
+	"joynova.com/library/supernova/pkg/jweb/middleware"
+)
+
+// StatusError 接口返回非2xx
+type StatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%v %v status %v: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+// Client 调用jweb接口的http客户端，并发安全。
+// 只透传context中的请求id(X-Request-ID)作为上下游关联的id，不处理traceparent等链路追踪头，
+// 需要时用WithBeforeRequest从req.Context()取出后注入
+type Client struct {
+	baseURL            string
+	httpClient         *http.Client
+	timeout            time.Duration
+	retries            int
+	backoff            time.Duration
+	retryNonIdempotent bool
+	headers            http.Header
+	beforeRequest      []func(req *http.Request)
+}
+
+// New 创建客户端，baseURL例如http://127.0.0.1:5001
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		timeout:    time.Second * 10,
+		backoff:    time.Millisecond * 100,
+		headers:    make(http.Header),
+	}
+	for _, op := range options {
+		op.Apply(c)
+	}
+	return c
+}
+
+// Do 调用一个接口，GET的参数按json tag编码到query，POST的参数编码为json body，
+// 与jweb的参数解析规则一致，out不为空时以json解析响应，out为*[]byte时返回原始响应
+func (c *Client) Do(ctx context.Context, method, path string, params interface{}, out interface{}) error {
+	var body []byte
+	query := ""
+	if params != nil {
+		if method == http.MethodGet {
+			values, err := EncodeQuery(params)
+			if err != nil {
+				return fmt.Errorf("encode %v %v params error:%v", method, path, err)
+			}
+			query = values.Encode()
+		} else {
+			buf, err := json.Marshal(params)
+			if err != nil {
+				return fmt.Errorf("encode %v %v params error:%v", method, path, err)
+			}
+			body = buf
+		}
+	}
+
+	fullURL := c.baseURL + path
+	if query != "" {
+		fullURL += "?" + query
+	}
+
+	retries := c.retries
+	if method != http.MethodGet && !c.retryNonIdempotent {
+		retries = 0
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			wait := c.backoff * time.Duration(1<<(attempt-1))
+			jlog.Warnf("[jclient] retry %v %v attempt %v after %v, last error:%v", method, path, attempt, wait, lastErr)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		respBody, err := c.doOnce(ctx, method, fullURL, path, body)
+		if err == nil {
+			return decodeResponse(respBody, out)
+		}
+		lastErr = err
+		if !retryable(err) {
+			break
+		}
+	}
+	return lastErr
+}
+
+func (c *Client) doOnce(ctx context.Context, method, fullURL, path string, body []byte) ([]byte, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.headers {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// 透传请求id，串起上下游的访问日志
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		req.Header.Set(middleware.HeaderRequestID, id)
+	}
+	for _, f := range c.beforeRequest {
+		f(req)
+	}
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		jlog.Warnf("[jclient] %v %v request_id:%v error:%v", method, path, req.Header.Get(middleware.HeaderRequestID), err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	jlog.Debugf("[jclient] %v %v request_id:%v status:%v latency:%v", method, path,
+		req.Header.Get(middleware.HeaderRequestID), resp.StatusCode, time.Since(start))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &StatusError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: respBody}
+	}
+	return respBody, nil
+}
+
+func decodeResponse(body []byte, out interface{}) error {
+	if out == nil {
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw = body
+		return nil
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+// retryable 网络错误、5xx、429可以重试
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= http.StatusInternalServerError || se.StatusCode == http.StatusTooManyRequests
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// EncodeQuery 按json tag将结构体编码为query，slice以逗号连接，与jweb的query解析一致
+func EncodeQuery(params interface{}) (url.Values, error) {
+	values := make(url.Values)
+	v := reflect.ValueOf(params)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return values, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("params must be struct, got %v", v.Kind())
+	}
+	to := v.Type()
+	for i := 0; i < to.NumField(); i++ {
+		f := to.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		str, ok, err := formatValue(v.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("field %v:%v", f.Name, err)
+		}
+		if ok {
+			values.Set(name, str)
+		}
+	}
+	return values, nil
+}
+
+func formatValue(field reflect.Value) (string, bool, error) {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return "", false, nil
+		}
+		field = field.Elem()
+	}
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(field.Float(), 'f', -1, field.Type().Bits()), true, nil
+	case reflect.Slice:
+		list := make([]string, 0, field.Len())
+		for i := 0; i < field.Len(); i++ {
+			str, _, err := formatValue(field.Index(i))
+			if err != nil {
+				return "", false, err
+			}
+			list = append(list, str)
+		}
+		return strings.Join(list, ","), true, nil
+	}
+	return "", false, fmt.Errorf("unsupport query type %v", field.Type())
+}
@@ -0,0 +1,86 @@
+package jclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jweb"
+	"joynova.com/library/supernova/pkg/jweb/middleware"
+)
+
+type testContext struct {
+	c *gin.Context
+}
+
+func (c *testContext) SetGinContext(ctx *gin.Context) {
+	c.c = ctx
+}
+
+func (c *testContext) GetGinContext() *gin.Context {
+	return c.c
+}
+
+func (c *testContext) ResponseParseParamsFieldFail(path string, field string, value string, err error) {
+	c.c.String(http.StatusBadRequest, err.Error())
+}
+
+type QueryParams struct {
+	RoleID int      `json:"role_id"`
+	Names  []string `json:"names"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	e := jweb.NewEngine(":0", func() jweb.Context {
+		return new(testContext)
+	}, jweb.WithoutGinDefault(), jweb.WithMiddleware(middleware.RequestID()))
+
+	var flaky int32
+	e.GetWithStructParams("/query", "query", QueryParams{}, func(c *testContext, p *QueryParams) {
+		if atomic.AddInt32(&flaky, 1) == 1 {
+			c.GetGinContext().Status(http.StatusServiceUnavailable)
+			return
+		}
+		c.GetGinContext().JSON(http.StatusOK, map[string]interface{}{
+			"role_id":    p.RoleID,
+			"names":      strings.Join(p.Names, "|"),
+			"request_id": middleware.GetRequestID(c.GetGinContext()),
+		})
+	})
+	e.PostWithStructParams("/post", "post", QueryParams{}, func(c *testContext, p *QueryParams) {
+		c.GetGinContext().JSON(http.StatusOK, p)
+	})
+	e.Post("/fail", "fail", func(c *testContext) {
+		c.GetGinContext().Status(http.StatusInternalServerError)
+	})
+
+	client, closeFun := NewTestServerClient(e, WithRetries(2, time.Millisecond))
+	defer closeFun()
+
+	ctx := middleware.WithRequestID(context.Background(), "req-1")
+	res := make(map[string]interface{})
+	err := client.Do(ctx, http.MethodGet, "/query", &QueryParams{RoleID: 3, Names: []string{"a", "b"}}, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["role_id"].(float64) != 3 || res["names"] != "a|b" || res["request_id"] != "req-1" {
+		t.Fatalf("get response:%+v", res)
+	}
+
+	out := new(QueryParams)
+	if err := client.Do(ctx, http.MethodPost, "/post", &QueryParams{RoleID: 4}, out); err != nil || out.RoleID != 4 {
+		t.Fatalf("post response:%+v,%v", out, err)
+	}
+
+	// POST默认不重试
+	err = client.Do(ctx, http.MethodPost, "/fail", nil, nil)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("post fail error:%v", err)
+	}
+}
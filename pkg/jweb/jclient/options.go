@@ -0,0 +1,59 @@
+package jclient
+
+import (
+	"net/http"
+	"time"
+)
+
+type Option interface {
+	Apply(c *Client)
+}
+
+type optionFunction func(c *Client)
+
+func (of optionFunction) Apply(c *Client) {
+	of(c)
+}
+
+// WithHTTPClient 自定义http.Client，例如设置连接池、代理
+func WithHTTPClient(hc *http.Client) Option {
+	return optionFunction(func(c *Client) {
+		c.httpClient = hc
+	})
+}
+
+// WithTimeout 单次请求超时，默认10s，小于等于0不设置
+func WithTimeout(d time.Duration) Option {
+	return optionFunction(func(c *Client) {
+		c.timeout = d
+	})
+}
+
+// WithRetries 网络错误、5xx、429时的重试次数和首次重试间隔，之后间隔翻倍，
+// 默认只重试GET，POST需要接口幂等时配合WithRetryNonIdempotent开启
+func WithRetries(retries int, backoff time.Duration) Option {
+	return optionFunction(func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	})
+}
+
+func WithRetryNonIdempotent(flag bool) Option {
+	return optionFunction(func(c *Client) {
+		c.retryNonIdempotent = flag
+	})
+}
+
+// WithHeader 每个请求都带上的头，例如api key
+func WithHeader(key, value string) Option {
+	return optionFunction(func(c *Client) {
+		c.headers.Set(key, value)
+	})
+}
+
+// WithBeforeRequest 发送前修改请求，例如hmac签名、注入链路追踪头
+func WithBeforeRequest(f func(req *http.Request)) Option {
+	return optionFunction(func(c *Client) {
+		c.beforeRequest = append(c.beforeRequest, f)
+	})
+}
@@ -0,0 +1,14 @@
+package jclient
+
+import (
+	"net/http/httptest"
+
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+// NewTestServerClient 用httptest启动引擎，返回指向它的客户端和关闭函数，
+// 用于生成的客户端和服务端路由的往返测试
+func NewTestServerClient(e *jweb.Engine, options ...Option) (*Client, func()) {
+	server := httptest.NewServer(e.GetGinEngine())
+	return New(server.URL, options...), server.Close
+}
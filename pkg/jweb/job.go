@@ -0,0 +1,55 @@
+package jweb
+
+import (
+	"context"
+	"time"
+)
+
+// JobProgress 后台任务进度，例如配置表重读、批量发邮件
+type JobProgress struct {
+	Done    int64  `json:"done"`
+	Total   int64  `json:"total"`
+	Message string `json:"message"`
+}
+
+// StreamJob 执行耗时的后台任务，以sse推送"progress"事件，成功推送"done"事件（数据为任务结果），
+// 失败推送"error"事件，客户端断开时取消任务的context，例如：
+//
+//	e.Post("/gm/mail/bulk", "批量发邮件", func(c *MyContext) {
+//		jweb.StreamJob(c, time.Second*15, func(ctx context.Context, report func(jweb.JobProgress)) (interface{}, error) {
+//			for i, role := range roles {
+//				if err := sendMail(ctx, role); err != nil {
+//					return nil, err
+//				}
+//				report(jweb.JobProgress{Done: int64(i + 1), Total: int64(len(roles))})
+//			}
+//			return len(roles), nil
+//		})
+//	})
+func StreamJob(ctx Context, heartbeat time.Duration,
+	job func(jobCtx context.Context, report func(JobProgress)) (interface{}, error)) error {
+	c := ctx.GetGinContext()
+	stream, err := NewSSEStream(c, heartbeat)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	jobCtx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-stream.Done():
+			cancel()
+		case <-jobCtx.Done():
+		}
+	}()
+
+	result, err := job(jobCtx, func(p JobProgress) {
+		stream.Send(&SSEEvent{Event: "progress", Data: &p})
+	})
+	if err != nil {
+		return stream.Send(&SSEEvent{Event: "error", Data: map[string]string{"error": err.Error()}})
+	}
+	return stream.Send(&SSEEvent{Event: "done", Data: result})
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jlog"
+)
+
+// AccessLog 基于jlog的结构化访问日志，替代gin默认输出到stdout的日志，
+// 5xx输出error级别，4xx输出warn级别，其余info级别，skipPaths中的路径不记录（例如/metrics）
+func AccessLog(skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]struct{}, len(skipPaths))
+	for _, p := range skipPaths {
+		skip[p] = struct{}{}
+	}
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		raw := c.Request.URL.RawQuery
+
+		c.Next()
+
+		if _, find := skip[path]; find {
+			return
+		}
+
+		status := c.Writer.Status()
+		level := jlog.LogLevelInfo
+		if status >= http.StatusInternalServerError {
+			level = jlog.LogLevelError
+		} else if status >= http.StatusBadRequest {
+			level = jlog.LogLevelWarn
+		}
+
+		e := jlog.Output(level)
+		if e == nil {
+			return
+		}
+		e = e.Timestamp().
+			Str("request_id", GetRequestID(c)).
+			Str("method", c.Request.Method).
+			Str("path", path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Str("client_ip", c.ClientIP()).
+			Int("body_size", c.Writer.Size())
+		if raw != "" {
+			e = e.Str("query", raw)
+		}
+		if ua := c.Request.UserAgent(); ua != "" {
+			e = e.Str("user_agent", ua)
+		}
+		if errMsg := c.Errors.ByType(gin.ErrorTypePrivate).String(); errMsg != "" {
+			e = e.Str("error", errMsg)
+		}
+		e.Msg("[jweb] access")
+	}
+}
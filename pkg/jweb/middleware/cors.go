@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CORSConfig struct {
+	AllowOrigins     []string      // 允许的来源，包含"*"表示允许所有来源
+	AllowMethods     []string      // 允许的方法
+	AllowHeaders     []string      // 允许的请求头
+	ExposeHeaders    []string      // 允许浏览器读取的响应头
+	AllowCredentials bool          // 是否允许携带cookie，为true时不会返回"*"而是回显请求来源
+	MaxAge           time.Duration // 预检请求缓存时间
+}
+
+// DefaultCORSConfig 允许所有来源的GET/POST请求，GM后台等内部工具使用
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowOrigins:  []string{"*"},
+		AllowMethods:  []string{http.MethodGet, http.MethodPost, http.MethodOptions},
+		AllowHeaders:  []string{"Origin", "Content-Type", "Authorization", HeaderRequestID},
+		ExposeHeaders: []string{HeaderRequestID},
+		MaxAge:        time.Hour * 12,
+	}
+}
+
+// CORS 跨域中间件，预检请求直接返回204
+func CORS(config CORSConfig) gin.HandlerFunc {
+	allowAll := false
+	origins := make(map[string]struct{}, len(config.AllowOrigins))
+	for _, o := range config.AllowOrigins {
+		if o == "*" {
+			allowAll = true
+		}
+		origins[strings.ToLower(o)] = struct{}{}
+	}
+	allowMethods := strings.Join(config.AllowMethods, ",")
+	allowHeaders := strings.Join(config.AllowHeaders, ",")
+	exposeHeaders := strings.Join(config.ExposeHeaders, ",")
+	maxAge := strconv.FormatInt(int64(config.MaxAge/time.Second), 10)
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			// 非跨域请求
+			c.Next()
+			return
+		}
+
+		_, find := origins[strings.ToLower(origin)]
+		if !allowAll && !find {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		if allowAll && !config.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		if config.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if exposeHeaders != "" {
+			c.Header("Access-Control-Expose-Headers", exposeHeaders)
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			if allowMethods != "" {
+				c.Header("Access-Control-Allow-Methods", allowMethods)
+			}
+			if allowHeaders != "" {
+				c.Header("Access-Control-Allow-Headers", allowHeaders)
+			}
+			if config.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+type gzipWriter struct {
+	gin.ResponseWriter
+	writer *gzip.Writer
+}
+
+func (g *gzipWriter) WriteString(s string) (int, error) {
+	g.Header().Del("Content-Length")
+	return g.writer.Write([]byte(s))
+}
+
+func (g *gzipWriter) Write(data []byte) (int, error) {
+	g.Header().Del("Content-Length")
+	return g.writer.Write(data)
+}
+
+func (g *gzipWriter) WriteHeader(code int) {
+	g.Header().Del("Content-Length")
+	g.ResponseWriter.WriteHeader(code)
+}
+
+// Flush 流式响应需要先刷新压缩缓冲
+func (g *gzipWriter) Flush() {
+	g.writer.Flush()
+	g.ResponseWriter.Flush()
+}
+
+// Gzip 响应压缩，level取compress/gzip的压缩等级，
+// excludedExtensions中的后缀（例如已经压缩过的.png、.zip）不压缩，websocket和sse请求不压缩
+func Gzip(level int, excludedExtensions ...string) gin.HandlerFunc {
+	excluded := make(map[string]struct{}, len(excludedExtensions))
+	for _, ext := range excludedExtensions {
+		excluded[ext] = struct{}{}
+	}
+	pool := &sync.Pool{
+		New: func() interface{} {
+			gz, err := gzip.NewWriterLevel(io.Discard, level)
+			if err != nil {
+				gz, _ = gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+			}
+			return gz
+		},
+	}
+
+	return func(c *gin.Context) {
+		if !shouldCompress(c.Request, excluded) {
+			c.Next()
+			return
+		}
+
+		gz := pool.Get().(*gzip.Writer)
+		defer pool.Put(gz)
+		gz.Reset(c.Writer)
+
+		c.Header("Content-Encoding", "gzip")
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		originWriter := c.Writer
+		c.Writer = &gzipWriter{ResponseWriter: c.Writer, writer: gz}
+
+		c.Next()
+
+		c.Writer = originWriter
+		if !originWriter.Written() {
+			// 没有响应体（例如204、304），不写gzip尾
+			originWriter.Header().Del("Content-Encoding")
+			gz.Reset(io.Discard)
+			return
+		}
+		gz.Close()
+	}
+}
+
+func shouldCompress(req *http.Request, excluded map[string]struct{}) bool {
+	if !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+		return false
+	}
+	if strings.Contains(strings.ToLower(req.Header.Get("Connection")), "upgrade") {
+		return false
+	}
+	if strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		return false
+	}
+	_, find := excluded[filepath.Ext(req.URL.Path)]
+	return !find
+}
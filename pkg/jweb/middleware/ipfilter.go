@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jlog"
+)
+
+// IPList ip、cidr列表
+type IPList []*net.IPNet
+
+// ParseIPList 解析ip或cidr列表，例如["10.0.0.0/8", "192.168.1.22"]
+func ParseIPList(list []string) (IPList, error) {
+	nets := make(IPList, 0, len(list))
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip:%v", v)
+			}
+			if ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr:%v, %v", v, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func (l IPList) Contains(ip net.IP) bool {
+	for _, n := range l {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPFilter ip黑白名单，deny优先，allow非空时只放行allow中的地址，不通过返回403，
+// 客户端ip的解析受jweb.WithTrustedProxies影响
+func IPFilter(allow, deny []string) (gin.HandlerFunc, error) {
+	allowList, err := ParseIPList(allow)
+	if err != nil {
+		return nil, fmt.Errorf("parse allow list error:%v", err)
+	}
+	denyList, err := ParseIPList(deny)
+	if err != nil {
+		return nil, fmt.Errorf("parse deny list error:%v", err)
+	}
+	return func(c *gin.Context) {
+		clientIP := c.ClientIP()
+		ip := net.ParseIP(clientIP)
+		if ip == nil {
+			jlog.Warnf("[jweb] ip filter reject invalid client ip(%v) for %v", clientIP, c.Request.URL.Path)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		if denyList.Contains(ip) || (len(allowList) > 0 && !allowList.Contains(ip)) {
+			jlog.Warnf("[jweb] ip filter reject client ip(%v) for %v", clientIP, c.Request.URL.Path)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}, nil
+}
+
+// MustIPFilter 同IPFilter，名单配置错误直接panic，用于起服阶段
+func MustIPFilter(allow, deny []string) gin.HandlerFunc {
+	f, err := IPFilter(allow, deny)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
@@ -0,0 +1,16 @@
+// Package middleware jweb通用中间件，都是gin原生的处理函数，可以直接传给jweb的Use、Group、路由注册
+package middleware
+
+import (
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+// Default 请求id、访问日志、panic恢复的标准组合，配合jweb.WithoutGinDefault使用：
+// jweb.NewEngine(addr, newContextFun, jweb.WithoutGinDefault(), jweb.WithMiddleware(middleware.Default()...))
+func Default(skipLogPaths ...string) []jweb.HandlerFunc {
+	return []jweb.HandlerFunc{
+		RequestID(),
+		AccessLog(skipLogPaths...),
+		Recovery(),
+	}
+}
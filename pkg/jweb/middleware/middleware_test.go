@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+type testContext struct {
+	c *gin.Context
+}
+
+func (c *testContext) SetGinContext(ctx *gin.Context) {
+	c.c = ctx
+}
+
+func (c *testContext) GetGinContext() *gin.Context {
+	return c.c
+}
+
+func (c *testContext) ResponseParseParamsFieldFail(path string, field string, value string, err error) {
+	c.c.String(http.StatusBadRequest, err.Error())
+}
+
+func newTestEngine(middleware ...jweb.HandlerFunc) *jweb.Engine {
+	return jweb.NewEngine(":0", func() jweb.Context {
+		return new(testContext)
+	}, jweb.WithoutGinDefault(), jweb.WithMiddleware(middleware...))
+}
+
+func serve(e *jweb.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.GetGinEngine().ServeHTTP(w, req)
+	return w
+}
+
+func TestRequestIDAndRecovery(t *testing.T) {
+	e := newTestEngine(Default()...)
+	e.Get("/panic", "panic", func(c *testContext) {
+		panic("boom")
+	})
+	e.Get("/id", "id", func(c *testContext) {
+		c.GetGinContext().String(http.StatusOK, RequestIDFromContext(c.GetGinContext().Request.Context()))
+	})
+
+	w := serve(e, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("panic status:%v", w.Code)
+	}
+	if w.Header().Get(HeaderRequestID) == "" {
+		t.Fatalf("request id not set")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/id", nil)
+	req.Header.Set(HeaderRequestID, "abc")
+	w = serve(e, req)
+	if w.Body.String() != "abc" || w.Header().Get(HeaderRequestID) != "abc" {
+		t.Fatalf("request id not propagated:%v,%v", w.Body.String(), w.Header().Get(HeaderRequestID))
+	}
+}
+
+func TestCORS(t *testing.T) {
+	config := DefaultCORSConfig()
+	config.AllowOrigins = []string{"http://gm.example.com"}
+	e := newTestEngine(CORS(config))
+	e.Get("/", "index", func(c *testContext) {
+		c.GetGinContext().String(http.StatusOK, "ok")
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "http://gm.example.com")
+	w := serve(e, req)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "http://gm.example.com" {
+		t.Fatalf("preflight:%v,%v", w.Code, w.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "http://evil.example.com")
+	w = serve(e, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("forbidden origin status:%v", w.Code)
+	}
+}
+
+func TestTimeoutAndBodyLimit(t *testing.T) {
+	e := newTestEngine()
+	e.Get("/slow", "slow", Timeout(time.Millisecond*10), func(c *testContext) {
+		<-c.GetGinContext().Request.Context().Done()
+	})
+	type Params struct {
+		Name string `json:"name"`
+	}
+	e.PostWithStructParams("/post", "post", Params{}, BodyLimit(8), func(c *testContext, p *Params) {
+		c.GetGinContext().String(http.StatusOK, p.Name)
+	})
+
+	w := serve(e, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("timeout status:%v", w.Code)
+	}
+
+	w = serve(e, httptest.NewRequest(http.MethodPost, "/post", strings.NewReader(`{"name":"0123456789"}`)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("body limit status:%v", w.Code)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	e := newTestEngine(Gzip(gzip.BestSpeed))
+	body := strings.Repeat("supernova", 100)
+	e.Get("/", "index", func(c *testContext) {
+		c.GetGinContext().String(http.StatusOK, body)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := serve(e, req)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("not compressed:%v", w.Header())
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != body {
+		t.Fatalf("invalid body:%v", string(buf))
+	}
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jlog"
+)
+
+// KeyFunc 从请求提取限流key，返回空字符串表示这个请求不限流
+type KeyFunc func(c *gin.Context) string
+
+// KeyByIP 按客户端ip限流，客户端ip的解析受jweb.WithTrustedProxies影响
+func KeyByIP() KeyFunc {
+	return func(c *gin.Context) string {
+		return c.ClientIP()
+	}
+}
+
+// KeyByHeader 按请求头限流，例如按玩家token、渠道号
+func KeyByHeader(name string) KeyFunc {
+	return func(c *gin.Context) string {
+		return c.GetHeader(name)
+	}
+}
+
+// LimiterBackend 令牌桶限流后端，默认内存实现，多进程共享限流可以实现这个接口接入redis等
+type LimiterBackend interface {
+	// Allow 按key消耗一个令牌，rate为每秒生成的令牌数，burst为桶容量，
+	// 不允许时返回需要等待的时间
+	Allow(key string, rate float64, burst int) (allowed bool, retryAfter time.Duration, err error)
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastTime time.Time
+}
+
+// MemoryLimiter 进程内令牌桶限流
+type MemoryLimiter struct {
+	mu         sync.Mutex
+	buckets    map[string]*tokenBucket
+	idleExpire time.Duration
+	lastSweep  time.Time
+	now        func() time.Time
+}
+
+// NewMemoryLimiter 创建内存限流器，idleExpire时间内没有请求的key会被清理，防止按ip限流时内存无限增长
+func NewMemoryLimiter(idleExpire time.Duration) *MemoryLimiter {
+	if idleExpire <= 0 {
+		idleExpire = time.Minute * 10
+	}
+	return &MemoryLimiter{
+		buckets:    make(map[string]*tokenBucket),
+		idleExpire: idleExpire,
+		lastSweep:  time.Now(),
+		now:        time.Now,
+	}
+}
+
+func (l *MemoryLimiter) Allow(key string, rate float64, burst int) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, find := l.buckets[key]
+	if !find {
+		b = &tokenBucket{tokens: float64(burst), lastTime: now}
+		l.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.lastTime).Seconds()
+		if elapsed > 0 {
+			b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+			b.lastTime = now
+		}
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	if rate <= 0 {
+		return false, l.idleExpire, nil
+	}
+	wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// sweep 惰性清理空闲的桶，不需要额外的协程
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idleExpire {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		if now.Sub(b.lastTime) >= l.idleExpire {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+type RateLimitConfig struct {
+	Rate      float64              // 每秒生成的令牌数
+	Burst     int                  // 桶容量，即允许的突发请求数
+	Key       KeyFunc              // 限流key，默认按客户端ip
+	Backend   LimiterBackend       // 限流后端，默认内存实现
+	OnLimited func(c *gin.Context) // 被限流时的响应，默认返回429
+}
+
+// RateLimit 令牌桶限流中间件，可以挂载到Engine或者单个RouterGroup，例如：
+// gm := e.Group("/gm")
+// gm.Use(middleware.RateLimit(middleware.RateLimitConfig{Rate: 5, Burst: 10}))
+func RateLimit(config RateLimitConfig) gin.HandlerFunc {
+	if config.Key == nil {
+		config.Key = KeyByIP()
+	}
+	if config.Backend == nil {
+		config.Backend = NewMemoryLimiter(0)
+	}
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	return func(c *gin.Context) {
+		key := config.Key(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter, err := config.Backend.Allow(key, config.Rate, config.Burst)
+		if err != nil {
+			// 限流后端故障不影响业务
+			jlog.Errorf("[jweb] rate limit key(%v) backend error:%v", key, err)
+			c.Next()
+			return
+		}
+		if allowed {
+			c.Next()
+			return
+		}
+
+		seconds := int64(math.Ceil(retryAfter.Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+		if config.OnLimited != nil {
+			config.OnLimited(c)
+			c.Abort()
+			return
+		}
+		c.AbortWithStatus(http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jweb"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewMemoryLimiter(time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		allowed, _, _ := l.Allow("k", 1, 3)
+		if !allowed {
+			t.Fatalf("burst %v not allowed", i)
+		}
+	}
+	allowed, retryAfter, _ := l.Allow("k", 1, 3)
+	if allowed || retryAfter <= 0 {
+		t.Fatalf("should be limited:%v,%v", allowed, retryAfter)
+	}
+
+	now = now.Add(time.Second)
+	if allowed, _, _ = l.Allow("k", 1, 3); !allowed {
+		t.Fatalf("token should refill")
+	}
+
+	now = now.Add(time.Minute * 2)
+	l.Allow("other", 1, 3)
+	if _, find := l.buckets["k"]; find {
+		t.Fatalf("idle bucket not swept")
+	}
+}
+
+func TestRateLimitAndIPFilter(t *testing.T) {
+	e := jweb.NewEngine(":0", func() jweb.Context {
+		return new(testContext)
+	}, jweb.WithoutGinDefault(), jweb.WithTrustedProxies("10.0.0.1"))
+	gm := e.Group("/gm", MustIPFilter([]string{"192.168.0.0/16"}, []string{"192.168.1.22"}))
+	gm.Use(RateLimit(RateLimitConfig{Rate: 0.001, Burst: 1}))
+	gm.Get("/ping", "ping", func(c *testContext) {
+		c.GetGinContext().String(http.StatusOK, c.GetGinContext().ClientIP())
+	})
+
+	request := func(remoteAddr, forwarded string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/gm/ping", nil)
+		req.RemoteAddr = remoteAddr
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		return serve(e, req)
+	}
+
+	if w := request("192.168.2.1:1000", ""); w.Code != http.StatusOK {
+		t.Fatalf("allow status:%v", w.Code)
+	}
+	if w := request("192.168.2.1:1000", ""); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("limit status:%v", w.Code)
+	}
+	if w := request("192.168.1.22:1000", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("deny status:%v", w.Code)
+	}
+	if w := request("8.8.8.8:1000", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("not allow status:%v", w.Code)
+	}
+	// 不信任的代理传入的X-Forwarded-For不生效
+	if w := request("8.8.8.8:1000", "192.168.3.1"); w.Code != http.StatusForbidden {
+		t.Fatalf("untrusted proxy status:%v", w.Code)
+	}
+	// 信任的代理
+	if w := request("10.0.0.1:1000", "192.168.3.1"); w.Code != http.StatusOK || w.Body.String() != "192.168.3.1" {
+		t.Fatalf("trusted proxy:%v,%v", w.Code, w.Body.String())
+	}
+}
+
+func TestKeyByHeader(t *testing.T) {
+	e := newTestEngine(RateLimit(RateLimitConfig{Rate: 0.001, Burst: 1, Key: KeyByHeader("X-Token"),
+		OnLimited: func(c *gin.Context) {
+			c.String(http.StatusTooManyRequests, "slow down")
+		}}))
+	e.Get("/", "index", func(c *testContext) {})
+
+	req := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Token", token)
+		return serve(e, r)
+	}
+	req("a")
+	if w := req("a"); w.Code != http.StatusTooManyRequests || w.Body.String() != "slow down" {
+		t.Fatalf("token a:%v,%v", w.Code, w.Body.String())
+	}
+	if w := req("b"); w.Code != http.StatusOK {
+		t.Fatalf("token b:%v", w.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/jlog"
+)
+
+// Recovery 捕获处理函数的panic，通过jlog输出criti日志和调用栈，返回500，
+// 客户端断开导致的broken pipe只记录不输出栈
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				if isBrokenPipe(err) {
+					jlog.Warnf("[jweb] broken pipe, request_id:%v, %v %v, error:%v",
+						GetRequestID(c), c.Request.Method, c.Request.URL.Path, err)
+					if e, ok := err.(error); ok {
+						c.Error(e) // nolint: errcheck
+					}
+					c.Abort()
+					return
+				}
+
+				jlog.Critif("[jweb] panic recovered, request_id:%v, %v %v, error:%v, stack:%s",
+					GetRequestID(c), c.Request.Method, c.Request.URL.Path, err, debug.Stack())
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+		c.Next()
+	}
+}
+
+func isBrokenPipe(err interface{}) bool {
+	e, ok := err.(error)
+	if !ok {
+		return false
+	}
+	var ne *net.OpError
+	if !errors.As(e, &ne) {
+		return false
+	}
+	var se *os.SyscallError
+	if !errors.As(ne.Err, &se) {
+		return false
+	}
+	msg := strings.ToLower(se.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderRequestID 请求id的http头，上游传入则透传，否则生成新的
+const HeaderRequestID = "X-Request-ID"
+
+// 请求id在gin上下文中的key
+const ginKeyRequestID = "jweb_request_id"
+
+// 请求id最大长度，防止客户端传入超长头污染日志
+const maxRequestIDLen = 128
+
+type requestIDCtxKey struct{}
+
+var fallbackRequestSeq int64
+
+// RequestID 为每个请求生成或透传请求id，写入响应头、gin上下文和请求的context，
+// 后续中间件、处理函数、下游调用都可以通过GetRequestID/RequestIDFromContext取到
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if id == "" || len(id) > maxRequestIDLen {
+			id = newRequestID()
+		}
+		c.Set(ginKeyRequestID, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+		c.Header(HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+// GetRequestID 获取当前请求的请求id，没有挂载RequestID中间件返回空
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(ginKeyRequestID)
+}
+
+// RequestIDFromContext 从请求的context获取请求id，用于传递给下游调用
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// WithRequestID 将请求id放入context，用于非http入口发起的调用链
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		// 随机源不可用时退化为时间戳+自增序号
+		seq := atomic.AddInt64(&fallbackRequestSeq, 1)
+		return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatInt(seq, 36)
+	}
+	return hex.EncodeToString(buf)
+}
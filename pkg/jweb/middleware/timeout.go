@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Timeout 设置请求处理超时，可以全局挂载，也可以作为单个路由的第一个处理函数：
+// e.Get("/reload", "重读配置表", middleware.Timeout(time.Minute), handler)
+// 超时后请求的context被取消，处理函数需要自己感知c.Request.Context().Done()，
+// 超时且处理函数还没写响应时返回504
+func Timeout(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			c.AbortWithStatus(http.StatusGatewayTimeout)
+		}
+	}
+}
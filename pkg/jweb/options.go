@@ -0,0 +1,42 @@
+package jweb
+
+type Option interface {
+	Apply(e *Engine)
+}
+
+type optionFunction func(e *Engine)
+
+func (of optionFunction) Apply(e *Engine) {
+	of(e)
+}
+
+// WithoutGinDefault 不使用gin.Default()自带的Logger、Recovery中间件，
+// 一般配合middleware包里基于jlog的中间件使用
+func WithoutGinDefault() Option {
+	return optionFunction(func(e *Engine) {
+		e.withoutGinDefault = true
+	})
+}
+
+// WithMiddleware 创建引擎时就挂载的全局中间件，先于所有路由生效
+func WithMiddleware(middleware ...HandlerFunc) Option {
+	return optionFunction(func(e *Engine) {
+		e.initMiddleware = append(e.initMiddleware, middleware...)
+	})
+}
+
+// WithTrustedProxies 设置信任的反向代理（ip或cidr），只有来自这些地址的请求才会从
+// X-Forwarded-For等头解析客户端真实ip，默认不信任任何代理，客户端ip即对端地址
+func WithTrustedProxies(proxies ...string) Option {
+	return optionFunction(func(e *Engine) {
+		e.trustedProxies = append(e.trustedProxies, proxies...)
+	})
+}
+
+// WithRemoteIPHeaders 设置从信任代理解析客户端ip的头，按顺序取第一个有效值，
+// 默认X-Forwarded-For、X-Real-IP
+func WithRemoteIPHeaders(headers ...string) Option {
+	return optionFunction(func(e *Engine) {
+		e.remoteIPHeaders = headers
+	})
+}
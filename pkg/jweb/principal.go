@@ -0,0 +1,82 @@
+package jweb
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principal在gin上下文中的key
+const ginKeyPrincipal = "jweb_principal"
+
+// Principal 认证通过的调用方，由auth包的中间件写入
+type Principal struct {
+	Subject string                 // 调用方标识，例如后台账号、appid、api key名
+	Method  string                 // 认证方式，jwt/hmac/apikey
+	Scopes  []string               // 拥有的权限
+	Claims  map[string]interface{} // 认证附带的其它信息，例如jwt的claims
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPrincipal 认证中间件写入调用方
+func SetPrincipal(c *gin.Context, p *Principal) {
+	c.Set(ginKeyPrincipal, p)
+}
+
+// GetPrincipal 在处理函数中获取认证通过的调用方
+func GetPrincipal(ctx Context) (*Principal, bool) {
+	return GetGinPrincipal(ctx.GetGinContext())
+}
+
+func GetGinPrincipal(c *gin.Context) (*Principal, bool) {
+	v, find := c.Get(ginKeyPrincipal)
+	if !find {
+		return nil, false
+	}
+	p, ok := v.(*Principal)
+	return p, ok && p != nil
+}
+
+type scopeRequirement []string
+
+// RequireScopes 声明路由需要的权限，放在路由处理函数前，会记录到RouteInfo.Scopes，
+// 没有认证返回401，权限不足返回403，例如：
+// grp.PostWithStructParams("mail/add", "发邮件", Mail{}, jweb.RequireScopes("gm.mail"), handler)
+func RequireScopes(scopes ...string) HandlerFunc {
+	return scopeRequirement(scopes)
+}
+
+func (r scopeRequirement) ginHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, find := GetGinPrincipal(c)
+		if !find {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		for _, s := range r {
+			if !p.HasScope(s) {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
+	}
+}
+
+// collectScopes 收集处理函数中声明的权限
+func collectScopes(handlers []HandlerFunc) []string {
+	var scopes []string
+	for _, h := range handlers {
+		if r, ok := h.(scopeRequirement); ok {
+			scopes = append(scopes, r...)
+		}
+	}
+	return scopes
+}
@@ -8,6 +8,7 @@ type RouteInfo struct {
 	Desc           string
 	Method         string
 	StructTemplate interface{}
+	Scopes         []string // 需要的权限，由RequireScopes声明
 }
 
 type fieldDescInfo struct {
@@ -18,6 +19,16 @@ type fieldDescInfo struct {
 	Tags      reflect.StructTag
 }
 
+// withGroupScopes 合并所属组声明的权限
+func (ri *RouteInfo) withGroupScopes(scopes []string) *RouteInfo {
+	if len(scopes) == 0 {
+		return ri
+	}
+	newRi := *ri
+	newRi.Scopes = append(append(make([]string, 0, len(scopes)+len(ri.Scopes)), scopes...), ri.Scopes...)
+	return &newRi
+}
+
 func (ri *RouteInfo) HasFields() bool {
 	return ri.StructTemplate != nil
 }
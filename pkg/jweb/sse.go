@@ -0,0 +1,164 @@
+package jweb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ErrStreamClosed = errors.New("stream closed")
+
+// SSEEvent 一条server-sent event，Data为string/[]byte时原样发送，其它类型以json编码
+type SSEEvent struct {
+	ID    string
+	Event string
+	Retry time.Duration // 告诉客户端断线重连的间隔
+	Data  interface{}
+}
+
+// SSEStream 一个sse连接，写入是线程安全的，可以在多个协程推送
+type SSEStream struct {
+	w        gin.ResponseWriter
+	mu       sync.Mutex
+	done     chan struct{}
+	doneOnce sync.Once
+	exited   chan struct{} // watch协程退出
+}
+
+// NewSSEStream 将当前请求转换为sse响应，heartbeat大于0时定时发送注释行保活，
+// 防止代理、负载均衡因为空闲断开连接，客户端断开后Done()返回的channel会关闭
+func NewSSEStream(c *gin.Context, heartbeat time.Duration) (*SSEStream, error) {
+	if _, ok := c.Writer.(http.Flusher); !ok {
+		return nil, fmt.Errorf("response writer not support flush")
+	}
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 关闭nginx的响应缓冲
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+
+	// 处理函数返回后gin会复用c，协程中不能再访问c
+	s := &SSEStream{w: c.Writer, done: make(chan struct{}), exited: make(chan struct{})}
+	go s.watch(c.Request.Context().Done(), heartbeat)
+	return s, nil
+}
+
+// watch 检测客户端断开和发送心跳
+func (s *SSEStream) watch(reqDone <-chan struct{}, heartbeat time.Duration) {
+	defer close(s.exited)
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-reqDone:
+			s.stop()
+			return
+		case <-s.done:
+			return
+		case <-tick:
+			if err := s.writeRaw(": ping\n\n"); err != nil {
+				s.stop()
+				return
+			}
+		}
+	}
+}
+
+// Done 客户端断开或者服务端Close后关闭
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close 结束推送，等待正在进行的写入和心跳协程结束，处理函数返回前调用
+func (s *SSEStream) Close() {
+	s.stop()
+	<-s.exited
+}
+
+// stop 和写入互斥，返回之后不会再写响应
+func (s *SSEStream) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// Send 推送一条事件
+func (s *SSEStream) Send(e *SSEEvent) error {
+	buf := new(strings.Builder)
+	if e.ID != "" {
+		buf.WriteString("id: " + singleLine(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		buf.WriteString("event: " + singleLine(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	data, err := encodeSSEData(e.Data)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(data, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+	return s.writeRaw(buf.String())
+}
+
+// SendData 只推送数据的默认message事件
+func (s *SSEStream) SendData(data interface{}) error {
+	return s.Send(&SSEEvent{Data: data})
+}
+
+func (s *SSEStream) writeRaw(str string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return ErrStreamClosed
+	default:
+	}
+	if _, err := s.w.WriteString(str); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+func encodeSSEData(data interface{}) (string, error) {
+	switch d := data.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return d, nil
+	case []byte:
+		return string(d), nil
+	}
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("encode sse data error:%v", err)
+	}
+	return string(buf), nil
+}
+
+// singleLine id、event字段不能有换行
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
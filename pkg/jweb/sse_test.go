@@ -0,0 +1,114 @@
+package jweb
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type streamContext struct {
+	BaseContext
+}
+
+func (c *streamContext) ResponseParseParamsFieldFail(path string, field string, value string, err error) {
+}
+
+func newStreamEngine(jobCanceled chan struct{}) *Engine {
+	e := NewEngine(":0", func() Context {
+		return new(streamContext)
+	}, WithoutGinDefault())
+	e.Get("/job", "job", func(c *streamContext) {
+		StreamJob(c, time.Millisecond*20, func(ctx context.Context, report func(JobProgress)) (interface{}, error) {
+			for i := 1; i <= 3; i++ {
+				report(JobProgress{Done: int64(i), Total: 3, Message: "reload"})
+			}
+			return "ok", nil
+		})
+	})
+	e.Get("/fail", "fail", func(c *streamContext) {
+		StreamJob(c, 0, func(ctx context.Context, report func(JobProgress)) (interface{}, error) {
+			return nil, errors.New("csv error\nline 2")
+		})
+	})
+	e.Get("/long", "long", func(c *streamContext) {
+		StreamJob(c, time.Millisecond*10, func(ctx context.Context, report func(JobProgress)) (interface{}, error) {
+			<-ctx.Done()
+			close(jobCanceled)
+			return nil, ctx.Err()
+		})
+	})
+	e.Get("/download", "download", func(c *streamContext) {
+		c.Stream("text/plain", "big.txt", -1, strings.NewReader(strings.Repeat("x", streamChunkSize*3+1)))
+	})
+	return e
+}
+
+func TestSSEJob(t *testing.T) {
+	jobCanceled := make(chan struct{})
+	server := httptest.NewServer(newStreamEngine(jobCanceled).GetGinEngine())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("content type:%v", resp.Header.Get("Content-Type"))
+	}
+	expect := "event: progress\ndata: {\"done\":3,\"total\":3,\"message\":\"reload\"}\n\nevent: done\ndata: ok\n\n"
+	if !strings.HasSuffix(string(body), expect) || strings.Count(string(body), "event: progress") != 3 {
+		t.Fatalf("events:%q", body)
+	}
+
+	resp, err = http.Get(server.URL + "/fail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "event: error\ndata: {\"error\":\"csv error\\nline 2\"}\n\n") {
+		t.Fatalf("error event:%q", body)
+	}
+
+	// 客户端断开取消任务
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/long", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	if line != ": ping\n" {
+		t.Fatalf("heartbeat:%q", line)
+	}
+	cancel()
+	resp.Body.Close()
+	select {
+	case <-jobCanceled:
+	case <-time.After(time.Second * 3):
+		t.Fatalf("job not canceled after client closed")
+	}
+}
+
+func TestStreamDownload(t *testing.T) {
+	server := httptest.NewServer(newStreamEngine(nil).GetGinEngine())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if len(body) != streamChunkSize*3+1 || resp.Header.Get("Content-Disposition") != "attachment; filename=big.txt" {
+		t.Fatalf("download:%v,%v", len(body), resp.Header)
+	}
+}
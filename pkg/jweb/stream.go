@@ -0,0 +1,54 @@
+package jweb
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 流式下载每次写入的块大小
+const streamChunkSize = 32 << 10
+
+// Stream 以分块方式把reader的内容写给客户端并逐块刷新，适用于导出日志、大文件等不方便整个读入内存的下载，
+// fileName不为空时以附件下载，size小于0时使用chunked编码，客户端断开时停止读取并返回错误
+func Stream(c *gin.Context, contentType string, fileName string, size int64, reader io.Reader) error {
+	header := c.Writer.Header()
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	if fileName != "" {
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	}
+	if size >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	c.Status(http.StatusOK)
+
+	done := c.Request.Context().Done()
+	buf := make([]byte, streamChunkSize)
+	for {
+		select {
+		case <-done:
+			return fmt.Errorf("client closed:%w", c.Request.Context().Err())
+		default:
+		}
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			c.Writer.Flush()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"golang.org/x/net/ipv6"
 
 	"github.com/pkg/errors"
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
 )
 
 type Client struct {
@@ -20,6 +23,18 @@ type Client struct {
 }
 
 func NewClient(conv uint32, raddr string) (*Client, error) {
+	return newClient(conv, raddr, nil, nil, nil)
+}
+
+// NewClientWithHeartbeat 开启心跳的客户端，kcp消息用c编解码，为空时用tlv；
+// 被踢出时先关闭客户端，再调用onKick
+func NewClientWithHeartbeat(conv uint32, raddr string, option *heartbeat.Option, c codec.Codec,
+	onKick func(reason event.Error)) (*Client, error) {
+	return newClient(conv, raddr, option, c, onKick)
+}
+
+func newClient(conv uint32, raddr string, option *heartbeat.Option, hbCodec codec.Codec,
+	onKick func(reason event.Error)) (*Client, error) {
 	udpaddr, err := net.ResolveUDPAddr("udp", raddr)
 	if err != nil {
 		return nil, errors.Wrap(err, "net.ResolveUDPAddr")
@@ -32,7 +47,13 @@ func NewClient(conv uint32, raddr string) (*Client, error) {
 
 	c := new(Client)
 	c.conn = conn
-	c.session = newSession(conv, net.PacketConn(conn))
+	hb := newSessionHeartbeat(option, false, hbCodec, func(reason event.Error) {
+		c.Close()
+		if onKick != nil {
+			onKick(reason)
+		}
+	})
+	c.session = newSession(conv, net.PacketConn(conn), hb)
 	c.session.remote_addr = nil
 	c.ChLogic = c.session.ChLogic
 	c.Closed = false
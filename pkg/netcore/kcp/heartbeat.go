@@ -0,0 +1,114 @@
+package kcp
+
+import (
+	"time"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+// sessionHeartbeat 会话的心跳，一个kcp消息用codec编解码为一个tag+payload，和tcp、ws的心跳消息相同
+type sessionHeartbeat struct {
+	keeper *heartbeat.Keeper
+	codec  codec.Codec
+	kick   func(event.Error) // 在新协程中调用
+}
+
+func newSessionHeartbeat(option *heartbeat.Option, isServer bool, c codec.Codec,
+	kick func(event.Error)) *sessionHeartbeat {
+	keeper := heartbeat.NewKeeper(option, isServer)
+	if keeper == nil {
+		return nil
+	}
+	if c == nil {
+		c = codec.TLVCodec{}
+	}
+	return &sessionHeartbeat{keeper: keeper, codec: c, kick: kick}
+}
+
+// SetHeartbeat 开启心跳，只对之后添加的会话有效，需要在AddSession之前调用。
+// kcp消息用c编解码，为空时用tlv；会话被踢出时先移除会话，再调用onKick
+func (l *Listener) SetHeartbeat(option *heartbeat.Option, c codec.Codec, onKick func(conv uint32, reason event.Error)) {
+	l.heartbeat = option
+	l.heartbeatCodec = c
+	l.onKick = onKick
+}
+
+func (l *Listener) newSessionHeartbeat(conv uint32) *sessionHeartbeat {
+	return newSessionHeartbeat(l.heartbeat, true, l.heartbeatCodec, func(reason event.Error) {
+		l.RemoveSession(conv)
+		if l.onKick != nil {
+			l.onKick(conv, reason)
+		}
+	})
+}
+
+// GetRTT 心跳测量的往返时间，没有开启心跳、由对方发起ping或者还没测量时为0
+func (s *Session) GetRTT() time.Duration {
+	if s.heartbeat == nil {
+		return 0
+	}
+	return s.heartbeat.keeper.RTT()
+}
+
+// GetRTT 心跳测量的往返时间，没有开启心跳、由服务器发起ping或者还没测量时为0
+func (c *Client) GetRTT() time.Duration {
+	return c.session.GetRTT()
+}
+
+// handleHeartbeatRecv 在run协程中处理心跳消息并回复，心跳消息不交给逻辑层，返回是否为心跳消息。
+// 不能用codec解码的消息按业务消息记录收包时间
+func (s *Session) handleHeartbeatRecv(msg []byte) bool {
+	if s.heartbeat == nil {
+		return false
+	}
+	reply, ok := s.heartbeat.keeper.HandleRecv(s.heartbeat.decode(msg))
+	if reply != nil {
+		s.sendPacket(reply)
+	}
+	return ok
+}
+
+// tickHeartbeat 发送ping，需要踢出时返回false，run协程退出
+func (s *Session) tickHeartbeat() bool {
+	ping, reason := s.heartbeat.keeper.Tick()
+	if reason != nil {
+		log.Infof("[kcp heartbeat]session[%v][%v] kicked:%v", s.conv, s.GetRemoteIp(), reason)
+		go s.heartbeat.kick(reason)
+		return false
+	}
+	if ping != nil && s.sendPacket(ping) {
+		s.heartbeat.keeper.PingSent()
+	}
+	return true
+}
+
+// decode codec可以只读tag时，业务消息不解码payload
+func (h *sessionHeartbeat) decode(msg []byte) *utils.TLVPacket {
+	if tc, ok := h.codec.(codec.TagCodec); ok {
+		tag, err := tc.Tag(msg)
+		if err != nil {
+			return &utils.TLVPacket{}
+		}
+		if !h.keeper.IsHeartbeat(tag) {
+			return &utils.TLVPacket{Tag: tag}
+		}
+	}
+	packet, err := h.codec.Decode(msg)
+	if err != nil {
+		return &utils.TLVPacket{}
+	}
+	return packet
+}
+
+func (s *Session) sendPacket(packet *utils.TLVPacket) bool {
+	buf, err := s.heartbeat.codec.Encode(packet.Tag, packet.Payload)
+	if err != nil {
+		log.Warnf("[kcp heartbeat]session[%v] encode msg(%v) error:%v", s.conv, packet.Tag, err)
+		return false
+	}
+	s.send(buf)
+	return true
+}
@@ -0,0 +1,94 @@
+package kcp
+
+import (
+	"testing"
+	"time"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+// newHeartbeatTestSession 不启动run协程和socket的会话，发出的kcp数据交给peer解出消息
+func newHeartbeatTestSession(t *testing.T, kicked chan event.Error) (*Session, func() *utils.TLVPacket) {
+	peer := NewKCP(1, func(buf []byte, size int) {})
+	s := &Session{conv: 1}
+	s.kcp = NewKCP(1, func(buf []byte, size int) {
+		seg := make([]byte, size)
+		copy(seg, buf)
+		peer.Input(seg, true, false)
+	})
+	s.kcp.NoDelay(Kcp_nodelay, Kcp_interval, Kcp_resend, Kcp_nc)
+	s.heartbeat = newSessionHeartbeat(&heartbeat.Option{PingTag: 100, Interval: time.Hour}, true, nil,
+		func(reason event.Error) {
+			kicked <- reason
+		})
+	recv := func() *utils.TLVPacket {
+		if peer.PeekSize() <= 0 {
+			return nil
+		}
+		buf := make([]byte, Pack_max_len)
+		packet, err := codec.TLVCodec{}.Decode(buf[:peer.Recv(buf)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packet
+	}
+	return s, recv
+}
+
+func TestSessionHeartbeat(t *testing.T) {
+	kicked := make(chan event.Error, 1)
+	s, recv := newHeartbeatTestSession(t, kicked)
+	tlv := func(tag uint32, payload string) []byte {
+		msg, _ := codec.TLVCodec{}.Encode(tag, []byte(payload))
+		return msg
+	}
+
+	// 服务器发起ping，对方原样回复pong
+	if !s.tickHeartbeat() {
+		t.Fatal("kicked on first tick")
+	}
+	ping := recv()
+	if ping == nil || ping.Tag != 100 || s.heartbeat.keeper.Stat().Missed != 1 {
+		t.Fatalf("ping %v stat %+v", ping, s.heartbeat.keeper.Stat())
+	}
+	if !s.handleHeartbeatRecv(tlv(101, string(ping.Payload))) || s.heartbeat.keeper.Stat().Missed != 0 {
+		t.Fatalf("pong not handled %+v", s.heartbeat.keeper.Stat())
+	}
+
+	// 对方发起的ping回复pong
+	if !s.handleHeartbeatRecv(tlv(100, "peer")) {
+		t.Fatal("ping not handled")
+	}
+	if pong := recv(); pong == nil || pong.Tag != 101 || string(pong.Payload) != "peer" {
+		t.Fatalf("pong %v", pong)
+	}
+
+	// 业务消息和不能解码的消息交给逻辑层，业务消息不解码payload
+	if s.handleHeartbeatRecv(tlv(1, "msg")) || s.handleHeartbeatRecv([]byte{1, 2}) {
+		t.Fatal("business msg handled as heartbeat")
+	}
+	if packet := s.heartbeat.decode(tlv(1, "msg")); packet.Tag != 1 || packet.Payload != nil {
+		t.Fatalf("business msg decoded %v", packet)
+	}
+
+	// 连续3个ping没有回复踢出
+	for i := 0; i < 3; i++ {
+		if !s.tickHeartbeat() || recv() == nil {
+			t.Fatalf("tick %v", i)
+		}
+	}
+	if s.tickHeartbeat() {
+		t.Fatal("not kicked after missed pings")
+	}
+	select {
+	case reason := <-kicked:
+		if reason != event.ErrHeartbeatTimeout {
+			t.Fatalf("kick reason %v", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("kick not called")
+	}
+}
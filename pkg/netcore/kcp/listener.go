@@ -11,6 +11,9 @@ import (
 	"github.com/libp2p/go-reuseport"
 	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
 )
 
 type inPacket struct {
@@ -32,6 +35,10 @@ type Listener struct {
 	closed    bool
 	cancelFun context.CancelFunc
 	rander    *rand.Rand
+
+	heartbeat      *heartbeat.Option // 新会话的心跳配置，为空时不开启
+	heartbeatCodec codec.Codec
+	onKick         func(conv uint32, reason event.Error)
 }
 
 // Listen 监听地址的udp包
@@ -84,7 +91,7 @@ func (l *Listener) AddSession(conv uint32) (*Session, error) {
 	// 随机分配一个套接字来发送消息
 	conn := l.readConns[l.rander.Intn(len(l.readConns))]
 
-	s := newSession(conv, conn.PacketConn)
+	s := newSession(conv, conn.PacketConn, l.newSessionHeartbeat(conv))
 	l.sessions.Store(conv, s)
 	return s, nil
 }
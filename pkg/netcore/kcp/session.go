@@ -58,9 +58,11 @@ type Session struct {
 	xconn    batchConn      // 批写连接
 	xqueue   []ipv4.Message // 批写队列
 	isServer bool           // 屏蔽remote_addr为空时不走作为客户端压测的逻辑
+
+	heartbeat *sessionHeartbeat // 心跳，没有开启时为空
 }
 
-func newSession(conv uint32, conn net.PacketConn) *Session {
+func newSession(conv uint32, conn net.PacketConn, hb *sessionHeartbeat) *Session {
 	s := new(Session)
 	s.conv = conv
 	s.conn = conn
@@ -89,6 +91,7 @@ func newSession(conv uint32, conn net.PacketConn) *Session {
 	//updater.addSession(s)
 
 	s.isServer = true
+	s.heartbeat = hb
 
 	go s.run()
 
@@ -124,15 +127,22 @@ func (s *Session) run() {
 			log.Warnf("[kcp catch panic info in session]session[%v]%v\n", s.conv, v)
 		}
 	}()
+	var tickChan <-chan time.Time
+	if s.heartbeat != nil {
+		ticker := time.NewTicker(s.heartbeat.keeper.Interval())
+		defer ticker.Stop()
+		tickChan = ticker.C
+	}
 	for {
 		select {
 		case <-s.chClosed:
 			return
 		case buf := <-s.chSend:
-			s.kcp.Send(buf)
-			s.kcp.Update(s.curTime)
-			s.writeBatch()
-			s.curTime += 33
+			s.send(buf)
+		case <-tickChan:
+			if !s.tickHeartbeat() {
+				return
+			}
 		case data := <-s.chSocket:
 			s.handleRecvPacket(data)
 			//case <-s.chTimer:
@@ -141,6 +151,14 @@ func (s *Session) run() {
 	}
 }
 
+// send 在run协程中发送数据
+func (s *Session) send(buf []byte) {
+	s.kcp.Send(buf)
+	s.kcp.Update(s.curTime)
+	s.writeBatch()
+	s.curTime += 33
+}
+
 func (s *Session) Update(cur uint32) {
 	//atomic.StoreUint32(&s.curTime, cur)
 	//select {
@@ -224,6 +242,9 @@ func (s *Session) handleRecvPacket(data []byte) {
 				if size := s.kcp.PeekSize(); size > 0 {
 					buf := make([]byte, Pack_max_len)
 					length := s.kcp.Recv(buf)
+					if s.handleHeartbeatRecv(buf[:length]) {
+						continue
+					}
 					select {
 					case s.ChLogic <- buf[:length]:
 					default:
@@ -0,0 +1,62 @@
+// Package codec 消息编解码。Encode的结果就是发送的完整字节，tcp、ws、udp使用同一个编解码时，
+// 同一个消息在各个传输层上的字节相同：tcp按FrameCodec从流中切出一帧，ws一帧就是一个消息，
+// udp在消息前面加上session token
+package codec
+
+import (
+	"bufio"
+	"errors"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+var ErrNotFrameCodec = errors.New("codec can not read frames from stream")
+
+// Codec 一个完整消息和tag+payload之间的编解码
+type Codec interface {
+	// Name 编解码名字
+	Name() string
+	// Encode 编码一个消息
+	Encode(tag uint32, payload []byte) ([]byte, error)
+	// Decode 解码一个完整的消息，msg可能被复用，payload需要复制
+	Decode(msg []byte) (*utils.TLVPacket, error)
+}
+
+// FrameCodec 消息自带边界，可以从流中读出一个完整消息，用于tcp
+type FrameCodec interface {
+	Codec
+	// ReadFrame 读取一个完整消息，超过maxBytes时返回错误
+	ReadFrame(r *bufio.Reader, maxBytes int) ([]byte, error)
+}
+
+// TagCodec 不解码payload就可以读出tag，只按tag分发的场景用它避免复制payload
+type TagCodec interface {
+	Codec
+	// Tag 读取消息的tag，消息不完整时返回错误
+	Tag(msg []byte) (uint32, error)
+}
+
+// TextCodec 编码结果是文本，ws用文本帧发送
+type TextCodec interface {
+	Codec
+	Text() bool
+}
+
+// IsText 是否用ws文本帧发送
+func IsText(c Codec) bool {
+	t, ok := c.(TextCodec)
+	return ok && t.Text()
+}
+
+// ReadPacket 从流中读取并解码一个消息
+func ReadPacket(c Codec, r *bufio.Reader, maxBytes int) (*utils.TLVPacket, error) {
+	fc, ok := c.(FrameCodec)
+	if !ok {
+		return nil, ErrNotFrameCodec
+	}
+	frame, err := fc.ReadFrame(r, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	return fc.Decode(frame)
+}
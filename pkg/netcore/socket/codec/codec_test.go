@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	payloads := [][]byte{nil, []byte(`{"a":1}`), bytes.Repeat([]byte(`"x"`), 30000)}
+	tags := []uint32{1, 200, 70000, 1 << 31}
+	for _, c := range []Codec{TLVCodec{}, ProtobufCodec{}, MsgpackCodec{}, JSONCodec{}, RawCodec{}} {
+		stream := new(bytes.Buffer)
+		for _, tag := range tags {
+			for _, payload := range payloads {
+				if _, ok := c.(JSONCodec); ok && len(payload) > 10 {
+					payload = []byte(`["` + strings.Repeat("x", 30000) + `"]`)
+				}
+				msg, err := c.Encode(tag, payload)
+				if err != nil {
+					t.Fatalf("%v encode error:%v", c.Name(), err)
+				}
+				stream.Write(msg)
+				packet, err := c.Decode(msg)
+				if err != nil {
+					t.Fatalf("%v decode error:%v", c.Name(), err)
+				}
+				if packet.Tag != tag || !bytes.Equal(packet.Payload, payload) {
+					t.Fatalf("%v decode tag:%v payload:%.20s, want %v %.20s", c.Name(), packet.Tag, packet.Payload, tag, payload)
+				}
+				if tc, ok := c.(TagCodec); ok {
+					if got, err := tc.Tag(msg); err != nil || got != tag {
+						t.Fatalf("%v tag:%v error:%v, want %v", c.Name(), got, err, tag)
+					}
+					if _, err := tc.Tag(msg[:3]); err == nil {
+						t.Fatalf("%v tag of short msg", c.Name())
+					}
+				}
+			}
+		}
+
+		// 流中连续读出所有消息
+		r := bufio.NewReader(stream)
+		for i := 0; i < len(tags)*len(payloads); i++ {
+			packet, err := ReadPacket(c, r, 1<<20)
+			if _, ok := c.(FrameCodec); !ok {
+				if err != ErrNotFrameCodec {
+					t.Fatalf("%v read stream error:%v", c.Name(), err)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("%v read stream error:%v", c.Name(), err)
+			}
+			if packet.Tag != tags[i/len(payloads)] {
+				t.Fatalf("%v read stream tag:%v", c.Name(), packet.Tag)
+			}
+		}
+
+		if fc, ok := c.(FrameCodec); ok {
+			msg, _ := c.Encode(1, []byte(`"long"`))
+			if _, err := fc.ReadFrame(bufio.NewReader(bytes.NewReader(msg)), len(msg)-1); err == nil {
+				t.Fatalf("%v read frame over max length", c.Name())
+			}
+		}
+	}
+}
+
+func TestJSONCompatible(t *testing.T) {
+	packet, err := JSONCodec{}.Decode([]byte(`{"msg_id":"101","payload":"{\"a\":1}"}`))
+	if err != nil || packet.Tag != 101 || string(packet.Payload) != `{"a":1}` {
+		t.Fatalf("decode old ws message:%v %v", packet, err)
+	}
+	if _, err := (JSONCodec{}).Encode(1, []byte("not json")); err == nil {
+		t.Fatal("encode non-json payload")
+	}
+	msg, _ := JSONCodec{}.Encode(7, []byte("{\n \"a\": 1\n}"))
+	if string(msg) != "{\"msg_id\":7,\"payload\":{\"a\":1}}\n" {
+		t.Fatalf("encode %q", msg)
+	}
+}
+
+func TestMsgpackFormat(t *testing.T) {
+	msg, _ := MsgpackCodec{}.Encode(5, []byte("hi"))
+	if !bytes.Equal(msg, []byte{0x92, 0x05, 0xc4, 0x02, 'h', 'i'}) {
+		t.Fatalf("encode %x", msg)
+	}
+	// 脚本客户端用str发送payload
+	packet, err := MsgpackCodec{}.Decode([]byte{0x92, 0xcd, 0x01, 0x00, 0xa2, 'h', 'i'})
+	if err != nil || packet.Tag != 256 || string(packet.Payload) != "hi" {
+		t.Fatalf("decode str payload:%v %v", packet, err)
+	}
+}
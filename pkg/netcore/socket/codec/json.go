@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+// JSONCodec 一行json：{"msg_id":tag,"payload":{...}}，以换行结尾。
+// payload需要是json，原样放在payload字段；解码时msg_id也接受字符串，
+// payload是字符串时取字符串的内容，兼容原来ws客户端的格式
+type JSONCodec struct{}
+
+type jsonMessage struct {
+	MsgID   json.RawMessage `json:"msg_id"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+func (JSONCodec) Text() bool {
+	return true
+}
+
+func (JSONCodec) Encode(tag uint32, payload []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(payload)+32))
+	buf.WriteString(`{"msg_id":`)
+	buf.WriteString(strconv.FormatUint(uint64(tag), 10))
+	buf.WriteString(`,"payload":`)
+	if len(payload) <= 0 {
+		buf.WriteString("null")
+	} else if err := json.Compact(buf, payload); err != nil {
+		return nil, fmt.Errorf("json payload of msg(%v) error:%v", tag, err)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+func (JSONCodec) Decode(msg []byte) (*utils.TLVPacket, error) {
+	var m jsonMessage
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return nil, fmt.Errorf("unmarshal request message error:%v", err)
+	}
+	if len(m.MsgID) <= 0 {
+		return nil, fmt.Errorf("not found msg id:%s", msg)
+	}
+	id := string(m.MsgID)
+	if m.MsgID[0] == '"' {
+		if err := json.Unmarshal(m.MsgID, &id); err != nil {
+			return nil, fmt.Errorf("msg id is not integer:%s", msg)
+		}
+	}
+	tag, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("msg id is not integer:%s", msg)
+	}
+
+	packet := &utils.TLVPacket{Tag: uint32(tag)}
+	switch {
+	case len(m.Payload) <= 0 || string(m.Payload) == "null":
+	case m.Payload[0] == '"':
+		var s string
+		if err := json.Unmarshal(m.Payload, &s); err != nil {
+			return nil, fmt.Errorf("unmarshal payload error:%v", err)
+		}
+		packet.Payload = []byte(s)
+	default:
+		packet.Payload = append(make([]byte, 0, len(m.Payload)), m.Payload...)
+	}
+	return packet, nil
+}
+
+func (JSONCodec) ReadFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	frame := make([]byte, 0, 256)
+	for {
+		line, err := r.ReadSlice('\n')
+		frame = append(frame, line...)
+		if len(frame) > maxBytes {
+			return nil, fmt.Errorf("error read json reach max length:%v", maxBytes)
+		}
+		if err == nil {
+			return frame, nil
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+}
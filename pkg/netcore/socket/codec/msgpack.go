@@ -0,0 +1,172 @@
+package codec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+// MsgpackCodec msgpack数组[tag, payload]，tag为无符号整数，payload为bin，
+// 解码时payload也接受str和nil，方便脚本语言客户端
+type MsgpackCodec struct{}
+
+const msgpackArray2 = 0x92
+
+func (MsgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (MsgpackCodec) Encode(tag uint32, payload []byte) ([]byte, error) {
+	buf := make([]byte, 0, 1+5+5+len(payload))
+	buf = append(buf, msgpackArray2)
+	switch {
+	case tag <= 0x7f:
+		buf = append(buf, byte(tag))
+	case tag <= math.MaxUint8:
+		buf = append(buf, 0xcc, byte(tag))
+	case tag <= math.MaxUint16:
+		buf = append(buf, 0xcd, byte(tag>>8), byte(tag))
+	default:
+		buf = append(buf, 0xce, byte(tag>>24), byte(tag>>16), byte(tag>>8), byte(tag))
+	}
+	switch n := len(payload); {
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xc5, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0xc6, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(buf, payload...), nil
+}
+
+func (MsgpackCodec) Decode(msg []byte) (*utils.TLVPacket, error) {
+	tag, offset, length, err := msgpackHeader(msg)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(offset)+length != uint64(len(msg)) {
+		return nil, fmt.Errorf("error read msgpack(%v) invalid length:%v/%v", tag, len(msg)-offset, length)
+	}
+	payload := make([]byte, length)
+	copy(payload, msg[offset:])
+	return &utils.TLVPacket{Tag: tag, Payload: payload}, nil
+}
+
+func (MsgpackCodec) ReadFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	// 依次peek数组头、tag、payload长度，得到完整头部
+	head, err := r.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	tagBytes, err := msgpackUintBytes(head[1])
+	if err != nil {
+		return nil, err
+	}
+	if head, err = r.Peek(1 + tagBytes + 1); err != nil {
+		return nil, err
+	}
+	lenBytes, err := msgpackLenBytes(head[1+tagBytes])
+	if err != nil {
+		return nil, err
+	}
+	if head, err = r.Peek(1 + tagBytes + lenBytes); err != nil {
+		return nil, err
+	}
+	tag, offset, length, err := msgpackHeader(head)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(offset)+length > uint64(maxBytes) {
+		return nil, fmt.Errorf("error read msgpack(%v) reach max length:%v/%v", tag, length, maxBytes)
+	}
+	frame := make([]byte, offset+int(length))
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// msgpackHeader 解析数组头、tag和payload长度，返回payload的起始位置和长度
+func msgpackHeader(msg []byte) (tag uint32, offset int, length uint64, err error) {
+	if len(msg) < 3 || msg[0] != msgpackArray2 {
+		return 0, 0, 0, fmt.Errorf("error msgpack header, need array of [tag, payload]")
+	}
+	tagBytes, err := msgpackUintBytes(msg[1])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(msg) < 1+tagBytes+1 {
+		return 0, 0, 0, fmt.Errorf("error msgpack header:%v", len(msg))
+	}
+	v := msgpackUint(msg[1 : 1+tagBytes])
+	if v > math.MaxUint32 {
+		return 0, 0, 0, fmt.Errorf("error msgpack tag:%v", v)
+	}
+	tag = uint32(v)
+
+	offset = 1 + tagBytes
+	lenBytes, err := msgpackLenBytes(msg[offset])
+	if err != nil {
+		return tag, 0, 0, err
+	}
+	if len(msg) < offset+lenBytes {
+		return tag, 0, 0, fmt.Errorf("error msgpack header:%v", len(msg))
+	}
+	switch b := msg[offset]; {
+	case b == 0xc0:
+		length = 0
+	case b&0xe0 == 0xa0:
+		length = uint64(b & 0x1f)
+	default:
+		length = msgpackUint(msg[offset : offset+lenBytes])
+	}
+	return tag, offset + lenBytes, length, nil
+}
+
+// msgpackUintBytes 无符号整数编码的字节数，包括类型字节
+func msgpackUintBytes(b byte) (int, error) {
+	switch {
+	case b <= 0x7f:
+		return 1, nil
+	case b == 0xcc:
+		return 2, nil
+	case b == 0xcd:
+		return 3, nil
+	case b == 0xce:
+		return 5, nil
+	case b == 0xcf:
+		return 9, nil
+	}
+	return 0, fmt.Errorf("error msgpack tag type:%#x", b)
+}
+
+// msgpackLenBytes payload类型和长度的字节数
+func msgpackLenBytes(b byte) (int, error) {
+	switch {
+	case b == 0xc0 || b&0xe0 == 0xa0:
+		return 1, nil
+	case b == 0xc4 || b == 0xd9:
+		return 2, nil
+	case b == 0xc5 || b == 0xda:
+		return 3, nil
+	case b == 0xc6 || b == 0xdb:
+		return 5, nil
+	}
+	return 0, fmt.Errorf("error msgpack payload type:%#x", b)
+}
+
+// msgpackUint 读取类型字节之后的大端整数，正fixint直接是值
+func msgpackUint(b []byte) uint64 {
+	if len(b) == 1 {
+		return uint64(b[0])
+	}
+	var v uint64
+	for _, c := range b[1:] {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
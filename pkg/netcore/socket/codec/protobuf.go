@@ -0,0 +1,106 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+// ProtobufCodec varint长度+protobuf信封，信封定义：
+//
+//	message Envelope {
+//	    uint32 tag = 1;
+//	    bytes payload = 2;
+//	}
+//
+// 和protobuf的writeDelimitedTo/parseDelimitedFrom兼容
+type ProtobufCodec struct{}
+
+const (
+	envelopeTag     protowire.Number = 1
+	envelopePayload protowire.Number = 2
+)
+
+func (ProtobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (ProtobufCodec) Encode(tag uint32, payload []byte) ([]byte, error) {
+	size := protowire.SizeTag(envelopeTag) + protowire.SizeVarint(uint64(tag))
+	if len(payload) > 0 {
+		size += protowire.SizeTag(envelopePayload) + protowire.SizeBytes(len(payload))
+	}
+	buf := make([]byte, 0, protowire.SizeVarint(uint64(size))+size)
+	buf = protowire.AppendVarint(buf, uint64(size))
+	buf = protowire.AppendTag(buf, envelopeTag, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, uint64(tag))
+	if len(payload) > 0 {
+		buf = protowire.AppendTag(buf, envelopePayload, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, payload)
+	}
+	return buf, nil
+}
+
+func (ProtobufCodec) Decode(msg []byte) (*utils.TLVPacket, error) {
+	size, n := protowire.ConsumeVarint(msg)
+	if n < 0 {
+		return nil, fmt.Errorf("error protobuf length:%v", protowire.ParseError(n))
+	}
+	msg = msg[n:]
+	if size != uint64(len(msg)) {
+		return nil, fmt.Errorf("error protobuf invalid length:%v/%v", len(msg), size)
+	}
+
+	packet := &utils.TLVPacket{}
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return nil, fmt.Errorf("error protobuf envelope:%v", protowire.ParseError(n))
+		}
+		msg = msg[n:]
+		switch {
+		case num == envelopeTag && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(msg)
+			if n < 0 {
+				return nil, fmt.Errorf("error protobuf envelope tag:%v", protowire.ParseError(n))
+			}
+			packet.Tag = uint32(v)
+			msg = msg[n:]
+		case num == envelopePayload && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(msg)
+			if n < 0 {
+				return nil, fmt.Errorf("error protobuf envelope payload:%v", protowire.ParseError(n))
+			}
+			packet.Payload = append(make([]byte, 0, len(v)), v...)
+			msg = msg[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, msg)
+			if n < 0 {
+				return nil, fmt.Errorf("error protobuf envelope field(%v):%v", num, protowire.ParseError(n))
+			}
+			msg = msg[n:]
+		}
+	}
+	return packet, nil
+}
+
+func (ProtobufCodec) ReadFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	head := protowire.SizeVarint(size)
+	if size+uint64(head) > uint64(maxBytes) {
+		return nil, fmt.Errorf("error read protobuf reach max length:%v/%v", size, maxBytes)
+	}
+	frame := make([]byte, head+int(size))
+	protowire.AppendVarint(frame[:0], size)
+	if _, err := io.ReadFull(r, frame[head:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
@@ -0,0 +1,38 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+// RawCodec tag(4)+payload，大端，没有长度，只能用于ws二进制帧和udp
+type RawCodec struct{}
+
+func (RawCodec) Name() string {
+	return "raw"
+}
+
+func (RawCodec) Encode(tag uint32, payload []byte) ([]byte, error) {
+	buf := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(buf, tag)
+	copy(buf[4:], payload)
+	return buf, nil
+}
+
+func (RawCodec) Tag(msg []byte) (uint32, error) {
+	if len(msg) < 4 {
+		return 0, fmt.Errorf("error raw header:%v", len(msg))
+	}
+	return binary.BigEndian.Uint32(msg), nil
+}
+
+func (RawCodec) Decode(msg []byte) (*utils.TLVPacket, error) {
+	if len(msg) < 4 {
+		return nil, fmt.Errorf("error raw header:%v", len(msg))
+	}
+	payload := make([]byte, len(msg)-4)
+	copy(payload, msg[4:])
+	return &utils.TLVPacket{Tag: binary.BigEndian.Uint32(msg), Payload: payload}, nil
+}
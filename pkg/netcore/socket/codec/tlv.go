@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+// TLVCodec tag(4)+length(4)+payload，大端，和utils.ReadTLVMsg相同
+type TLVCodec struct{}
+
+func (TLVCodec) Name() string {
+	return "tlv"
+}
+
+func (TLVCodec) Encode(tag uint32, payload []byte) ([]byte, error) {
+	buf := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(buf, tag)
+	binary.BigEndian.PutUint32(buf[4:], uint32(len(payload)))
+	copy(buf[8:], payload)
+	return buf, nil
+}
+
+func (TLVCodec) Tag(msg []byte) (uint32, error) {
+	if len(msg) < 8 {
+		return 0, fmt.Errorf("error tlv header:%v", len(msg))
+	}
+	tag := binary.BigEndian.Uint32(msg)
+	if length := binary.BigEndian.Uint32(msg[4:]); uint64(length) != uint64(len(msg)-8) {
+		return tag, fmt.Errorf("error read tlv(%v) invalid length:%v/%v", tag, len(msg)-8, length)
+	}
+	return tag, nil
+}
+
+func (TLVCodec) Decode(msg []byte) (*utils.TLVPacket, error) {
+	if len(msg) < 8 {
+		return nil, fmt.Errorf("error tlv header:%v", len(msg))
+	}
+	tag := binary.BigEndian.Uint32(msg)
+	length := binary.BigEndian.Uint32(msg[4:])
+	if uint64(length) != uint64(len(msg)-8) {
+		return &utils.TLVPacket{Tag: tag}, fmt.Errorf("error read tlv(%v) invalid length:%v/%v", tag, len(msg)-8, length)
+	}
+	payload := make([]byte, length)
+	copy(payload, msg[8:])
+	return &utils.TLVPacket{Tag: tag, Payload: payload}, nil
+}
+
+func (TLVCodec) ReadFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	head, err := r.Peek(8)
+	if err != nil {
+		if len(head) > 0 && err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(head[4:])
+	if uint64(length)+8 > uint64(maxBytes) {
+		return nil, fmt.Errorf("error read tlv(%v) reach max length:%v/%v", binary.BigEndian.Uint32(head), length, maxBytes)
+	}
+	frame := make([]byte, 8+int(length))
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
@@ -5,5 +5,8 @@ import "errors"
 type Error error
 
 var (
-	ErrReadTimeout Error = errors.New("read timeout")
+	ErrReadTimeout      Error = errors.New("read timeout")
+	ErrServerShutdown   Error = errors.New("server shutdown")
+	ErrHeartbeatTimeout Error = errors.New("heartbeat timeout")
+	ErrIdle             Error = errors.New("idle timeout")
 )
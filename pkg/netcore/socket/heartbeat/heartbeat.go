@@ -0,0 +1,228 @@
+// Package heartbeat 传输层内置的心跳和空闲检测。
+// 发起方每个间隔发送一个ping，payload为十进制的发送时间(UnixNano)，同时是合法的json数字，各种编解码都可以发送，
+// 对方原样回复pong，发起方据此测量往返时间。
+// 心跳消息在读协程中处理，不交给逻辑层；被踢出的连接用检测策略返回的错误作为原因关闭
+package heartbeat
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"joynova.com/library/supernova/pkg/jlog"
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+const defaultInterval = 5 * time.Second
+
+const defaultMissedPings = 3
+
+// Mode 由哪一端发起ping，另一端只回复pong
+type Mode int
+
+const (
+	ServerPing Mode = iota // 服务器发起ping，服务器可以测量往返时间
+	ClientPing             // 客户端发起ping，服务器只回复并检测超时
+)
+
+// Option 心跳配置
+type Option struct {
+	PingTag  uint32        // ping消息的tag，必须设置
+	PongTag  uint32        // pong消息的tag，默认PingTag+1
+	Mode     Mode          // 由哪一端发起ping
+	Interval time.Duration // 发送ping和检测策略的间隔，默认5秒
+	Policies []Policy      // 踢出策略，为空时发起方连续3个ping没有回复踢出，另一端3个间隔没有收到任何消息踢出
+}
+
+// Stat 一个连接的心跳状态
+type Stat struct {
+	LastRecv time.Time     // 最后收到任何消息的时间，包括心跳
+	LastMsg  time.Time     // 最后收到业务消息的时间
+	RTT      time.Duration // 最近一次测量的往返时间，没有测量过为0
+	Missed   int           // 上次收到pong之后发送成功的ping数
+}
+
+// Policy 每个间隔检查一次，返回非空时踢出连接，返回值作为ClientSideCloseSession的原因
+type Policy func(stat Stat, now time.Time) event.Error
+
+// MissedPings 连续n个ping没有回复时踢出，原因为event.ErrHeartbeatTimeout，只对发起方有效
+func MissedPings(n int) Policy {
+	return func(stat Stat, now time.Time) event.Error {
+		if stat.Missed >= n {
+			return event.ErrHeartbeatTimeout
+		}
+		return nil
+	}
+}
+
+// RecvTimeout 超过d没有收到任何消息时踢出，原因为event.ErrHeartbeatTimeout
+func RecvTimeout(d time.Duration) Policy {
+	return func(stat Stat, now time.Time) event.Error {
+		if now.Sub(stat.LastRecv) >= d {
+			return event.ErrHeartbeatTimeout
+		}
+		return nil
+	}
+}
+
+// IdleTimeout 超过d没有收到业务消息时踢出，只回复心跳的连接也会被踢出，原因为event.ErrIdle
+func IdleTimeout(d time.Duration) Policy {
+	return func(stat Stat, now time.Time) event.Error {
+		if now.Sub(stat.LastMsg) >= d {
+			return event.ErrIdle
+		}
+		return nil
+	}
+}
+
+// Keeper 一个连接的心跳状态，读协程和心跳协程同时使用
+type Keeper struct {
+	pingTag  uint32
+	pongTag  uint32
+	interval time.Duration
+	ping     bool // 这一端是否发起ping
+	policies []Policy
+
+	lock sync.Mutex
+	stat Stat
+}
+
+// NewKeeper option为空或者没有设置PingTag时返回nil，表示不开启心跳。
+// isServer为true时是服务器一端，按Mode决定是否发起ping
+func NewKeeper(option *Option, isServer bool) *Keeper {
+	if option == nil || option.PingTag == 0 {
+		return nil
+	}
+	k := &Keeper{}
+	k.pingTag = option.PingTag
+	k.pongTag = option.PongTag
+	if k.pongTag == 0 {
+		k.pongTag = option.PingTag + 1
+	}
+	k.interval = option.Interval
+	if k.interval <= 0 {
+		k.interval = defaultInterval
+	}
+	k.ping = (option.Mode == ServerPing) == isServer
+	k.policies = option.Policies
+	if len(k.policies) == 0 {
+		if k.ping {
+			k.policies = []Policy{MissedPings(defaultMissedPings)}
+		} else {
+			k.policies = []Policy{RecvTimeout(defaultMissedPings * k.interval)}
+		}
+	}
+	now := time.Now()
+	k.stat.LastRecv = now
+	k.stat.LastMsg = now
+	return k
+}
+
+// Interval 调用Tick的间隔
+func (k *Keeper) Interval() time.Duration {
+	return k.interval
+}
+
+// HandleRecv 收到一个消息时调用，心跳消息返回true和需要回复的包(可能为空)，业务消息返回false
+func (k *Keeper) HandleRecv(packet *utils.TLVPacket) (*utils.TLVPacket, bool) {
+	return k.handleRecv(packet, time.Now())
+}
+
+// IsHeartbeat tag是否为ping或pong，业务消息不需要解码payload，用只有tag的包调用HandleRecv即可
+func (k *Keeper) IsHeartbeat(tag uint32) bool {
+	return tag == k.pingTag || tag == k.pongTag
+}
+
+func (k *Keeper) handleRecv(packet *utils.TLVPacket, now time.Time) (*utils.TLVPacket, bool) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.stat.LastRecv = now
+	switch packet.Tag {
+	case k.pingTag:
+		return &utils.TLVPacket{Tag: k.pongTag, Payload: packet.Payload}, true
+	case k.pongTag:
+		k.stat.Missed = 0
+		if nano, err := strconv.ParseInt(string(packet.Payload), 10, 64); err == nil {
+			if rtt := now.Sub(time.Unix(0, nano)); rtt >= 0 {
+				k.stat.RTT = rtt
+			}
+		}
+		return nil, true
+	}
+	k.stat.LastMsg = now
+	return nil, false
+}
+
+// Tick 每个间隔调用一次，返回需要发送的ping(不发起ping时为空)，需要踢出时返回原因，
+// ping发送成功后调用PingSent
+func (k *Keeper) Tick() (*utils.TLVPacket, event.Error) {
+	return k.tick(time.Now())
+}
+
+func (k *Keeper) tick(now time.Time) (*utils.TLVPacket, event.Error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	for _, policy := range k.policies {
+		if reason := policy(k.stat, now); reason != nil {
+			return nil, reason
+		}
+	}
+	if !k.ping {
+		return nil, nil
+	}
+	return &utils.TLVPacket{Tag: k.pingTag, Payload: []byte(strconv.FormatInt(now.UnixNano(), 10))}, nil
+}
+
+// PingSent ping已经发送，编码或者发送失败的ping不算作没有回复
+func (k *Keeper) PingSent() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.stat.Missed++
+}
+
+// Run 按间隔调用Tick，用send发送ping，需要踢出时调用kick后返回，stop关闭时返回
+func (k *Keeper) Run(stop <-chan struct{}, send func(*utils.TLVPacket) error, kick func(event.Error)) {
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ping, reason := k.Tick()
+			if reason != nil {
+				kick(reason)
+				return
+			}
+			if ping == nil {
+				continue
+			}
+			if err := send(ping); err != nil {
+				jlog.Warnf("[net core]heartbeat send ping error:%v", err)
+				continue
+			}
+			k.PingSent()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// RTT 最近一次测量的往返时间，k为空或者没有测量过时为0
+func (k *Keeper) RTT() time.Duration {
+	if k == nil {
+		return 0
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.stat.RTT
+}
+
+// Stat 当前的心跳状态，k为空时返回零值
+func (k *Keeper) Stat() Stat {
+	if k == nil {
+		return Stat{}
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.stat
+}
@@ -0,0 +1,100 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+func TestDisabled(t *testing.T) {
+	if k := NewKeeper(nil, true); k != nil || k.RTT() != 0 {
+		t.Fatal("nil option should disable heartbeat")
+	}
+	if k := NewKeeper(&Option{Interval: time.Second}, true); k != nil {
+		t.Fatal("zero ping tag should disable heartbeat")
+	}
+}
+
+func TestServerPing(t *testing.T) {
+	k := NewKeeper(&Option{PingTag: 100, Interval: time.Second}, true)
+	now := time.Now()
+
+	ping, reason := k.tick(now)
+	if reason != nil || ping == nil || ping.Tag != 100 || !json.Valid(ping.Payload) {
+		t.Fatalf("ping %v %v", ping, reason)
+	}
+	k.PingSent()
+	// 对方原样回复pong
+	if reply, ok := k.handleRecv(&utils.TLVPacket{Tag: 101, Payload: ping.Payload}, now.Add(30*time.Millisecond)); !ok || reply != nil {
+		t.Fatalf("pong %v %v", reply, ok)
+	}
+	if k.RTT() != 30*time.Millisecond || k.Stat().Missed != 0 {
+		t.Fatalf("stat %+v", k.Stat())
+	}
+	if _, ok := k.handleRecv(&utils.TLVPacket{Tag: 1}, now); ok {
+		t.Fatal("business msg handled as heartbeat")
+	}
+
+	// 没有发送成功的ping不计数
+	for i := 1; i <= 5; i++ {
+		if ping, reason := k.tick(now.Add(time.Duration(i) * time.Second)); ping == nil || reason != nil {
+			t.Fatalf("unsent tick %v: %v %v", i, ping, reason)
+		}
+	}
+	// 默认连续3个ping没有回复踢出
+	for i := 1; i <= 3; i++ {
+		if ping, reason := k.tick(now.Add(time.Duration(i) * time.Second)); ping == nil || reason != nil {
+			t.Fatalf("tick %v: %v %v", i, ping, reason)
+		}
+		k.PingSent()
+	}
+	if _, reason := k.tick(now.Add(4 * time.Second)); reason != event.ErrHeartbeatTimeout {
+		t.Fatalf("missed pings reason %v", reason)
+	}
+}
+
+func TestClientPing(t *testing.T) {
+	k := NewKeeper(&Option{PingTag: 100, PongTag: 200, Mode: ClientPing, Interval: time.Second}, true)
+	now := time.Now()
+
+	if ping, reason := k.tick(now); ping != nil || reason != nil {
+		t.Fatalf("server should not ping: %v %v", ping, reason)
+	}
+	reply, ok := k.handleRecv(&utils.TLVPacket{Tag: 100, Payload: []byte("any")}, now)
+	if !ok || reply == nil || reply.Tag != 200 || string(reply.Payload) != "any" {
+		t.Fatalf("pong %v %v", reply, ok)
+	}
+	if k.RTT() != 0 {
+		t.Fatalf("rtt %v", k.RTT())
+	}
+	// 默认3个间隔没有收到消息踢出
+	if _, reason := k.tick(now.Add(3 * time.Second)); reason != event.ErrHeartbeatTimeout {
+		t.Fatalf("recv timeout reason %v", reason)
+	}
+
+	// 客户端一侧发起ping
+	if ping, _ := NewKeeper(&Option{PingTag: 100, Mode: ClientPing}, false).tick(now); ping == nil {
+		t.Fatal("client should ping")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	k := NewKeeper(&Option{PingTag: 100, Policies: []Policy{IdleTimeout(time.Minute), MissedPings(10)}}, true)
+	now := time.Now()
+
+	// 只回复心跳的连接也会空闲超时
+	for i := 1; i < 6; i++ {
+		ping, reason := k.tick(now.Add(time.Duration(i) * 10 * time.Second))
+		if reason != nil {
+			t.Fatalf("tick %v reason %v", i, reason)
+		}
+		k.PingSent()
+		k.handleRecv(&utils.TLVPacket{Tag: 101, Payload: ping.Payload}, now.Add(time.Duration(i)*10*time.Second))
+	}
+	if _, reason := k.tick(now.Add(time.Minute)); reason != event.ErrIdle {
+		t.Fatalf("idle reason %v", reason)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
 	"joynova.com/library/supernova/pkg/netcore/socket/socket"
 	"joynova.com/library/supernova/pkg/netcore/socket/socket/tcp"
+	"joynova.com/library/supernova/pkg/netcore/socket/socket/udp"
 	"joynova.com/library/supernova/pkg/netcore/socket/socket/ws"
 )
 
@@ -14,15 +17,20 @@ type ClientConn = internal_socket.InternalClientConn
 type ClientConnType = internal_socket.InternalClientConnType
 type Session = internal_socket.InternalSession
 type Server = internal_socket.InternalServer
+type Codec = codec.Codec
+type FrameCodec = codec.FrameCodec
+type WSOption = ws.Option
+type HeartbeatOption = heartbeat.Option
 
 var ClientConnTypeTcp = internal_socket.InternalClientConnTypeTcp
 var ClientConnTypeWs = internal_socket.InternalClientConnTypeWs
+var ClientConnTypeUdp = internal_socket.InternalClientConnTypeUdp
 
 func NewServer(commType, addr string, newSessionFunc func(ClientConn) Session, option *Option) Server {
 	if commType == "tcp" {
 		return tcp.NewServer(addr, newSessionFunc, option)
 	} else if commType == "udp" {
-		// return udp.NewServer(addr)
+		return udp.NewServer(addr, newSessionFunc, option)
 	}
 	// else if commType == "ws" {
 	// 	return ws.NewServer(addr, newConnFun)
@@ -36,6 +44,14 @@ func NewWSServer(addr string, newSessionFunc func(ClientConn) Session, option *O
 	return ws.NewServerWithLogger(addr, newSessionFunc, option, loggerFun, panicOutputFun, fs)
 }
 
+// NewWSServerWithOption 指定子协议、Origin校验、压缩等websocket配置
+func NewWSServerWithOption(addr string, newSessionFunc func(ClientConn) Session, option *Option, wsOption WSOption,
+	loggerFun func(params gin.LogFormatterParams), panicOutputFun func(string), fs http.FileSystem) Server {
+	s := ws.NewServerWithLogger(addr, newSessionFunc, option, loggerFun, panicOutputFun, fs)
+	s.SetWSOption(wsOption)
+	return s
+}
+
 func SetLogErrorFun(f func(session internal_socket.InternalSession, format string, args ...interface{})) {
 	internal_socket.InternalLogErrorFun = f
 }
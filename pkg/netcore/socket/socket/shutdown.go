@@ -0,0 +1,55 @@
+package internal_socket
+
+import (
+	"context"
+	"sync"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+// ShutdownSessions 删除所有session，向每个session发送notify，等待写缓冲发送完之后关闭连接并调用ServerSideCloseSession，
+// 钩子的参数为event.ErrServerShutdown。ctx结束时强制关闭剩下的连接并返回ctx.Err()。
+// flush需要在连接关闭后立即返回，closeConn需要可以重复调用
+func ShutdownSessions(ctx context.Context, sessionMgr *sync.Map, notify *utils.TLVPacket,
+	flush func(ctx context.Context, session InternalSession) error, closeConn func(session InternalSession)) error {
+	sessions := make([]InternalSession, 0)
+	sessionMgr.Range(func(key, value interface{}) bool {
+		// 同时被CloseSession或者客户端断开删除的session由对方关闭
+		if value, find := sessionMgr.LoadAndDelete(key); find {
+			sessions = append(sessions, value.(InternalSession))
+		}
+		return true
+	})
+
+	var wg sync.WaitGroup
+	for _, session := range sessions {
+		wg.Add(1)
+		go func(session InternalSession) {
+			defer wg.Done()
+			if notify != nil && notify.Tag > 0 {
+				session.GetClientConn().WriteTLV(session, notify.Tag, notify.Payload)
+			}
+			flush(ctx, session)
+			closeConn(session)
+			session.ServerSideCloseSession(event.ErrServerShutdown)
+		}(session)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		// 强制关闭，阻塞在写缓冲上的协程随之返回
+		for _, session := range sessions {
+			closeConn(session)
+		}
+		<-done
+		return ctx.Err()
+	}
+}
@@ -1,6 +1,7 @@
 package internal_socket
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"math/rand"
@@ -8,7 +9,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
 	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
 	"joynova.com/library/supernova/pkg/netcore/socket/utils"
 )
 
@@ -16,12 +19,22 @@ type InternalClientConnType int
 
 var InternalClientConnTypeTcp InternalClientConnType = 1
 var InternalClientConnTypeWs InternalClientConnType = 2
+var InternalClientConnTypeUdp InternalClientConnType = 3
 
 type InternalOption struct {
-	RecvTimeout  time.Duration // optional
-	RecvMsgBytes int           // optional, default 1<<16
-	WriteTimeout time.Duration // optional
+	RecvTimeout  time.Duration     // optional
+	RecvMsgBytes int               // optional, default 1<<16
+	WriteTimeout time.Duration     // optional
+	Codec        codec.Codec       // optional, default tlv, ws default json
+	Heartbeat    *heartbeat.Option // optional, 为空时不开启心跳，只用RecvTimeout检测
+}
 
+// GetCodec 设置的编解码，没有设置时返回def
+func (op *InternalOption) GetCodec(def codec.Codec) codec.Codec {
+	if op == nil || op.Codec == nil {
+		return def
+	}
+	return op.Codec
 }
 
 var incID int64
@@ -51,7 +64,10 @@ func GetID() int64 {
 
 type InternalServer interface {
 	Listen() error
+	// Stop 停止监听，tcp和ws已经建立的session不受影响，udp所有session随socket关闭
 	Stop()
+	// Shutdown 停止接受新连接，向所有session发送notify，发送完写缓冲后关闭，ctx结束时强制关闭
+	Shutdown(ctx context.Context, notify *utils.TLVPacket) error
 	GetSession(int64) (InternalSession, bool)
 	CloseSession(int64, *utils.TLVPacket, time.Duration, interface{}) bool
 }
@@ -62,6 +78,8 @@ type InternalClientConn interface {
 	GetIP() string
 	GetConn() net.Conn
 	InitSession(*InternalOption)
+	// GetRTT 心跳测量的往返时间，没有开启心跳、由客户端发起ping或者还没测量时为0
+	GetRTT() time.Duration
 	WriteTLV(s InternalSession, tag uint32, payload []byte) (int, error)
 }
 
@@ -84,7 +102,7 @@ type InternalSession interface {
 	PreServerSideCloseSession(*utils.TLVPacket, interface{})
 	// ServerSideCloseSession 服务器关闭了tcp链接
 	ServerSideCloseSession(interface{})
-	// ClientSideCloseSession 客户端主动关闭链接
+	// ClientSideCloseSession 客户端主动关闭链接，或者读超时、心跳超时被踢出
 	ClientSideCloseSession(err event.Error)
 }
 
@@ -2,14 +2,16 @@ package tcp
 
 import (
 	"bufio"
-	"encoding/binary"
+	"context"
 	"fmt"
 	"net"
 	"sync/atomic"
 	"time"
 
 	"joynova.com/library/supernova/pkg/jlog"
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
 	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
 	internalSocket "joynova.com/library/supernova/pkg/netcore/socket/socket"
 	"joynova.com/library/supernova/pkg/netcore/socket/utils"
 )
@@ -24,6 +26,8 @@ type clientConn struct {
 	option        *internalSocket.InternalOption
 	isStop        int32
 	stopChan      chan struct{}
+	flushed       chan struct{}     // Shutdown时写缓冲发送完
+	heartbeat     *heartbeat.Keeper // 没有开启心跳时为空
 }
 
 func (c *clientConn) GetClientConnType() internalSocket.InternalClientConnType {
@@ -38,6 +42,10 @@ func (c *clientConn) GetIP() string {
 	return c.conn.RemoteAddr().String()
 }
 
+func (c *clientConn) GetRTT() time.Duration {
+	return c.heartbeat.RTT()
+}
+
 func (c *clientConn) InitSession(op *internalSocket.InternalOption) {
 	c.option = op
 }
@@ -52,10 +60,10 @@ func (c *clientConn) WriteTLV(session internalSocket.InternalSession, tag uint32
 }
 
 func (c *clientConn) writeTLV(tag uint32, payload []byte) (int, error) {
-	buf := make([]byte, 8+len(payload))
-	binary.BigEndian.PutUint32(buf, tag)
-	binary.BigEndian.PutUint32(buf[4:], uint32(len(payload)))
-	copy(buf[8:], payload)
+	buf, err := c.option.GetCodec(codec.TLVCodec{}).Encode(tag, payload)
+	if err != nil {
+		return 0, err
+	}
 	return c.write(buf)
 }
 
@@ -64,15 +72,38 @@ func (c *clientConn) write(buf []byte) (int, error) {
 		return len(buf), nil
 	}
 
-	c.writeQueue <- buf
+	select {
+	case c.writeQueue <- buf:
+	case <-c.stopChan:
+	}
 	return len(buf), nil
 }
 
+// flush 等待写缓冲中已有的消息发送完，在写缓冲中放入nil作为标记
+func (c *clientConn) flush(ctx context.Context) error {
+	c.flushed = make(chan struct{})
+	select {
+	case c.writeQueue <- nil:
+	case <-c.stopChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-c.flushed:
+		return nil
+	case <-c.stopChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close 可以在多个协程重复调用
 func (c *clientConn) close() {
-	if atomic.LoadInt32(&c.isStop) == 1 {
+	if !atomic.CompareAndSwapInt32(&c.isStop, 0, 1) {
 		return
 	}
-	atomic.StoreInt32(&c.isStop, 1)
 	c.conn.Close()
 	close(c.stopChan)
 }
@@ -88,7 +119,7 @@ func (conn *clientConn) handleClientConnRead(server *server, customSession inter
 			maxRecvBytes = setOption.RecvMsgBytes
 		}
 
-		packet, err := utils.ReadTLVMsg(conn.inStream, int32(maxRecvBytes))
+		packet, err := codec.ReadPacket(setOption.GetCodec(codec.TLVCodec{}), conn.inStream, maxRecvBytes)
 		if err != nil {
 			if atomic.LoadInt32(&conn.isStop) == 1 {
 				break
@@ -108,10 +139,40 @@ func (conn *clientConn) handleClientConnRead(server *server, customSession inter
 			break
 		}
 
+		if conn.handleHeartbeatRecv(packet) {
+			continue
+		}
 		conn.recvQueue <- packet
 	}
 }
 
+// handleHeartbeatRecv 心跳消息在读协程中直接回复，不进入读缓冲，返回是否为心跳消息
+func (conn *clientConn) handleHeartbeatRecv(packet *utils.TLVPacket) bool {
+	if conn.heartbeat == nil {
+		return false
+	}
+	reply, ok := conn.heartbeat.HandleRecv(packet)
+	if reply != nil {
+		if _, err := conn.writeTLV(reply.Tag, reply.Payload); err != nil {
+			jlog.Warnf("[net core]conn[%v] write heartbeat(%v) error:%v", conn.id, reply.Tag, err)
+		}
+	}
+	return ok
+}
+
+// handleClientConnHeartbeat 按间隔发送ping，检测策略要求踢出时关闭session
+func (conn *clientConn) handleClientConnHeartbeat(server *server) {
+	if conn.heartbeat == nil {
+		return
+	}
+	conn.heartbeat.Run(conn.stopChan, func(ping *utils.TLVPacket) error {
+		_, err := conn.writeTLV(ping.Tag, ping.Payload)
+		return err
+	}, func(reason event.Error) {
+		server.closeSession(conn.GetSessionID(), reason)
+	})
+}
+
 func (conn *clientConn) handleClientConnDeliverRecvMsg(customSession internalSocket.InternalSession) {
 
 	for {
@@ -169,6 +230,11 @@ func (conn *clientConn) handleClientConnWriteMsg(customSession internalSocket.In
 				return
 			}
 
+			if msg == nil {
+				close(conn.flushed)
+				continue
+			}
+
 			if conn.option.WriteTimeout > 0 {
 				conn.conn.SetWriteDeadline(time.Now().Add(conn.option.WriteTimeout))
 			}
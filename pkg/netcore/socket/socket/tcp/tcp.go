@@ -2,18 +2,23 @@ package tcp
 
 import (
 	"bufio"
+	"context"
 	"net"
 	"sync"
 	"time"
 
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
 	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
 	internalSocket "joynova.com/library/supernova/pkg/netcore/socket/socket"
 	"joynova.com/library/supernova/pkg/netcore/socket/utils"
 )
 
 type server struct {
-	addr string
-	net.Conn
+	addr           string
+	listener       net.Listener
+	lock           sync.Mutex
+	stopped        bool
 	newSessionFunc func(conn internalSocket.InternalClientConn) internalSocket.InternalSession
 	sessionMgr     *sync.Map
 	option         *internalSocket.InternalOption
@@ -30,25 +35,49 @@ func NewServer(addr string, newSessionFunc func(conn internalSocket.InternalClie
 }
 
 func (s *server) Listen() error {
+	// tcp需要从流中切分消息
+	if _, ok := s.option.GetCodec(codec.TLVCodec{}).(codec.FrameCodec); !ok {
+		return codec.ErrNotFrameCodec
+	}
 	listenFd, err := net.Listen("tcp", s.addr)
 	if err != nil {
 		return err
 	}
+	s.lock.Lock()
+	if s.stopped {
+		s.lock.Unlock()
+		return listenFd.Close()
+	}
+	s.listener = listenFd
+	s.lock.Unlock()
 
 	for {
 		conn, err := listenFd.Accept()
 		if err != nil {
+			s.lock.Lock()
+			stopped := s.stopped
+			s.lock.Unlock()
+			if stopped {
+				return nil
+			}
 			return err
 		}
 		client := s.newClientConn(conn, s.option)
 		customSession := s.newSessionFunc(client)
+		// Stop之后不再加入session，保证Shutdown能关闭所有session
+		s.lock.Lock()
+		if s.stopped {
+			s.lock.Unlock()
+			client.close()
+			return nil
+		}
 		s.sessionMgr.Store(client.GetSessionID(), customSession)
+		s.lock.Unlock()
 		go client.handleClientConnRead(s, customSession)
 		go client.handleClientConnDeliverRecvMsg(customSession)
 		go client.handleClientConnWriteMsg(customSession)
+		go client.handleClientConnHeartbeat(s)
 	}
-
-	return nil
 }
 
 func (s *server) GetSession(id int64) (internalSocket.InternalSession, bool) {
@@ -61,14 +90,13 @@ func (s *server) GetSession(id int64) (internalSocket.InternalSession, bool) {
 
 // CloseSession 服务器主动关闭客户端
 func (s *server) CloseSession(id int64, notify *utils.TLVPacket, delay time.Duration, data interface{}) bool {
-	sessionValue, find := s.sessionMgr.Load(id)
+	// 先删除session，并发关闭时只有删除成功的一方调用钩子
+	sessionValue, find := s.sessionMgr.LoadAndDelete(id)
 	if !find {
 		return false
 	}
 
 	session, _ := sessionValue.(internalSocket.InternalSession)
-	// 先删除session
-	s.sessionMgr.Delete(id)
 	// 调用钩子
 	session.PreServerSideCloseSession(notify, data)
 
@@ -84,21 +112,38 @@ func (s *server) CloseSession(id int64, notify *utils.TLVPacket, delay time.Dura
 
 // closeSession 客户端主动关闭
 func (s *server) closeSession(id int64, err event.Error) {
-	sessionValue, find := s.sessionMgr.Load(id)
+	// 先删除session，并发关闭时只有删除成功的一方调用钩子
+	sessionValue, find := s.sessionMgr.LoadAndDelete(id)
 	if !find {
 		return
 	}
 	session, _ := sessionValue.(internalSocket.InternalSession)
-	// 先删除session
-	s.sessionMgr.Delete(id)
 	// 调用钩子
 	session.ClientSideCloseSession(err)
 	// 关闭链接
 	session.GetClientConn().(*clientConn).close()
 }
 
+// Stop 关闭监听，已经建立的session不受影响，Listen返回nil
 func (s *server) Stop() {
-	s.Close()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stopped = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+}
+
+// Shutdown 关闭监听，向所有session发送notify，发送完写缓冲后关闭，ctx结束时强制关闭
+func (s *server) Shutdown(ctx context.Context, notify *utils.TLVPacket) error {
+	s.Stop()
+	return internalSocket.ShutdownSessions(ctx, s.sessionMgr, notify,
+		func(ctx context.Context, session internalSocket.InternalSession) error {
+			return session.GetClientConn().(*clientConn).flush(ctx)
+		},
+		func(session internalSocket.InternalSession) {
+			session.GetClientConn().(*clientConn).close()
+		})
 }
 
 func (s *server) newClientConn(conn net.Conn, option *internalSocket.InternalOption) *clientConn {
@@ -110,5 +155,6 @@ func (s *server) newClientConn(conn net.Conn, option *internalSocket.InternalOpt
 	c.writeQueue = make(chan []byte, 20)
 	c.stopChan = make(chan struct{}, 0)
 	c.option = option
+	c.heartbeat = heartbeat.NewKeeper(option.Heartbeat, true)
 	return c
 }
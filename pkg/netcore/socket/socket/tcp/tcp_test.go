@@ -0,0 +1,211 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
+	internalSocket "joynova.com/library/supernova/pkg/netcore/socket/socket"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+type echoSession struct {
+	conn   internalSocket.InternalClientConn
+	closed chan interface{}
+}
+
+func (s *echoSession) GetClientConn() internalSocket.InternalClientConn { return s.conn }
+func (s *echoSession) PreHandleRequest(*utils.TLVPacket) (*utils.TLVPacket, interface{}, error) {
+	return nil, nil, nil
+}
+func (s *echoSession) HandleRequest(request *utils.TLVPacket, _ interface{}) (*utils.TLVPacket, interface{}, error) {
+	return &utils.TLVPacket{Tag: request.Tag + 1, Payload: request.Payload}, nil, nil
+}
+func (s *echoSession) PreHandleResponse(*utils.TLVPacket, *utils.TLVPacket, interface{}) error {
+	return nil
+}
+func (s *echoSession) PostHandleResponse(*utils.TLVPacket, *utils.TLVPacket, interface{}, error) {}
+func (s *echoSession) PreHandleNotify(uint32, []byte)                                            {}
+func (s *echoSession) PreWritePacket([]byte)                                                     {}
+func (s *echoSession) PreServerSideCloseSession(*utils.TLVPacket, interface{})                   {}
+func (s *echoSession) ServerSideCloseSession(data interface{})                                   { s.closed <- data }
+func (s *echoSession) ClientSideCloseSession(err event.Error)                                    { s.closed <- err }
+
+func startServer(t *testing.T, option *internalSocket.InternalOption) (*server, chan *echoSession, chan error) {
+	sessions := make(chan *echoSession, 10)
+	s := NewServer("127.0.0.1:0", func(conn internalSocket.InternalClientConn) internalSocket.InternalSession {
+		session := &echoSession{conn: conn, closed: make(chan interface{}, 1)}
+		sessions <- session
+		return session
+	}, option)
+	listenErr := make(chan error, 1)
+	go func() { listenErr <- s.Listen() }()
+	for i := 0; i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		s.lock.Lock()
+		listening := s.listener != nil
+		s.lock.Unlock()
+		if listening {
+			return s, sessions, listenErr
+		}
+	}
+	t.Fatal("server not listening")
+	return nil, nil, nil
+}
+
+func TestShutdown(t *testing.T) {
+	s, sessions, listenErr := startServer(t, &internalSocket.InternalOption{})
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	session := <-sessions
+
+	msg, _ := codec.TLVCodec{}.Encode(1, []byte("hello"))
+	client.Write(msg)
+	r := bufio.NewReader(client)
+	if packet, err := codec.ReadPacket(codec.TLVCodec{}, r, 1<<16); err != nil || packet.Tag != 2 {
+		t.Fatalf("response %v %v", packet, err)
+	}
+
+	if err := s.Shutdown(context.Background(), &utils.TLVPacket{Tag: 99, Payload: []byte("bye")}); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-session.closed; data != event.ErrServerShutdown {
+		t.Fatalf("close hook %v", data)
+	}
+	// 告别包发送完之后关闭
+	if packet, err := codec.ReadPacket(codec.TLVCodec{}, r, 1<<16); err != nil || packet.Tag != 99 {
+		t.Fatalf("goodbye %v %v", packet, err)
+	}
+	if _, err := codec.ReadPacket(codec.TLVCodec{}, r, 1<<16); err != io.EOF {
+		t.Fatalf("read after shutdown %v", err)
+	}
+	if err := <-listenErr; err != nil {
+		t.Fatalf("listen %v", err)
+	}
+	if _, err := net.Dial("tcp", s.listener.Addr().String()); err == nil {
+		t.Fatal("still accepting")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	s, sessions, _ := startServer(t, &internalSocket.InternalOption{})
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	session := <-sessions
+
+	// 客户端不读取，写缓冲发送不完
+	payload := make([]byte, 1<<20)
+	for i := 0; i < 15; i++ {
+		session.conn.WriteTLV(session, 5, payload)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Shutdown(ctx, nil); err != context.DeadlineExceeded {
+		t.Fatalf("shutdown %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("force close took %v", time.Since(start))
+	}
+	if data := <-session.closed; data != event.ErrServerShutdown {
+		t.Fatalf("close hook %v", data)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	s, sessions, _ := startServer(t, &internalSocket.InternalOption{
+		Heartbeat: &heartbeat.Option{PingTag: 100, Interval: 50 * time.Millisecond},
+	})
+	defer s.Stop()
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	session := <-sessions
+
+	// 回复pong之后服务器测量到往返时间，心跳消息不交给逻辑层
+	r := bufio.NewReader(client)
+	for i := 0; i < 3; i++ {
+		ping, err := codec.ReadPacket(codec.TLVCodec{}, r, 1<<16)
+		if err != nil || ping.Tag != 100 {
+			t.Fatalf("ping %v %v", ping, err)
+		}
+		msg, _ := codec.TLVCodec{}.Encode(101, ping.Payload)
+		client.Write(msg)
+	}
+	msg, _ := codec.TLVCodec{}.Encode(100, []byte("client ping"))
+	client.Write(msg)
+	for {
+		packet, err := codec.ReadPacket(codec.TLVCodec{}, r, 1<<16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.Tag == 101 && string(packet.Payload) == "client ping" {
+			break
+		}
+	}
+	if session.conn.GetRTT() <= 0 {
+		t.Fatalf("rtt %v", session.conn.GetRTT())
+	}
+
+	// 不再回复pong，连续3个ping没有回复踢出
+	select {
+	case reason := <-session.closed:
+		if reason != event.ErrHeartbeatTimeout {
+			t.Fatalf("kick reason %v", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session not kicked")
+	}
+}
+
+func TestShutdownDisconnect(t *testing.T) {
+	s, sessions, _ := startServer(t, &internalSocket.InternalOption{})
+	const n = 50
+	clients := make([]net.Conn, 0, n)
+	for i := 0; i < n; i++ {
+		client, err := net.Dial("tcp", s.listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients = append(clients, client)
+	}
+	list := make([]*echoSession, 0, n)
+	for i := 0; i < n; i++ {
+		list = append(list, <-sessions)
+	}
+
+	// 客户端断开和Shutdown同时进行，每个session只调用一次关闭钩子
+	for _, client := range clients {
+		go client.Close()
+	}
+	if err := s.Shutdown(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, session := range list {
+		select {
+		case <-session.closed:
+		case <-time.After(time.Second):
+			t.Fatal("session not closed")
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	for _, session := range list {
+		if len(session.closed) != 0 {
+			t.Fatalf("session closed twice: %v", <-session.closed)
+		}
+	}
+}
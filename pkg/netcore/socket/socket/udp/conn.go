@@ -0,0 +1,253 @@
+package udp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"joynova.com/library/supernova/pkg/jlog"
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
+	internalSocket "joynova.com/library/supernova/pkg/netcore/socket/socket"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+type clientConn struct {
+	id            int64
+	token         uint64
+	cookie        uint64 // 创建session的握手cookie
+	customSession internalSocket.InternalSession
+	recvQueue     chan *utils.TLVPacket // 读缓冲，满了丢包，不阻塞其他客户端
+	writeQueue    chan []byte           // 写缓冲
+	conn          *net.UDPConn          // 所有客户端共用的socket
+	addr          *net.UDPAddr
+	option        *internalSocket.InternalOption
+	lastRecv      int64 // 最后收包时间，UnixNano
+	isStop        int32
+	stopChan      chan struct{}
+	flushed       chan struct{}     // Shutdown时写缓冲发送完
+	heartbeat     *heartbeat.Keeper // 没有开启心跳时为空
+}
+
+func (c *clientConn) GetClientConnType() internalSocket.InternalClientConnType {
+	return internalSocket.InternalClientConnTypeUdp
+}
+
+func (c *clientConn) GetSessionID() int64 {
+	return c.id
+}
+
+func (c *clientConn) GetIP() string {
+	return c.addr.String()
+}
+
+func (c *clientConn) GetRTT() time.Duration {
+	return c.heartbeat.RTT()
+}
+
+func (c *clientConn) InitSession(op *internalSocket.InternalOption) {
+	c.option = op
+}
+
+// GetConn 返回所有客户端共用的socket，不能关闭或者设置超时
+func (c *clientConn) GetConn() net.Conn {
+	return c.conn
+}
+
+func (c *clientConn) WriteTLV(session internalSocket.InternalSession, tag uint32, payload []byte) (int, error) {
+	session.PreHandleNotify(tag, payload)
+	return c.writeTLV(tag, payload)
+}
+
+func (c *clientConn) writeTLV(tag uint32, payload []byte) (int, error) {
+	buf, err := c.encode(tag, payload)
+	if err != nil {
+		return 0, err
+	}
+	return c.write(buf)
+}
+
+// encode 编码后的消息前面加上token
+func (c *clientConn) encode(tag uint32, payload []byte) ([]byte, error) {
+	msg, err := c.option.GetCodec(codec.TLVCodec{}).Encode(tag, payload)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, tokenBytes+len(msg))
+	binary.BigEndian.PutUint64(buf, c.token)
+	copy(buf[tokenBytes:], msg)
+	return buf, nil
+}
+
+func (c *clientConn) write(buf []byte) (int, error) {
+	if atomic.LoadInt32(&c.isStop) == 1 {
+		return len(buf), nil
+	}
+
+	select {
+	case c.writeQueue <- buf:
+	case <-c.stopChan:
+	}
+	return len(buf), nil
+}
+
+// flush 等待写缓冲中已有的消息发送完，在写缓冲中放入nil作为标记
+func (c *clientConn) flush(ctx context.Context) error {
+	c.flushed = make(chan struct{})
+	select {
+	case c.writeQueue <- nil:
+	case <-c.stopChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-c.flushed:
+		return nil
+	case <-c.stopChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *clientConn) recv(packet *utils.TLVPacket) {
+	if atomic.LoadInt32(&c.isStop) == 1 {
+		return
+	}
+	atomic.StoreInt64(&c.lastRecv, time.Now().UnixNano())
+	if c.handleHeartbeatRecv(packet) {
+		return
+	}
+
+	select {
+	case c.recvQueue <- packet:
+	default:
+		jlog.Warnf("[net core]udp conn[%v] recv queue full, drop msg(%v)", c.id, packet.Tag)
+	}
+}
+
+func (c *clientConn) lastRecvTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastRecv))
+}
+
+// close 只停止这个客户端的收发，不关闭共用的socket
+func (c *clientConn) close() {
+	if !atomic.CompareAndSwapInt32(&c.isStop, 0, 1) {
+		return
+	}
+	close(c.stopChan)
+}
+
+// handleHeartbeatRecv 心跳消息在共用的读协程中直接回复，写缓冲满时丢弃回复，不阻塞其他客户端，返回是否为心跳消息
+func (conn *clientConn) handleHeartbeatRecv(packet *utils.TLVPacket) bool {
+	if conn.heartbeat == nil {
+		return false
+	}
+	reply, ok := conn.heartbeat.HandleRecv(packet)
+	if reply != nil {
+		buf, err := conn.encode(reply.Tag, reply.Payload)
+		if err != nil {
+			jlog.Warnf("[net core]udp conn[%v] write heartbeat(%v) error:%v", conn.id, reply.Tag, err)
+			return ok
+		}
+		select {
+		case conn.writeQueue <- buf:
+		default:
+			jlog.Warnf("[net core]udp conn[%v] write queue full, drop heartbeat(%v)", conn.id, reply.Tag)
+		}
+	}
+	return ok
+}
+
+// handleClientConnHeartbeat 按间隔发送ping，检测策略要求踢出时关闭session
+func (conn *clientConn) handleClientConnHeartbeat(server *server) {
+	if conn.heartbeat == nil {
+		return
+	}
+	conn.heartbeat.Run(conn.stopChan, func(ping *utils.TLVPacket) error {
+		_, err := conn.writeTLV(ping.Tag, ping.Payload)
+		return err
+	}, func(reason event.Error) {
+		server.closeSession(conn.GetSessionID(), reason)
+	})
+}
+
+func (conn *clientConn) handleClientConnDeliverRecvMsg(customSession internalSocket.InternalSession) {
+
+	for {
+		select {
+		case msg, ok := <-conn.recvQueue:
+			if !ok {
+				return
+			}
+			conn.handleRecvMsg(customSession, msg)
+		case <-conn.stopChan:
+			return
+		}
+	}
+}
+
+func (conn *clientConn) handleRecvMsg(customSession internalSocket.InternalSession, msg *utils.TLVPacket) {
+	defer jlog.CatchWithInfo(fmt.Sprintf("handle session(%v) receive msg(%v) panic", conn.GetSessionID(), msg.Tag))
+
+	res, data, err := customSession.PreHandleRequest(msg)
+	if err != nil {
+		return
+	}
+	if res != nil && res.Tag > 0 {
+		conn.writeTLV(res.Tag, res.Payload)
+		return
+	}
+
+	res, data, err = customSession.HandleRequest(msg, data)
+	if err != nil {
+		customSession.PostHandleResponse(msg, res, data, err)
+		return
+	}
+
+	if res == nil || res.Tag <= 0 {
+		return
+	}
+
+	customSession.PreHandleResponse(msg, res, data)
+
+	conn.writeTLV(res.Tag, res.Payload)
+
+	customSession.PostHandleResponse(msg, res, data, nil)
+}
+
+// handleClientConnWriteMsg 共用socket不设置写超时，WriteTimeout对udp无效
+func (conn *clientConn) handleClientConnWriteMsg(customSession internalSocket.InternalSession) {
+
+	for {
+		select {
+		case msg, ok := <-conn.writeQueue:
+			if !ok {
+				return
+			}
+
+			if atomic.LoadInt32(&conn.isStop) == 1 {
+				return
+			}
+
+			if msg == nil {
+				close(conn.flushed)
+				continue
+			}
+
+			customSession.PreWritePacket(msg)
+
+			_, err := conn.conn.WriteToUDP(msg, conn.addr)
+			if err != nil {
+				jlog.Errorf("[net core]conn[%v] write msg with len(%v) error:%v", conn.id, len(msg), err)
+			}
+		case <-conn.stopChan:
+			return
+		}
+	}
+}
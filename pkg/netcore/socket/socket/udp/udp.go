@@ -1,22 +1,72 @@
 package udp
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
 	"net"
+	"sync"
 	"time"
 
+	"joynova.com/library/supernova/pkg/jlog"
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
 	internalSocket "joynova.com/library/supernova/pkg/netcore/socket/socket"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
 )
 
+// 每个udp包是8字节大端的session token加上一个InternalOption.Codec编码的消息，默认为tlv。
+// 握手：
+//  1. 客户端发送token为0的包，服务器不创建session，只回复一个8字节cookie、没有消息的包
+//  2. 客户端用cookie作为token发送第一个消息，cookie校验通过才创建session，分配随机的session token
+//  3. 之后发给客户端的每个包都带上session token，客户端收到后改用这个token发包，session按地址+token区分
+//
+// cookie是服务器密钥对客户端地址和时间段的HMAC，不需要保存状态，伪造源地址的包收不到cookie，无法创建session。
+// 客户端确认token之前用同一个cookie重发的包都交给同一个session，避免重发握手包创建多个session。
+// udp没有断开，RecvTimeout内没有收到包的session按读超时关闭，RecvTimeout为0时使用defaultIdleTimeout
+
+const (
+	defaultIdleTimeout = time.Minute
+	tokenBytes         = 8
+	cookieWindow       = 10 * time.Second // cookie在当前和上一个时间段内有效
+)
+
+type peerKey struct {
+	addr  string
+	token uint64
+}
+
 type server struct {
-	addr string
-	net.Conn
-	maxRecvMsgBytes int
-	maxWriteTimeout time.Duration
+	addr           string
+	conn           *net.UDPConn
+	newSessionFunc func(conn internalSocket.InternalClientConn) internalSocket.InternalSession
+	sessionMgr     *sync.Map
+	option         *internalSocket.InternalOption
+	lock           sync.Mutex
+	peers          map[peerKey]*clientConn // 地址+token对应的连接，地址+cookie也指向同一个连接
+	secret         []byte                  // 计算cookie的密钥
+	draining       bool                    // Shutdown中，不再创建session
+	stopped        bool                    // 调用过Stop，socket关闭后Listen返回nil
 }
 
-func NewServer(addr string) *server {
+func NewServer(addr string, newSessionFunc func(conn internalSocket.InternalClientConn) internalSocket.InternalSession,
+	option *internalSocket.InternalOption) *server {
 	listener := &server{}
 	listener.addr = addr
+	listener.newSessionFunc = newSessionFunc
+	listener.sessionMgr = new(sync.Map)
+	if option == nil {
+		option = &internalSocket.InternalOption{}
+	}
+	listener.option = option
+	listener.peers = make(map[peerKey]*clientConn)
+	listener.secret = make([]byte, 32)
+	if _, err := rand.Read(listener.secret); err != nil {
+		panic(err)
+	}
 	return listener
 }
 
@@ -29,81 +79,295 @@ func (s *server) Listen() error {
 	if err != nil {
 		return err
 	}
+	s.lock.Lock()
+	if s.stopped {
+		s.lock.Unlock()
+		return conn.Close()
+	}
+	s.conn = conn
+	s.lock.Unlock()
 
-	s.Conn = conn
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	go s.handleIdle(stopChan)
 
+	var maxRecvBytes int = 1 << 16
+	if s.option.RecvMsgBytes > 0 {
+		maxRecvBytes = s.option.RecvMsgBytes
+	}
+	// 多一个字节判断超长被截断的包
+	buf := make([]byte, tokenBytes+maxRecvBytes+1)
 	for {
-		buf := make([]byte, s.maxRecvMsgBytes)
-		n, _, err := conn.ReadFromUDP(buf)
+		n, addr, err := conn.ReadFromUDP(buf)
 		if err != nil {
-			// todo log
+			if e, ok := err.(net.Error); ok && e.Temporary() {
+				continue
+			}
+			// socket关闭后所有session都无法再收包
+			s.lock.Lock()
+			stopped := s.stopped
+			s.lock.Unlock()
+			if stopped {
+				s.stopAll()
+				return nil
+			}
+			s.closeAll(event.Error(err))
 			return err
 		}
 
-		if n < 4 {
-			// todo log
+		if n < tokenBytes || n > tokenBytes+maxRecvBytes {
+			jlog.Warnf("[net core]udp read from %v error length:%v", addr, n)
+			continue
+		}
+		token := binary.BigEndian.Uint64(buf)
+		client := s.findClientConn(addr, token)
+		if client == nil {
+			continue
+		}
+		packet, err := client.option.GetCodec(codec.TLVCodec{}).Decode(buf[tokenBytes:n])
+		if err != nil {
+			jlog.Warnf("[net core]udp read from %v error:%v", addr, err)
 			continue
 		}
+		client.recv(packet)
+	}
+}
 
-		// tag := binary.LittleEndian.Uint32(buf)
-		// payload := buf[4:]
-		// client := s.newClientConn(conn, cAddr)
-		// e := event.NewRecvEvent(tag, payload)
-		// s.eventNotify(client)
+// findClientConn 找到包对应的连接，token为0时回复cookie，token为有效的cookie时创建新连接，其他包丢弃
+func (s *server) findClientConn(addr *net.UDPAddr, token uint64) *clientConn {
+	addrKey := addr.String()
+	s.lock.Lock()
+	client, find := s.peers[peerKey{addr: addrKey, token: token}]
+	draining := s.draining
+	s.lock.Unlock()
+	if find {
+		return client
+	}
+	if draining {
+		return nil
 	}
+	if token == 0 {
+		s.writeCookie(addr)
+		return nil
+	}
+	if !s.validCookie(addrKey, token) {
+		return nil
+	}
+
+	// 只有读协程创建连接，newSessionFunc在锁外调用
+	client = s.newClientConn(s.conn, addr, s.option)
+	client.cookie = token
+	client.customSession = s.newSessionFunc(client)
+	s.sessionMgr.Store(client.GetSessionID(), client.customSession)
+	s.lock.Lock()
+	s.peers[peerKey{addr: addrKey, token: client.token}] = client
+	s.peers[peerKey{addr: addrKey, token: client.cookie}] = client
+	s.lock.Unlock()
+	go client.handleClientConnDeliverRecvMsg(client.customSession)
+	go client.handleClientConnWriteMsg(client.customSession)
+	go client.handleClientConnHeartbeat(s)
+	return client
 }
 
-func (s *server) Stop() {
-	s.Close()
+// cookie 地址在某个时间段的cookie，不为0
+func (s *server) cookie(addrKey string, window int64) uint64 {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(addrKey))
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(window))
+	mac.Write(buf[:])
+	cookie := binary.BigEndian.Uint64(mac.Sum(nil))
+	if cookie == 0 {
+		cookie = 1
+	}
+	return cookie
 }
 
-type clientConn struct {
-	id              int64
-	conn            *net.UDPConn
-	addr            *net.UDPAddr
-	maxRecvMsgBytes int
-	maxRecvTimeout  time.Duration
-	maxWriteTimeout time.Duration
+func (s *server) validCookie(addrKey string, token uint64) bool {
+	window := time.Now().UnixNano() / int64(cookieWindow)
+	return token == s.cookie(addrKey, window) || token == s.cookie(addrKey, window-1)
 }
 
-func (c *clientConn) GetClientConnType() internalSocket.InternalClientConnType {
-	return internalSocket.InternalClientConnTypeWs
+// writeCookie 回复只有cookie的包，不比请求大，不会被用来放大流量
+func (s *server) writeCookie(addr *net.UDPAddr) {
+	buf := make([]byte, tokenBytes)
+	binary.BigEndian.PutUint64(buf, s.cookie(addr.String(), time.Now().UnixNano()/int64(cookieWindow)))
+	if _, err := s.conn.WriteToUDP(buf, addr); err != nil {
+		jlog.Warnf("[net core]udp write cookie to %v error:%v", addr, err)
+	}
 }
 
-func (c *clientConn) GetID() int64 {
-	return c.id
+func (s *server) removePeer(c *clientConn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	addrKey := c.addr.String()
+	delete(s.peers, peerKey{addr: addrKey, token: c.token})
+	delete(s.peers, peerKey{addr: addrKey, token: c.cookie})
 }
 
-func (c *clientConn) GetIP() string {
-	return c.addr.String()
+func (s *server) idleTimeout() time.Duration {
+	if s.option.RecvTimeout > 0 {
+		return s.option.RecvTimeout
+	}
+	return defaultIdleTimeout
 }
 
-func (c *clientConn) SetWriteTimeout(d time.Duration) {
-	c.maxWriteTimeout = d
+// handleIdle 定时关闭超时没有收到包的session
+func (s *server) handleIdle(stopChan chan struct{}) {
+	timeout := s.idleTimeout()
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			expired := make([]int64, 0)
+			s.lock.Lock()
+			for key, client := range s.peers {
+				if key.token == client.token && now.Sub(client.lastRecvTime()) > timeout {
+					expired = append(expired, client.GetSessionID())
+				}
+			}
+			s.lock.Unlock()
+			for _, id := range expired {
+				s.closeSession(id, event.ErrReadTimeout)
+			}
+		case <-stopChan:
+			return
+		}
+	}
 }
-func (c *clientConn) SetRecvTimeout(d time.Duration) {
-	c.maxRecvTimeout = d
+
+func (s *server) GetSession(id int64) (internalSocket.InternalSession, bool) {
+	value, find := s.sessionMgr.Load(id)
+	if find {
+		return value.(internalSocket.InternalSession), find
+	}
+	return nil, false
 }
-func (c *clientConn) SetRecvMsgBytes(n int) {
-	c.maxRecvMsgBytes = n
+
+// CloseSession 服务器主动关闭客户端，之后这个token的包被丢弃
+func (s *server) CloseSession(id int64, notify *utils.TLVPacket, delay time.Duration, data interface{}) bool {
+	// 先删除session，并发关闭时只有删除成功的一方调用钩子
+	sessionValue, find := s.sessionMgr.LoadAndDelete(id)
+	if !find {
+		return false
+	}
+
+	session, _ := sessionValue.(internalSocket.InternalSession)
+	client := session.GetClientConn().(*clientConn)
+	s.removePeer(client)
+	// 调用钩子
+	session.PreServerSideCloseSession(notify, data)
+
+	time.AfterFunc(delay, func() {
+		// 关闭链接
+		client.close()
+		// 调用钩子
+		session.ServerSideCloseSession(data)
+	})
+
+	return true
 }
 
-func (c *clientConn) Write(msg []byte) (int, error) {
-	return c.conn.WriteToUDP(msg, c.addr)
+// closeSession 客户端超时或者socket出错
+func (s *server) closeSession(id int64, err event.Error) {
+	// 先删除session，并发关闭时只有删除成功的一方调用钩子
+	sessionValue, find := s.sessionMgr.LoadAndDelete(id)
+	if !find {
+		return
+	}
+	session, _ := sessionValue.(internalSocket.InternalSession)
+	client := session.GetClientConn().(*clientConn)
+	s.removePeer(client)
+	// 调用钩子
+	session.ClientSideCloseSession(err)
+	// 关闭链接
+	client.close()
 }
 
-func (c *clientConn) WriteTLV(tag uint32, payload []byte) (int, error) {
-	return 0, nil
+// sessionIDs 所有session的id，地址+cookie的别名不重复计入
+func (s *server) sessionIDs() []int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ids := make([]int64, 0, len(s.peers))
+	for key, client := range s.peers {
+		if key.token == client.token {
+			ids = append(ids, client.GetSessionID())
+		}
+	}
+	return ids
 }
 
-func (c *clientConn) Close() {
-	c.conn.Close()
+// closeAll socket出错，所有session按客户端关闭处理
+func (s *server) closeAll(err event.Error) {
+	for _, id := range s.sessionIDs() {
+		s.closeSession(id, err)
+	}
 }
 
-func (s *server) newClientConn(conn *net.UDPConn, addr *net.UDPAddr) *clientConn {
+// stopAll Stop关闭了socket，所有session按服务器关闭处理，钩子的参数为event.ErrServerShutdown
+func (s *server) stopAll() {
+	for _, id := range s.sessionIDs() {
+		sessionValue, find := s.sessionMgr.LoadAndDelete(id)
+		if !find {
+			continue
+		}
+		session, _ := sessionValue.(internalSocket.InternalSession)
+		client := session.GetClientConn().(*clientConn)
+		s.removePeer(client)
+		client.close()
+		session.ServerSideCloseSession(event.ErrServerShutdown)
+	}
+}
+
+// Stop 关闭socket，剩下的session调用ServerSideCloseSession关闭，参数为event.ErrServerShutdown，Listen返回nil
+func (s *server) Stop() {
+	s.lock.Lock()
+	s.stopped = true
+	conn := s.conn
+	s.lock.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// Shutdown 不再创建session，向所有session发送notify，发送完写缓冲后关闭，最后关闭socket
+func (s *server) Shutdown(ctx context.Context, notify *utils.TLVPacket) error {
+	s.lock.Lock()
+	s.draining = true
+	s.lock.Unlock()
+	err := internalSocket.ShutdownSessions(ctx, s.sessionMgr, notify,
+		func(ctx context.Context, session internalSocket.InternalSession) error {
+			return session.GetClientConn().(*clientConn).flush(ctx)
+		},
+		func(session internalSocket.InternalSession) {
+			client := session.GetClientConn().(*clientConn)
+			s.removePeer(client)
+			client.close()
+		})
+	s.Stop()
+	return err
+}
+
+func (s *server) newClientConn(conn *net.UDPConn, addr *net.UDPAddr, option *internalSocket.InternalOption) *clientConn {
 	c := &clientConn{}
 	c.id = internalSocket.GetID()
+	// token是区分session的唯一凭证，不能被猜到
+	var buf [8]byte
+	for c.token == 0 {
+		if _, err := rand.Read(buf[:]); err != nil {
+			panic(err)
+		}
+		c.token = binary.BigEndian.Uint64(buf[:])
+	}
 	c.conn = conn
 	c.addr = addr
+	c.recvQueue = make(chan *utils.TLVPacket, 20)
+	c.writeQueue = make(chan []byte, 20)
+	c.stopChan = make(chan struct{}, 0)
+	c.option = option
+	c.heartbeat = heartbeat.NewKeeper(option.Heartbeat, true)
+	c.lastRecv = time.Now().UnixNano()
 	return c
 }
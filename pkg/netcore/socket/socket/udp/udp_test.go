@@ -0,0 +1,224 @@
+package udp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	internalSocket "joynova.com/library/supernova/pkg/netcore/socket/socket"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+func packDatagram(token uint64, tag uint32, payload []byte) []byte {
+	msg, _ := codec.TLVCodec{}.Encode(tag, payload)
+	buf := make([]byte, tokenBytes, tokenBytes+len(msg))
+	binary.BigEndian.PutUint64(buf, token)
+	return append(buf, msg...)
+}
+
+func readDatagram(buf []byte) (uint64, *utils.TLVPacket, error) {
+	packet, err := codec.TLVCodec{}.Decode(buf[tokenBytes:])
+	return binary.BigEndian.Uint64(buf), packet, err
+}
+
+type echoSession struct {
+	conn   internalSocket.InternalClientConn
+	closed chan interface{}
+}
+
+func (s *echoSession) GetClientConn() internalSocket.InternalClientConn { return s.conn }
+func (s *echoSession) PreHandleRequest(*utils.TLVPacket) (*utils.TLVPacket, interface{}, error) {
+	return nil, nil, nil
+}
+func (s *echoSession) HandleRequest(request *utils.TLVPacket, _ interface{}) (*utils.TLVPacket, interface{}, error) {
+	return &utils.TLVPacket{Tag: request.Tag + 1, Payload: request.Payload}, nil, nil
+}
+func (s *echoSession) PreHandleResponse(*utils.TLVPacket, *utils.TLVPacket, interface{}) error {
+	return nil
+}
+func (s *echoSession) PostHandleResponse(*utils.TLVPacket, *utils.TLVPacket, interface{}, error) {}
+func (s *echoSession) PreHandleNotify(uint32, []byte)                                            {}
+func (s *echoSession) PreWritePacket([]byte)                                                     {}
+func (s *echoSession) PreServerSideCloseSession(*utils.TLVPacket, interface{})                   {}
+func (s *echoSession) ServerSideCloseSession(data interface{})                                   { s.closed <- data }
+func (s *echoSession) ClientSideCloseSession(err event.Error)                                    { s.closed <- err }
+
+func startServer(t *testing.T, option *internalSocket.InternalOption) (*server, chan *echoSession, chan error, *net.UDPAddr) {
+	sessions := make(chan *echoSession, 10)
+	s := NewServer("127.0.0.1:0", func(conn internalSocket.InternalClientConn) internalSocket.InternalSession {
+		session := &echoSession{conn: conn, closed: make(chan interface{}, 1)}
+		sessions <- session
+		return session
+	}, option)
+	listenErr := make(chan error, 1)
+	go func() { listenErr <- s.Listen() }()
+	for i := 0; i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		s.lock.Lock()
+		conn := s.conn
+		s.lock.Unlock()
+		if conn != nil {
+			return s, sessions, listenErr, conn.LocalAddr().(*net.UDPAddr)
+		}
+	}
+	t.Fatal("server not listening")
+	return nil, nil, nil, nil
+}
+
+func TestServer(t *testing.T) {
+	s, sessions, listenErr, serverAddr := startServer(t, &internalSocket.InternalOption{RecvTimeout: 200 * time.Millisecond})
+	client, err := net.DialUDP("udp", nil, serverAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	buf := make([]byte, 1<<16)
+	request := func(token uint64, tag uint32, payload string) (uint64, *utils.TLVPacket) {
+		if _, err := client.Write(packDatagram(token, tag, []byte(payload))); err != nil {
+			t.Fatal(err)
+		}
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, packet, err := readDatagram(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token, packet
+	}
+
+	// token为0的包只回复cookie，不创建session
+	if _, err := client.Write(packDatagram(0, 1, []byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := client.Read(buf)
+	if err != nil || n != tokenBytes {
+		t.Fatalf("cookie length:%v err:%v", n, err)
+	}
+	cookie := binary.BigEndian.Uint64(buf)
+	if cookie == 0 || len(sessions) != 0 {
+		t.Fatalf("cookie %v sessions %v", cookie, len(sessions))
+	}
+	if s.validCookie("127.0.0.1:1", cookie) {
+		t.Fatal("cookie valid for another address")
+	}
+	// 错误的cookie丢弃
+	client.Write(packDatagram(cookie+1, 1, nil))
+	client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := client.Read(buf); err == nil || len(sessions) != 0 {
+		t.Fatal("invalid cookie created session")
+	}
+
+	// 带cookie的包创建session并分配token，确认前重发不创建新session
+	token, packet := request(cookie, 1, "hello")
+	if token == 0 || token == cookie || packet.Tag != 2 || string(packet.Payload) != "hello" {
+		t.Fatalf("handshake response token:%v tag:%v payload:%s", token, packet.Tag, packet.Payload)
+	}
+	if again, _ := request(cookie, 1, "hello"); again != token {
+		t.Fatalf("resend handshake token %v, want %v", again, token)
+	}
+	if again, packet := request(token, 3, "next"); again != token || packet.Tag != 4 {
+		t.Fatalf("request token:%v tag:%v", again, packet.Tag)
+	}
+	session := <-sessions
+	if len(sessions) != 0 {
+		t.Fatalf("created %v sessions", len(sessions)+1)
+	}
+	if _, find := s.GetSession(session.conn.GetSessionID()); !find {
+		t.Fatal("session not found")
+	}
+	if session.conn.GetClientConnType() != internalSocket.InternalClientConnTypeUdp {
+		t.Fatal("wrong conn type")
+	}
+
+	// 服务器主动推送
+	if _, err := session.conn.WriteTLV(session, 9, []byte("notify")); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err = client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notifyToken, notify, err := readDatagram(buf[:n]); err != nil || notifyToken != token || notify.Tag != 9 {
+		t.Fatalf("notify token:%v packet:%v err:%v", notifyToken, notify, err)
+	}
+
+	// 错误的token被丢弃
+	client.Write(packDatagram(token+1, 1, nil))
+	client.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := client.Read(buf); err == nil {
+		t.Fatal("unknown token got response")
+	}
+
+	// 空闲超时
+	select {
+	case err := <-session.closed:
+		if err != event.ErrReadTimeout {
+			t.Fatalf("close error %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle session not closed")
+	}
+	if _, find := s.GetSession(session.conn.GetSessionID()); find {
+		t.Fatal("idle session still exists")
+	}
+
+	s.Stop()
+	select {
+	case <-listenErr:
+	case <-time.After(time.Second):
+		t.Fatal("listen not stopped")
+	}
+}
+
+func TestStop(t *testing.T) {
+	s, sessions, listenErr, serverAddr := startServer(t, &internalSocket.InternalOption{})
+	client, err := net.DialUDP("udp", nil, serverAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	buf := make([]byte, 1<<16)
+	client.Write(packDatagram(0, 1, nil))
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := client.Read(buf); err != nil || n != tokenBytes {
+		t.Fatalf("cookie length:%v err:%v", n, err)
+	}
+	client.Write(packDatagram(binary.BigEndian.Uint64(buf), 1, []byte("hello")))
+	session := <-sessions
+
+	// Stop按服务器关闭处理剩下的session，Listen返回nil
+	s.Stop()
+	select {
+	case err := <-listenErr:
+		if err != nil {
+			t.Fatalf("listen error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listen not stopped")
+	}
+	select {
+	case reason := <-session.closed:
+		if reason != event.ErrServerShutdown {
+			t.Fatalf("close reason %v", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session not closed")
+	}
+	if _, find := s.GetSession(session.conn.GetSessionID()); find {
+		t.Fatal("stopped session still exists")
+	}
+
+	// Stop之后Listen直接返回
+	if err := s.Listen(); err != nil {
+		t.Fatalf("listen after stop %v", err)
+	}
+}
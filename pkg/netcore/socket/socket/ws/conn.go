@@ -2,24 +2,34 @@ package ws
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
 	"fmt"
 	"net"
-	"strconv"
 	"sync/atomic"
+	"time"
 
-	"golang.org/x/net/websocket"
+	"joynova.com/library/supernova/pkg/jlog"
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
 	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
 	internalSocket "joynova.com/library/supernova/pkg/netcore/socket/socket"
 	"joynova.com/library/supernova/pkg/netcore/socket/utils"
 )
 
 type clientConn struct {
-	id       int64
-	conn     *websocket.Conn
-	inStream *bufio.Reader
-	option   *internalSocket.InternalOption
-	isStop   int32
+	id            int64
+	customSession internalSocket.InternalSession
+	recvQueue     chan *utils.TLVPacket // 读缓冲，避免逻辑层处理慢时读不到pong
+	writeQueue    chan []byte           // 写缓冲
+	conn          net.Conn
+	ws            *wsConn
+	subprotocol   string
+	option        *internalSocket.InternalOption
+	pingInterval  time.Duration
+	isStop        int32
+	stopChan      chan struct{}
+	flushed       chan struct{}     // Shutdown时写缓冲发送完
+	heartbeat     *heartbeat.Keeper // 没有开启心跳时为空
 }
 
 func (c *clientConn) GetClientConnType() internalSocket.InternalClientConnType {
@@ -31,129 +41,267 @@ func (c *clientConn) GetSessionID() int64 {
 }
 
 func (c *clientConn) GetIP() string {
-	return c.conn.LocalAddr().String()
+	return c.conn.RemoteAddr().String()
 }
 
+func (c *clientConn) GetRTT() time.Duration {
+	return c.heartbeat.RTT()
+}
+
+// GetConn 返回底层tcp连接，不能直接读写
 func (c *clientConn) GetConn() net.Conn {
 	return c.conn
 }
 
+// GetSubprotocol 握手时协商的子协议，没有时为空
+func (c *clientConn) GetSubprotocol() string {
+	return c.subprotocol
+}
+
 func (c *clientConn) InitSession(op *internalSocket.InternalOption) {
 	c.option = op
+	c.ws.writeLock.Lock()
+	c.ws.writeTimeout = op.WriteTimeout
+	c.ws.writeLock.Unlock()
 }
 
 func (c *clientConn) WriteTLV(session internalSocket.InternalSession, tag uint32, payload []byte) (int, error) {
 	session.PreHandleNotify(tag, payload)
-	return c.writeTLV(session, tag, payload)
+	return c.writeTLV(tag, payload)
 }
 
-func (c *clientConn) writeTLV(session internalSocket.InternalSession, tag uint32, payload []byte) (int, error) {
-	res := make(map[string]interface{})
-	err := json.Unmarshal(payload, &res)
+func (c *clientConn) writeTLV(tag uint32, payload []byte) (int, error) {
+	buf, err := c.option.GetCodec(codec.JSONCodec{}).Encode(tag, payload)
 	if err != nil {
-		return 0, fmt.Errorf("json unmarshal error:%v", err)
-		// fmt.Printf("unmarshal error:%v,%v\n", string(payload), err)
-	}
-	buf := map[string]interface{}{
-		"msg_id":  tag,
-		"payload": res,
+		return 0, err
 	}
-	sendMsg, err := json.Marshal(&buf)
-	if err != nil {
-		return 0, fmt.Errorf("json marshal error:%v", err)
+	return c.write(buf)
+}
+
+func (c *clientConn) write(buf []byte) (int, error) {
+	if atomic.LoadInt32(&c.isStop) == 1 {
+		return len(buf), nil
 	}
 
-	return c.write(session, sendMsg)
+	select {
+	case c.writeQueue <- buf:
+	case <-c.stopChan:
+	}
+	return len(buf), nil
 }
 
-func (c *clientConn) write(session internalSocket.InternalSession, buf []byte) (int, error) {
-	session.PreWritePacket(buf)
-	return c.conn.Write(buf)
+// flush 等待写缓冲中已有的消息发送完，在写缓冲中放入nil作为标记
+func (c *clientConn) flush(ctx context.Context) error {
+	c.flushed = make(chan struct{})
+	select {
+	case c.writeQueue <- nil:
+	case <-c.stopChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-c.flushed:
+		return nil
+	case <-c.stopChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (c *clientConn) close() {
-	if atomic.LoadInt32(&c.isStop) == 1 {
+	c.closeWith(CloseNormal)
+}
+
+// closeWith 发送关闭帧后关闭连接
+func (c *clientConn) closeWith(code int) {
+	if !atomic.CompareAndSwapInt32(&c.isStop, 0, 1) {
 		return
 	}
-	atomic.StoreInt32(&c.isStop, 1)
+	close(c.stopChan)
+	// 对方不读取时写协程阻塞在写锁中，设置超时让它返回
+	c.conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+	c.ws.writeClose(code, "")
 	c.conn.Close()
 }
 
-func (s *Server) newClientConn(conn *websocket.Conn, option *internalSocket.InternalOption) *clientConn {
+func (s *Server) newClientConn(conn net.Conn, br *bufio.Reader, subprotocol string, compress bool,
+	option *internalSocket.InternalOption) *clientConn {
 	c := &clientConn{}
 	c.id = internalSocket.GetID()
 	c.conn = conn
-	c.inStream = bufio.NewReader(conn)
+	c.ws = newWsConn(conn, br, true)
+	c.ws.compress = compress
+	c.ws.writeTimeout = option.WriteTimeout
+	c.subprotocol = subprotocol
+	c.recvQueue = make(chan *utils.TLVPacket, 20)
+	c.writeQueue = make(chan []byte, 20)
+	c.stopChan = make(chan struct{}, 0)
 	c.option = option
+	c.heartbeat = heartbeat.NewKeeper(option.Heartbeat, true)
+	c.pingInterval = s.wsOption.PingInterval
+	if c.pingInterval <= 0 {
+		c.pingInterval = option.RecvTimeout / 2
+	}
 	return c
 }
 
-func (c *clientConn) handleClientConnRead(server *Server, session internalSocket.InternalSession) {
-OUT:
+func (conn *clientConn) handleClientConnRead(server *Server, customSession internalSocket.InternalSession) {
 	for {
-		var wsMsg string
-		err := websocket.Message.Receive(c.conn, &wsMsg)
+		setOption := conn.option
+		// ping间隔小于RecvTimeout，客户端正常时每个间隔都会收到pong
+		conn.ws.readTimeout = setOption.RecvTimeout
+		conn.ws.readLimit = 1 << 16
+		if setOption.RecvMsgBytes > 0 {
+			conn.ws.readLimit = setOption.RecvMsgBytes
+		}
+
+		_, msg, err := conn.ws.readMessage()
 		if err != nil {
-			// 服务器主动掐段
-			if atomic.LoadInt32(&c.isStop) == 1 {
+			if atomic.LoadInt32(&conn.isStop) == 1 {
+				break
+			}
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				// 客户端心跳超时
+				server.closeSession(conn.GetSessionID(), event.ErrReadTimeout)
 				break
 			}
 
-			server.closeSession(c.GetSessionID(), event.Error(err))
+			// 客户端关闭或者遇到其它错误
+			server.closeSession(conn.GetSessionID(), event.Error(err))
 			break
 		}
 
-		req := make(map[string]string)
-		err = json.Unmarshal([]byte(wsMsg), &req)
+		packet, err := setOption.GetCodec(codec.JSONCodec{}).Decode(msg)
 		if err != nil {
-			err = fmt.Errorf("unmarshal request message error:%v", err)
-			c.conn.Write([]byte(err.Error()))
+			jlog.Warnf("[net core]ws conn[%v] decode msg error:%v", conn.id, err)
 			continue
 		}
-		msgID, find := req["msg_id"]
-		if !find {
-			err = fmt.Errorf("not found msg id:%v", wsMsg)
-			c.conn.Write([]byte(err.Error()))
+
+		if conn.handleHeartbeatRecv(packet) {
 			continue
 		}
 
-		tag, err := strconv.Atoi(msgID)
-		if err != nil {
-			err = fmt.Errorf("msg id is not integer:%v", wsMsg)
-			c.conn.Write([]byte(err.Error()))
-			continue
+		select {
+		case conn.recvQueue <- packet:
+		case <-conn.stopChan:
+			return
 		}
+	}
+}
 
-		payload, find := req["payload"]
-		if !find {
-			err = fmt.Errorf("not found msg:%v", wsMsg)
-			c.conn.Write([]byte(err.Error()))
-			continue
+// handleHeartbeatRecv 心跳消息在读协程中直接回复，不进入读缓冲，返回是否为心跳消息
+func (conn *clientConn) handleHeartbeatRecv(packet *utils.TLVPacket) bool {
+	if conn.heartbeat == nil {
+		return false
+	}
+	reply, ok := conn.heartbeat.HandleRecv(packet)
+	if reply != nil {
+		if _, err := conn.writeTLV(reply.Tag, reply.Payload); err != nil {
+			jlog.Warnf("[net core]conn[%v] write heartbeat(%v) error:%v", conn.id, reply.Tag, err)
 		}
+	}
+	return ok
+}
 
-		requestTlv := &utils.TLVPacket{Tag: uint32(tag), Payload: []byte(payload)}
+// handleClientConnHeartbeat 按间隔发送ping，检测策略要求踢出时关闭session
+func (conn *clientConn) handleClientConnHeartbeat(server *Server) {
+	if conn.heartbeat == nil {
+		return
+	}
+	conn.heartbeat.Run(conn.stopChan, func(ping *utils.TLVPacket) error {
+		_, err := conn.writeTLV(ping.Tag, ping.Payload)
+		return err
+	}, func(reason event.Error) {
+		server.closeSession(conn.GetSessionID(), reason)
+	})
+}
 
-		res, data, err := session.PreHandleRequest(requestTlv)
-		if err != nil {
-			continue OUT
-		}
-		if res != nil && res.Tag > 0 {
-			c.writeTLV(session, res.Tag, res.Payload)
-			continue OUT
-		}
+func (conn *clientConn) handleClientConnDeliverRecvMsg(customSession internalSocket.InternalSession) {
 
-		res, data, err = session.HandleRequest(requestTlv, data)
-		if err != nil {
-			session.PostHandleResponse(requestTlv, res, data, err)
-			continue OUT
+	for {
+		select {
+		case msg, ok := <-conn.recvQueue:
+			if !ok {
+				return
+			}
+			conn.handleRecvMsg(customSession, msg)
+		case <-conn.stopChan:
+			return
 		}
+	}
+}
 
-		if res == nil || res.Tag <= 0 {
-			continue OUT
-		}
+func (conn *clientConn) handleRecvMsg(customSession internalSocket.InternalSession, msg *utils.TLVPacket) {
+	defer jlog.CatchWithInfo(fmt.Sprintf("handle session(%v) receive msg(%v) panic", conn.GetSessionID(), msg.Tag))
+
+	res, data, err := customSession.PreHandleRequest(msg)
+	if err != nil {
+		return
+	}
+	if res != nil && res.Tag > 0 {
+		conn.writeTLV(res.Tag, res.Payload)
+		return
+	}
+
+	res, data, err = customSession.HandleRequest(msg, data)
+	if err != nil {
+		customSession.PostHandleResponse(msg, res, data, err)
+		return
+	}
+
+	if res == nil || res.Tag <= 0 {
+		return
+	}
 
-		session.PreHandleResponse(requestTlv, res, data)
-		_, err = c.writeTLV(session, res.Tag, res.Payload)
-		session.PostHandleResponse(requestTlv, res, data, err)
+	customSession.PreHandleResponse(msg, res, data)
+
+	_, err = conn.writeTLV(res.Tag, res.Payload)
+
+	customSession.PostHandleResponse(msg, res, data, err)
+}
+
+// handleClientConnWriteMsg 发送写缓冲中的消息，文本编解码用文本帧，其他用二进制帧，并定时发送ping
+func (conn *clientConn) handleClientConnWriteMsg(customSession internalSocket.InternalSession) {
+	var pingChan <-chan time.Time
+	if conn.pingInterval > 0 {
+		ticker := time.NewTicker(conn.pingInterval)
+		defer ticker.Stop()
+		pingChan = ticker.C
+	}
+
+	for {
+		select {
+		case msg, ok := <-conn.writeQueue:
+			if !ok {
+				return
+			}
+
+			if atomic.LoadInt32(&conn.isStop) == 1 {
+				return
+			}
+
+			if msg == nil {
+				close(conn.flushed)
+				continue
+			}
+
+			customSession.PreWritePacket(msg)
+
+			op := opBinary
+			if codec.IsText(conn.option.GetCodec(codec.JSONCodec{})) {
+				op = opText
+			}
+			if err := conn.ws.writeMessage(op, msg); err != nil {
+				jlog.Errorf("[net core]conn[%v] write msg with len(%v) error:%v", conn.id, len(msg), err)
+			}
+		case <-pingChan:
+			if err := conn.ws.writeFrame(opPing, nil, false); err != nil {
+				jlog.Errorf("[net core]conn[%v] write ping error:%v", conn.id, err)
+			}
+		case <-conn.stopChan:
+			return
+		}
 	}
 }
@@ -0,0 +1,380 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// RFC 6455帧格式：
+//
+//	|FIN|RSV1|RSV2|RSV3|opcode(4)|MASK|len(7)|ext len(0/2/8)|mask key(0/4)|payload|
+//
+// 服务器读取的帧必须带掩码，写出的帧不带掩码；RSV1表示消息用permessage-deflate(RFC 7692)压缩
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const (
+	finalBit = 0x80
+	rsv1Bit  = 0x40
+	rsv2Bit  = 0x20
+	rsv3Bit  = 0x10
+	maskBit  = 0x80
+
+	maxControlPayload = 125
+	compressThreshold = 128 // 小于这个字节数的消息不压缩
+	closeWriteTimeout = time.Second
+)
+
+// 关闭码
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+// CloseError 收到客户端的关闭帧，或者客户端违反协议被关闭
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket close %v %v", e.Code, e.Text)
+}
+
+var errWriteClosed = errors.New("websocket close frame already sent")
+
+// deflateTail 压缩消息去掉的同步标记，加上一个空的最终块让解压正常结束
+const deflateTail = "\x00\x00\xff\xff\x01\x00\x00\xff\xff"
+
+var flateWriterPool = sync.Pool{New: func() interface{} {
+	w, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return w
+}}
+
+var flateReaderPool = sync.Pool{New: func() interface{} {
+	return flate.NewReader(nil)
+}}
+
+// wsConn 一个websocket连接的帧读写，读只在一个协程中进行，写加锁
+type wsConn struct {
+	conn         net.Conn
+	br           *bufio.Reader
+	isServer     bool // 服务器端：读取的帧必须带掩码，写出的帧不带掩码
+	compress     bool // 协商了permessage-deflate，双方都不保留上下文
+	readLimit    int  // 一个消息解压后的最大字节数
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	writeLock    sync.Mutex
+	closeSent    bool
+}
+
+func newWsConn(conn net.Conn, br *bufio.Reader, isServer bool) *wsConn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	return &wsConn{conn: conn, br: br, isServer: isServer, readLimit: 1 << 16}
+}
+
+// readMessage 读取一个完整的数据消息，ping、pong、关闭帧在读取过程中处理，
+// 收到关闭帧或者协议错误时返回*CloseError
+func (c *wsConn) readMessage() (int, []byte, error) {
+	var (
+		op         int
+		compressed bool
+		message    []byte
+		started    bool
+	)
+	for {
+		frameOp, fin, rsv1, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOp {
+		case opPing:
+			if err := c.writeFrame(opPong, payload, false); err != nil && err != errWriteClosed {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.handleClose(payload)
+		case opText, opBinary:
+			if started {
+				return 0, nil, c.fail(CloseProtocolError, "new message before previous finished")
+			}
+			started, op, compressed = true, frameOp, rsv1
+		case opContinuation:
+			if !started {
+				return 0, nil, c.fail(CloseProtocolError, "continuation without message")
+			}
+			if rsv1 {
+				return 0, nil, c.fail(CloseProtocolError, "rsv1 on continuation frame")
+			}
+		}
+
+		if len(message)+len(payload) > c.readLimit {
+			return 0, nil, c.fail(CloseMessageTooBig, fmt.Sprintf("message reach max length:%v", c.readLimit))
+		}
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+
+		if compressed {
+			if message, err = decompressMessage(message, c.readLimit); err != nil {
+				if err == errMessageTooBig {
+					return 0, nil, c.fail(CloseMessageTooBig, fmt.Sprintf("message reach max length:%v", c.readLimit))
+				}
+				return 0, nil, c.fail(CloseInvalidPayload, err.Error())
+			}
+		}
+		if op == opText && !utf8.Valid(message) {
+			return 0, nil, c.fail(CloseInvalidPayload, "invalid utf8 text")
+		}
+		return op, message, nil
+	}
+}
+
+// readFrame 读取一帧并去掉掩码，校验帧头
+func (c *wsConn) readFrame() (op int, fin bool, rsv1 bool, payload []byte, err error) {
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	var head [2]byte
+	if _, err = io.ReadFull(c.br, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&finalBit != 0
+	rsv1 = head[0]&rsv1Bit != 0
+	op = int(head[0] & 0x0f)
+	masked := head[1]&maskBit != 0
+	length := uint64(head[1] & 0x7f)
+
+	switch {
+	case head[0]&(rsv2Bit|rsv3Bit) != 0:
+		err = c.fail(CloseProtocolError, "unexpected rsv bits")
+	case rsv1 && (!c.compress || op >= opClose):
+		err = c.fail(CloseProtocolError, "unexpected rsv1 bit")
+	case op > opBinary && op != opClose && op != opPing && op != opPong:
+		err = c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode:%v", op))
+	case op >= opClose && (!fin || length > maxControlPayload):
+		err = c.fail(CloseProtocolError, "invalid control frame")
+	case masked != c.isServer:
+		err = c.fail(CloseProtocolError, "invalid frame mask")
+	}
+	if err != nil {
+		return
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > uint64(c.readLimit) {
+		err = c.fail(CloseMessageTooBig, fmt.Sprintf("frame reach max length:%v/%v", length, c.readLimit))
+		return
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return
+}
+
+// handleClose 回复关闭帧，返回客户端的关闭码
+func (c *wsConn) handleClose(payload []byte) error {
+	e := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		e.Code = int(binary.BigEndian.Uint16(payload))
+		e.Text = string(payload[2:])
+		if !validCloseCode(e.Code) || !utf8.ValidString(e.Text) {
+			return c.fail(CloseProtocolError, "invalid close payload")
+		}
+	}
+	code := e.Code
+	if code == CloseNoStatus {
+		code = CloseNormal
+	}
+	c.writeClose(code, "")
+	return e
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code < 1000 || code > 1011:
+		return false
+	}
+	return code != 1004 && code != CloseNoStatus && code != 1006
+}
+
+// fail 因为协议错误发送关闭帧，返回对应的错误
+func (c *wsConn) fail(code int, text string) error {
+	c.writeClose(code, text)
+	return &CloseError{Code: code, Text: text}
+}
+
+// writeClose 发送关闭帧，只发送一次
+func (c *wsConn) writeClose(code int, text string) error {
+	if len(text) > maxControlPayload-2 {
+		text = text[:maxControlPayload-2]
+	}
+	payload := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], text)
+	return c.writeFrame(opClose, payload, false)
+}
+
+// writeMessage 发送一个数据消息，不分片，开启压缩时较大的消息压缩发送
+func (c *wsConn) writeMessage(op int, data []byte) error {
+	compressed := false
+	if c.compress && len(data) >= compressThreshold {
+		buf, err := compressMessage(data)
+		if err != nil {
+			return err
+		}
+		data, compressed = buf, true
+	}
+	return c.writeFrame(op, data, compressed)
+}
+
+func (c *wsConn) writeFrame(op int, payload []byte, compressed bool) error {
+	head := make([]byte, 0, 14+len(payload))
+	b0 := byte(op) | finalBit
+	if compressed {
+		b0 |= rsv1Bit
+	}
+	head = append(head, b0)
+
+	var b1 byte
+	if !c.isServer {
+		b1 = maskBit
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		head = append(head, b1|byte(n))
+	case n <= 0xffff:
+		head = append(head, b1|126, byte(n>>8), byte(n))
+	default:
+		head = append(head, b1|127)
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		head = append(head, ext[:]...)
+	}
+
+	frame := head
+	if c.isServer {
+		frame = append(frame, payload...)
+	} else {
+		var mask [4]byte
+		binary.BigEndian.PutUint32(mask[:], rand.Uint32())
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(mask, frame[start:])
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if c.closeSent {
+		return errWriteClosed
+	}
+	if op == opClose {
+		c.closeSent = true
+		c.conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+	} else if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i&3]
+	}
+}
+
+func compressMessage(data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(w)
+	w.Reset(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	// 去掉Flush产生的同步标记
+	return bytes.TrimSuffix(buf.Bytes(), []byte(deflateTail[:4])), nil
+}
+
+var errMessageTooBig = errors.New("message too big")
+
+func decompressMessage(data []byte, limit int) ([]byte, error) {
+	r := flateReaderPool.Get().(io.ReadCloser)
+	defer flateReaderPool.Put(r)
+	if err := r.(flate.Resetter).Reset(io.MultiReader(bytes.NewReader(data), strings.NewReader(deflateTail)), nil); err != nil {
+		return nil, err
+	}
+	message, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompress message error:%v", err)
+	}
+	if len(message) > limit {
+		return nil, errMessageTooBig
+	}
+	return message, nil
+}
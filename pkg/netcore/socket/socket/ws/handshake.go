@@ -0,0 +1,149 @@
+package ws
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Option websocket相关的配置
+type Option struct {
+	Path              string                     // 升级websocket的路径，默认/ws
+	Subprotocols      []string                   // 服务器支持的子协议，按优先级排列，客户端都不支持时不选择子协议
+	CheckOrigin       func(r *http.Request) bool // 校验Origin，为空时不校验
+	EnableCompression bool                       // 客户端支持时协商permessage-deflate
+	PingInterval      time.Duration              // 发送ping的间隔，默认RecvTimeout/2，都为0时不发送
+}
+
+// upgrade 校验升级请求并回复101，返回底层连接和协商结果
+func (op *Option) upgrade(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.Reader, string, bool, error) {
+	if r.Method != http.MethodGet {
+		return nil, nil, "", false, httpError(w, http.StatusMethodNotAllowed, "websocket method must be GET")
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, nil, "", false, httpError(w, http.StatusBadRequest, "not websocket upgrade request")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, nil, "", false, httpError(w, http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-Websocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, nil, "", false, httpError(w, http.StatusBadRequest, "invalid websocket key")
+	}
+	if op.CheckOrigin != nil && !op.CheckOrigin(r) {
+		return nil, nil, "", false, httpError(w, http.StatusForbidden, "websocket origin not allowed")
+	}
+
+	subprotocol := op.selectSubprotocol(r)
+	compress := op.EnableCompression && acceptDeflate(r.Header)
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, "", false, httpError(w, http.StatusInternalServerError, "websocket response can not hijack")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, "", false, fmt.Errorf("websocket hijack error:%v", err)
+	}
+	b := new(strings.Builder)
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	if subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if compress {
+		// 双方都不保留压缩上下文，每个消息单独压缩
+		b.WriteString("Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n")
+	}
+	b.WriteString("\r\n")
+	conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		conn.Close()
+		return nil, nil, "", false, fmt.Errorf("websocket handshake write error:%v", err)
+	}
+	conn.SetWriteDeadline(time.Time{})
+	return conn, rw.Reader, subprotocol, compress, nil
+}
+
+func (op *Option) selectSubprotocol(r *http.Request) string {
+	offered := headerTokens(r.Header, "Sec-Websocket-Protocol")
+	for _, p := range op.Subprotocols {
+		for _, o := range offered {
+			if p == o {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// acceptDeflate 客户端提供了可以接受的permessage-deflate参数，
+// 不支持限制服务器窗口大小，带server_max_window_bits的提议不接受
+func acceptDeflate(header http.Header) bool {
+	for _, offer := range headerTokens(header, "Sec-Websocket-Extensions") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+		ok := true
+		for _, param := range params[1:] {
+			name := strings.TrimSpace(param)
+			value := ""
+			if i := strings.IndexByte(name, '='); i >= 0 {
+				name, value = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+			}
+			switch name {
+			case "server_no_context_takeover", "client_no_context_takeover", "client_max_window_bits":
+			case "server_max_window_bits":
+				ok = ok && value == "15"
+			default:
+				ok = false
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerTokens 逗号分隔的头部值，可以出现多次
+func headerTokens(header http.Header, name string) []string {
+	tokens := make([]string, 0)
+	for _, v := range header.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func httpError(w http.ResponseWriter, status int, reason string) error {
+	http.Error(w, reason, status)
+	return fmt.Errorf("websocket handshake error:%v", reason)
+}
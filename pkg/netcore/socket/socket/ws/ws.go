@@ -1,28 +1,31 @@
 package ws
 
 import (
-	"net"
+	"context"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/net/websocket"
+	"joynova.com/library/supernova/pkg/jlog"
 	"joynova.com/library/supernova/pkg/netcore/socket/event"
 	internalSocket "joynova.com/library/supernova/pkg/netcore/socket/socket"
 	"joynova.com/library/supernova/pkg/netcore/socket/utils"
 )
 
 type Server struct {
-	addr      string
-	GinEngine *gin.Engine
-	net.Conn
+	addr           string
+	GinEngine      *gin.Engine
+	httpServer     *http.Server
+	lock           sync.Mutex
+	stopped        bool
 	fs             http.FileSystem
 	newSessionFunc func(internalSocket.InternalClientConn) internalSocket.InternalSession
 	sessionMgr     *sync.Map
 	option         *internalSocket.InternalOption
 	loggerFun      func(params gin.LogFormatterParams)
 	panicOutputFun func(string)
+	wsOption       Option
 }
 
 func NewServer(addr string, newSessionFunc func(internalSocket.InternalClientConn) internalSocket.InternalSession, option *internalSocket.InternalOption, fs http.FileSystem) *Server {
@@ -30,9 +33,14 @@ func NewServer(addr string, newSessionFunc func(internalSocket.InternalClientCon
 	listener.addr = addr
 	listener.newSessionFunc = newSessionFunc
 	listener.sessionMgr = new(sync.Map)
+	if option == nil {
+		option = &internalSocket.InternalOption{}
+	}
 	listener.option = option
 	listener.fs = fs
 	listener.GinEngine = gin.New()
+	listener.httpServer = &http.Server{Addr: addr, Handler: listener.GinEngine}
+	listener.wsOption.Path = "/ws"
 	return listener
 }
 
@@ -44,8 +52,24 @@ func NewServerWithLogger(addr string, newSessionFunc func(internalSocket.Interna
 	return s
 }
 
+// SetWSOption 设置websocket相关的配置，需要在Listen之前调用
+func (s *Server) SetWSOption(op Option) {
+	if op.Path == "" {
+		op.Path = "/ws"
+	}
+	s.wsOption = op
+}
+
 func (s *Server) Listen() error {
+	s.route()
+	err := s.httpServer.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
 
+func (s *Server) route() {
 	s.GinEngine.Use(ginLoggerFun(s.loggerFun))
 	s.GinEngine.Use(RecoveryWithWriter(s.panicOutputFun))
 
@@ -54,23 +78,35 @@ func (s *Server) Listen() error {
 	// 	Path: "h5",
 	// })
 	// s.GinEngine.StaticFS("/client", s.fs)
-	s.GinEngine.GET("/ws", func(wsConnHandle websocket.Handler) gin.HandlerFunc {
-		return func(c *gin.Context) {
-			if c.IsWebsocket() {
-				wsConnHandle.ServeHTTP(c.Writer, c.Request)
-			} else {
-				_, _ = c.Writer.WriteString("===not websocket request===")
-			}
+	s.GinEngine.GET(s.wsOption.Path, func(c *gin.Context) {
+		if !c.IsWebsocket() {
+			_, _ = c.Writer.WriteString("===not websocket request===")
+			return
+		}
+		conn, br, subprotocol, compress, err := s.wsOption.upgrade(c.Writer, c.Request)
+		if err != nil {
+			jlog.Warnf("[net core]ws upgrade %v error:%v", c.Request.RemoteAddr, err)
+			return
 		}
-	}(func(conn *websocket.Conn) {
-		client := s.newClientConn(conn, s.option)
+		// 清除http服务器设置的超时
+		conn.SetDeadline(time.Time{})
+
+		client := s.newClientConn(conn, br, subprotocol, compress, s.option)
 		customSession := s.newSessionFunc(client)
+		// Stop之后不再加入session，保证Shutdown能关闭所有session
+		s.lock.Lock()
+		if s.stopped {
+			s.lock.Unlock()
+			client.close()
+			return
+		}
 		s.sessionMgr.Store(client.GetSessionID(), customSession)
-		go client.handleClientConnRead(s, customSession)
+		s.lock.Unlock()
+		go client.handleClientConnDeliverRecvMsg(customSession)
+		go client.handleClientConnWriteMsg(customSession)
+		go client.handleClientConnHeartbeat(s)
 		client.handleClientConnRead(s, customSession)
-	}))
-
-	return s.GinEngine.Run(s.addr)
+	})
 }
 
 func (s *Server) GetSession(id int64) (internalSocket.InternalSession, bool) {
@@ -83,14 +119,13 @@ func (s *Server) GetSession(id int64) (internalSocket.InternalSession, bool) {
 
 // CloseSession 服务器主动关闭客户端
 func (s *Server) CloseSession(id int64, notify *utils.TLVPacket, delay time.Duration, data interface{}) bool {
-	sessionValue, find := s.sessionMgr.Load(id)
+	// 先删除session，并发关闭时只有删除成功的一方调用钩子
+	sessionValue, find := s.sessionMgr.LoadAndDelete(id)
 	if !find {
 		return false
 	}
 
 	session, _ := sessionValue.(internalSocket.InternalSession)
-	// 先删除session
-	s.sessionMgr.Delete(id)
 	// 调用钩子
 	session.PreServerSideCloseSession(notify, data)
 
@@ -106,19 +141,45 @@ func (s *Server) CloseSession(id int64, notify *utils.TLVPacket, delay time.Dura
 
 // closeSession 客户端主动关闭
 func (s *Server) closeSession(id int64, err event.Error) {
-	sessionValue, find := s.sessionMgr.Load(id)
+	// 先删除session，并发关闭时只有删除成功的一方调用钩子
+	sessionValue, find := s.sessionMgr.LoadAndDelete(id)
 	if !find {
 		return
 	}
 	session, _ := sessionValue.(internalSocket.InternalSession)
-	// 先删除session
-	s.sessionMgr.Delete(id)
 	// 调用钩子
 	session.ClientSideCloseSession(err)
 	// 关闭链接
 	session.GetClientConn().(*clientConn).close()
 }
 
+// Stop 关闭http服务，已经建立的session不受影响，Listen返回nil
 func (s *Server) Stop() {
-	s.Close()
+	s.lock.Lock()
+	s.stopped = true
+	s.lock.Unlock()
+	s.httpServer.Close()
+}
+
+// Shutdown 关闭http服务，向所有session发送notify，发送完写缓冲后发送关闭帧并关闭，ctx结束时强制关闭
+func (s *Server) Shutdown(ctx context.Context, notify *utils.TLVPacket) error {
+	s.lock.Lock()
+	s.stopped = true
+	s.lock.Unlock()
+	httpDone := make(chan error, 1)
+	go func() {
+		httpDone <- s.httpServer.Shutdown(ctx)
+	}()
+
+	err := internalSocket.ShutdownSessions(ctx, s.sessionMgr, notify,
+		func(ctx context.Context, session internalSocket.InternalSession) error {
+			return session.GetClientConn().(*clientConn).flush(ctx)
+		},
+		func(session internalSocket.InternalSession) {
+			session.GetClientConn().(*clientConn).closeWith(CloseGoingAway)
+		})
+	if httpErr := <-httpDone; err == nil {
+		err = httpErr
+	}
+	return err
 }
@@ -0,0 +1,257 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"joynova.com/library/supernova/pkg/netcore/socket/codec"
+	"joynova.com/library/supernova/pkg/netcore/socket/event"
+	"joynova.com/library/supernova/pkg/netcore/socket/heartbeat"
+	internalSocket "joynova.com/library/supernova/pkg/netcore/socket/socket"
+	"joynova.com/library/supernova/pkg/netcore/socket/utils"
+)
+
+type echoSession struct {
+	conn   internalSocket.InternalClientConn
+	closed chan event.Error
+}
+
+func (s *echoSession) GetClientConn() internalSocket.InternalClientConn { return s.conn }
+func (s *echoSession) PreHandleRequest(*utils.TLVPacket) (*utils.TLVPacket, interface{}, error) {
+	return nil, nil, nil
+}
+func (s *echoSession) HandleRequest(request *utils.TLVPacket, _ interface{}) (*utils.TLVPacket, interface{}, error) {
+	return &utils.TLVPacket{Tag: request.Tag + 1, Payload: request.Payload}, nil, nil
+}
+func (s *echoSession) PreHandleResponse(*utils.TLVPacket, *utils.TLVPacket, interface{}) error {
+	return nil
+}
+func (s *echoSession) PostHandleResponse(*utils.TLVPacket, *utils.TLVPacket, interface{}, error) {}
+func (s *echoSession) PreHandleNotify(uint32, []byte)                                            {}
+func (s *echoSession) PreWritePacket([]byte)                                                     {}
+func (s *echoSession) PreServerSideCloseSession(*utils.TLVPacket, interface{})                   {}
+func (s *echoSession) ServerSideCloseSession(interface{})                                        {}
+func (s *echoSession) ClientSideCloseSession(err event.Error)                                    { s.closed <- err }
+
+func newTestServer(t *testing.T, option *internalSocket.InternalOption, wsOption Option) (*httptest.Server, chan *echoSession) {
+	sessions := make(chan *echoSession, 10)
+	s := NewServerWithLogger("", func(conn internalSocket.InternalClientConn) internalSocket.InternalSession {
+		session := &echoSession{conn: conn, closed: make(chan event.Error, 1)}
+		sessions <- session
+		return session
+	}, option, func(gin.LogFormatterParams) {}, func(string) {}, nil)
+	s.SetWSOption(wsOption)
+	s.route()
+	ts := httptest.NewServer(s.GinEngine)
+	t.Cleanup(ts.Close)
+	return ts, sessions
+}
+
+// dial 客户端握手，返回响应和客户端一侧的帧读写
+func dial(t *testing.T, ts *httptest.Server, header http.Header) (*http.Response, *wsConn) {
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newWsConn(conn, br, false)
+	client.readTimeout = 2 * time.Second
+	client.readLimit = 1 << 20
+	return resp, client
+}
+
+func TestHandshake(t *testing.T) {
+	ts, _ := newTestServer(t, nil, Option{
+		Subprotocols:      []string{"game.v2", "game.v1"},
+		EnableCompression: true,
+		CheckOrigin: func(r *http.Request) bool {
+			return r.Header.Get("Origin") != "http://evil.com"
+		},
+	})
+
+	resp, _ := dial(t, ts, http.Header{
+		"Sec-Websocket-Protocol":   {"game.v1, game.v2"},
+		"Sec-Websocket-Extensions": {"permessage-deflate; server_max_window_bits=10, permessage-deflate; client_max_window_bits"},
+	})
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %v", resp.StatusCode)
+	}
+	if resp.Header.Get("Sec-Websocket-Accept") != acceptKey(base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))) {
+		t.Fatalf("accept %v", resp.Header.Get("Sec-Websocket-Accept"))
+	}
+	if resp.Header.Get("Sec-Websocket-Protocol") != "game.v2" {
+		t.Fatalf("subprotocol %v", resp.Header.Get("Sec-Websocket-Protocol"))
+	}
+	if !strings.HasPrefix(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate") {
+		t.Fatalf("extensions %v", resp.Header.Get("Sec-Websocket-Extensions"))
+	}
+
+	if resp, _ := dial(t, ts, http.Header{"Origin": {"http://evil.com"}}); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("bad origin status %v", resp.StatusCode)
+	}
+	if resp, _ := dial(t, ts, http.Header{"Sec-Websocket-Version": {"8"}}); resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("bad version status %v", resp.StatusCode)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	ts, sessions := newTestServer(t, &internalSocket.InternalOption{Codec: codec.TLVCodec{}, RecvMsgBytes: 1 << 14},
+		Option{EnableCompression: true})
+	resp, client := dial(t, ts, http.Header{"Sec-Websocket-Extensions": {"permessage-deflate"}})
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %v", resp.StatusCode)
+	}
+	client.compress = true
+	session := <-sessions
+	if session.conn.GetIP() != client.conn.LocalAddr().String() {
+		t.Fatalf("ip %v, want %v", session.conn.GetIP(), client.conn.LocalAddr())
+	}
+
+	// 和tcp相同的tlv字节，大消息双向压缩
+	for _, payload := range [][]byte{[]byte("hi"), bytes.Repeat([]byte("payload"), 1000)} {
+		msg, _ := codec.TLVCodec{}.Encode(10, payload)
+		if err := client.writeMessage(opBinary, msg); err != nil {
+			t.Fatal(err)
+		}
+		op, res, err := client.readMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		packet, err := codec.TLVCodec{}.Decode(res)
+		if op != opBinary || err != nil || packet.Tag != 11 || !bytes.Equal(packet.Payload, payload) {
+			t.Fatalf("response op:%v tag:%v err:%v", op, packet, err)
+		}
+	}
+
+	// 分片消息，中间插入ping，掩码为0
+	msg, _ := codec.TLVCodec{}.Encode(20, []byte("fragmented"))
+	client.conn.Write(append([]byte{opBinary, maskBit | 6, 0, 0, 0, 0}, msg[:6]...))
+	client.conn.Write([]byte{finalBit | opPing, maskBit, 0, 0, 0, 0})
+	client.conn.Write(append([]byte{finalBit | opContinuation, maskBit | byte(len(msg)-6), 0, 0, 0, 0}, msg[6:]...))
+	if _, res, err := client.readMessage(); err != nil {
+		t.Fatal(err)
+	} else if packet, _ := (codec.TLVCodec{}).Decode(res); packet.Tag != 21 {
+		t.Fatalf("fragmented response %v", packet)
+	}
+
+	// 超过RecvMsgBytes关闭连接
+	msg, _ = codec.TLVCodec{}.Encode(30, make([]byte, 1<<15))
+	client.compress = false
+	client.writeMessage(opBinary, msg)
+	_, _, err := client.readMessage()
+	if e, ok := err.(*CloseError); !ok || e.Code != CloseMessageTooBig {
+		t.Fatalf("too big message error %v", err)
+	}
+	select {
+	case err := <-session.closed:
+		if e, ok := err.(*CloseError); !ok || e.Code != CloseMessageTooBig {
+			t.Fatalf("close session error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session not closed")
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	ts, sessions := newTestServer(t, &internalSocket.InternalOption{RecvTimeout: 300 * time.Millisecond}, Option{})
+
+	// 回复ping的客户端不会超时
+	_, client := dial(t, ts, nil)
+	session := <-sessions
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.readMessage()
+		done <- err
+	}()
+	select {
+	case err := <-session.closed:
+		t.Fatalf("alive session closed %v", err)
+	case <-time.After(time.Second):
+	}
+	client.writeClose(CloseNormal, "bye")
+	select {
+	case err := <-session.closed:
+		if e, ok := err.(*CloseError); !ok || e.Code != CloseNormal || e.Text != "bye" {
+			t.Fatalf("close error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("closed session not closed")
+	}
+	<-done
+
+	// 不读取的客户端收不到ping，也不回复pong，读超时关闭
+	dial(t, ts, nil)
+	session = <-sessions
+	select {
+	case err := <-session.closed:
+		if err != event.ErrReadTimeout {
+			t.Fatalf("idle session error %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle session not closed")
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	// 默认json编解码
+	ts, sessions := newTestServer(t, &internalSocket.InternalOption{
+		Heartbeat: &heartbeat.Option{PingTag: 100, Interval: 50 * time.Millisecond},
+	}, Option{})
+	_, client := dial(t, ts, nil)
+	session := <-sessions
+
+	for i := 0; i < 3; i++ {
+		op, msg, err := client.readMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ping, err := codec.JSONCodec{}.Decode(msg)
+		if op != opText || err != nil || ping.Tag != 100 {
+			t.Fatalf("ping op:%v %s %v", op, msg, err)
+		}
+		pong, _ := codec.JSONCodec{}.Encode(101, ping.Payload)
+		if err := client.writeMessage(opText, pong); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 100 && session.conn.GetRTT() <= 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if session.conn.GetRTT() <= 0 {
+		t.Fatalf("rtt %v", session.conn.GetRTT())
+	}
+
+	// 不再回复pong，连续3个ping没有回复踢出
+	select {
+	case err := <-session.closed:
+		if err != event.ErrHeartbeatTimeout {
+			t.Fatalf("kick reason %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("session not kicked")
+	}
+}